@@ -0,0 +1,126 @@
+// Copyright 2023 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+
+package gidari
+
+import (
+	"google.golang.org/protobuf/proto"
+	structpb "google.golang.org/protobuf/types/known/structpb"
+)
+
+// batchSize bounds the lists that are passed to the list writers. A zero value
+// for either bound means that the bound is not set.
+type batchSize struct {
+	values int
+	bytes  int
+}
+
+func (size batchSize) isZero() bool {
+	return size.values <= 0 && size.bytes <= 0
+}
+
+// or will return the bounds of the batch size, defaulting to the bounds of the
+// fallback batch size.
+func (size batchSize) or(fallback batchSize) batchSize {
+	if size.values <= 0 {
+		size.values = fallback.values
+	}
+
+	if size.bytes <= 0 {
+		size.bytes = fallback.bytes
+	}
+
+	return size
+}
+
+// WithBatchSize will stream the response to the request's list writers in
+// lists of at most n values, so that "ListWriter.Write" is called repeatedly
+// for one response. JSON arrays and newline-delimited JSON are decoded as they
+// are streamed, keeping memory bounded regardless of the size of the response.
+// Responses of other types are decoded whole and then split into lists.
+func WithBatchSize(n int) RequestOption {
+	return func(req *Request) {
+		req.batch.values = n
+	}
+}
+
+// WithBatchBytes will stream the response to the request's list writers in
+// lists of roughly n bytes, measured by the encoded size of the values. See
+// "WithBatchSize" for details on streaming.
+func WithBatchBytes(n int) RequestOption {
+	return func(req *Request) {
+		req.batch.bytes = n
+	}
+}
+
+// batcher groups values into lists bounded by the batch size and writes each
+// list as soon as it is full.
+type batcher struct {
+	size  batchSize
+	write func(list *structpb.ListValue) error
+
+	list    *structpb.ListValue
+	bytes   int
+	written bool
+}
+
+func newBatcher(size batchSize, write func(list *structpb.ListValue) error) *batcher {
+	return &batcher{
+		size:  size,
+		write: write,
+		list:  &structpb.ListValue{},
+	}
+}
+
+func (bat *batcher) full() bool {
+	if bat.size.values > 0 && len(bat.list.Values) >= bat.size.values {
+		return true
+	}
+
+	return bat.size.bytes > 0 && bat.bytes >= bat.size.bytes
+}
+
+// add will add the values of the list to the batch, writing the batch each
+// time it is full.
+func (bat *batcher) add(list *structpb.ListValue) error {
+	for _, val := range list.Values {
+		bat.list.Values = append(bat.list.Values, val)
+
+		if bat.size.bytes > 0 {
+			bat.bytes += proto.Size(val)
+		}
+
+		if bat.full() {
+			if err := bat.flush(); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func (bat *batcher) flush() error {
+	list := bat.list
+
+	bat.list = &structpb.ListValue{}
+	bat.bytes = 0
+	bat.written = true
+
+	return bat.write(list)
+}
+
+// close will write the remaining values. If no list has been written at all,
+// then an empty list is written.
+func (bat *batcher) close() error {
+	if len(bat.list.Values) > 0 || !bat.written {
+		return bat.flush()
+	}
+
+	return nil
+}
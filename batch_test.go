@@ -0,0 +1,209 @@
+// Copyright 2023 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+
+package gidari
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"google.golang.org/protobuf/proto"
+	structpb "google.golang.org/protobuf/types/known/structpb"
+)
+
+func TestBatcher(t *testing.T) {
+	t.Parallel()
+
+	newValues := func(count int) *structpb.ListValue {
+		list := &structpb.ListValue{}
+		for i := 0; i < count; i++ {
+			list.Values = append(list.Values, structpb.NewStructValue(&structpb.Struct{
+				Fields: map[string]*structpb.Value{"id": structpb.NewNumberValue(float64(i))},
+			}))
+		}
+
+		return list
+	}
+
+	valueSize := proto.Size(newValues(1).Values[0])
+
+	for _, tcase := range []struct {
+		name  string
+		size  batchSize
+		adds  []int
+		sizes []int
+	}{
+		{
+			name:  "no values",
+			size:  batchSize{values: 2},
+			sizes: []int{0},
+		},
+		{
+			name:  "unbounded",
+			adds:  []int{3, 4},
+			sizes: []int{7},
+		},
+		{
+			name:  "bounded by values",
+			size:  batchSize{values: 3},
+			adds:  []int{1, 5, 1},
+			sizes: []int{3, 3, 1},
+		},
+		{
+			name:  "bounded by values without remainder",
+			size:  batchSize{values: 2},
+			adds:  []int{4},
+			sizes: []int{2, 2},
+		},
+		{
+			name:  "bounded by bytes",
+			size:  batchSize{bytes: 2 * valueSize},
+			adds:  []int{5},
+			sizes: []int{2, 2, 1},
+		},
+		{
+			name:  "bounded by values and bytes",
+			size:  batchSize{values: 2, bytes: 3 * valueSize},
+			adds:  []int{3},
+			sizes: []int{2, 1},
+		},
+	} {
+		tcase := tcase
+
+		t.Run(tcase.name, func(t *testing.T) {
+			t.Parallel()
+
+			var sizes []int
+
+			bat := newBatcher(tcase.size, func(list *structpb.ListValue) error {
+				sizes = append(sizes, len(list.Values))
+
+				return nil
+			})
+
+			for _, count := range tcase.adds {
+				if err := bat.add(newValues(count)); err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+			}
+
+			if err := bat.close(); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if fmt.Sprint(sizes) != fmt.Sprint(tcase.sizes) {
+				t.Fatalf("batch sizes = %v, want %v", sizes, tcase.sizes)
+			}
+		})
+	}
+}
+
+func TestHTTPServiceStoreBatchSize(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, ".csv") {
+			w.Header().Set("Content-Type", "text/csv")
+			fmt.Fprint(w, "id\n1\n2\n3\n4\n5\n")
+
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `[{"id":1},{"id":2},{"id":3},{"id":4},{"id":5}]`)
+	}))
+	defer server.Close()
+
+	for _, tcase := range []struct {
+		name       string
+		path       string
+		svcBatch   int
+		reqOpts    []RequestOption
+		wantWrites int
+	}{
+		{
+			name:       "no batch size",
+			path:       "/items.json",
+			wantWrites: 1,
+		},
+		{
+			name:       "request batch size",
+			path:       "/items.json",
+			reqOpts:    []RequestOption{WithBatchSize(2)},
+			wantWrites: 3,
+		},
+		{
+			name:       "service batch size",
+			path:       "/items.json",
+			svcBatch:   4,
+			wantWrites: 2,
+		},
+		{
+			name:       "request batch size overrides service",
+			path:       "/items.json",
+			svcBatch:   4,
+			reqOpts:    []RequestOption{WithBatchSize(1)},
+			wantWrites: 5,
+		},
+		{
+			name:       "non-streaming decoder",
+			path:       "/items.csv",
+			reqOpts:    []RequestOption{WithBatchSize(2)},
+			wantWrites: 3,
+		},
+	} {
+		t.Run(tcase.name, func(t *testing.T) {
+			svc, err := NewService(context.Background())
+			if err != nil {
+				t.Fatalf("failed to create service: %v", err)
+			}
+
+			req, err := http.NewRequestWithContext(context.Background(), http.MethodGet,
+				server.URL+tcase.path, nil)
+			if err != nil {
+				t.Fatalf("failed to create request: %v", err)
+			}
+
+			writer := &mockListWriter{}
+
+			svc.HTTP.
+				Client(server.Client()).
+				BatchSize(tcase.svcBatch).
+				Requests(NewHTTPRequest(req, append(tcase.reqOpts, WithWriters(writer))...))
+
+			if err := svc.HTTP.Store(context.Background()); err != nil {
+				t.Fatalf("failed to store: %v", err)
+			}
+
+			if writer.count != tcase.wantWrites {
+				t.Fatalf("expected %d writes, got %d", tcase.wantWrites, writer.count)
+			}
+
+			// All records must be written in order.
+			var got []string
+			for _, data := range writer.data {
+				list := &structpb.ListValue{}
+				if err := list.UnmarshalJSON(data); err != nil {
+					t.Fatalf("failed to unmarshal list: %v", err)
+				}
+
+				for _, val := range list.Values {
+					got = append(got, fmt.Sprint(val.GetStructValue().AsMap()["id"]))
+				}
+			}
+
+			if strings.Join(got, ",") != "1,2,3,4,5" {
+				t.Fatalf("unexpected records: %v", got)
+			}
+		})
+	}
+}
@@ -0,0 +1,272 @@
+// Copyright 2023 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+
+package gidari
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	structpb "google.golang.org/protobuf/types/known/structpb"
+)
+
+// BufferedWriter is a ListWriter that coalesces the lists written to it, e.g.
+// the one-record lists of a socket feed, into larger lists for the wrapped
+// writer. The buffered records are written when the buffer is full, when the
+// flush interval elapses, when the context of a write is canceled, and when
+// the writer is flushed or closed. Since the services flush their writers when
+// they finish, a BufferedWriter can be used with both the HTTPService and the
+// SocketService.
+//
+// Errors from writes that are not made by "Write" or "Flush", i.e. after the
+// flush interval or context cancellation, are returned by the next call to
+// "Write" or "Flush".
+//
+// The lists written to the wrapped writer can hold records from different
+// sources, so the "WriteWithMeta" method of a MetaListWriter is not called.
+type BufferedWriter struct {
+	writer   ListWriter
+	size     batchSize
+	interval time.Duration
+
+	mu    sync.Mutex
+	batch *batcher
+
+	// ctx is the context of the most recent write, used to write the
+	// buffered records.
+	ctx context.Context //nolint:containedctx
+
+	// timer flushes the buffer after the flush interval. The generation
+	// identifies the most recent timer, so that a timer that fires after it
+	// is stopped does nothing.
+	timer      *time.Timer
+	generation int
+
+	// watched is the done channel of the most recent context that is
+	// watched for cancellation, and stop stops the watchers.
+	watched <-chan struct{}
+	stop    chan struct{}
+
+	err error
+}
+
+// BufferedWriterOption is a function for configuring a BufferedWriter.
+type BufferedWriterOption func(*BufferedWriter)
+
+// WithBufferSize will write the buffered records once there are at least n
+// records, in lists of n records.
+func WithBufferSize(n int) BufferedWriterOption {
+	return func(bw *BufferedWriter) {
+		bw.size.values = n
+	}
+}
+
+// WithBufferBytes will write the buffered records once they are roughly n
+// bytes, measured by the encoded size of the records.
+func WithBufferBytes(n int) BufferedWriterOption {
+	return func(bw *BufferedWriter) {
+		bw.size.bytes = n
+	}
+}
+
+// WithFlushInterval will write the buffered records at most d after the first
+// of them was buffered.
+func WithFlushInterval(d time.Duration) BufferedWriterOption {
+	return func(bw *BufferedWriter) {
+		bw.interval = d
+	}
+}
+
+// NewBufferedWriter will create a BufferedWriter that writes to the writer. If
+// no option is given, then the records are only written when the writer is
+// flushed, closed or the context of a write is canceled.
+func NewBufferedWriter(writer ListWriter, opts ...BufferedWriterOption) *BufferedWriter {
+	bw := &BufferedWriter{writer: writer}
+	for _, opt := range opts {
+		opt(bw)
+	}
+
+	bw.batch = newBatcher(bw.size, func(list *structpb.ListValue) error {
+		return bw.writer.Write(bw.ctx, list)
+	})
+
+	return bw
+}
+
+// detachedContext keeps the values of a context without its cancellation, so
+// that the buffered records can be written after the context is canceled.
+type detachedContext struct {
+	context.Context //nolint:containedctx
+}
+
+func (detachedContext) Deadline() (time.Time, bool) { return time.Time{}, false }
+func (detachedContext) Done() <-chan struct{}       { return nil }
+func (detachedContext) Err() error                  { return nil }
+
+// takeErr will return and clear the error of the most recent background write.
+func (bw *BufferedWriter) takeErr() error {
+	err := bw.err
+	bw.err = nil
+
+	return err
+}
+
+// setErr will keep the first error of the background writes.
+func (bw *BufferedWriter) setErr(err error) {
+	if bw.err == nil {
+		bw.err = err
+	}
+}
+
+// flush will write the buffered records with the context. The lock must be
+// held.
+func (bw *BufferedWriter) flush(ctx context.Context) error {
+	if bw.timer != nil {
+		bw.timer.Stop()
+		bw.timer = nil
+	}
+
+	if len(bw.batch.list.GetValues()) == 0 {
+		return nil
+	}
+
+	// Write with the given context, restoring the context of the most
+	// recent write afterwards.
+	prev := bw.ctx
+	bw.ctx = ctx
+
+	defer func() { bw.ctx = prev }()
+
+	return bw.batch.flush()
+}
+
+// startTimer will start the flush timer if there are buffered records and the
+// timer is not running. The lock must be held.
+func (bw *BufferedWriter) startTimer() {
+	if len(bw.batch.list.GetValues()) == 0 {
+		if bw.timer != nil {
+			bw.timer.Stop()
+			bw.timer = nil
+		}
+
+		return
+	}
+
+	if bw.interval <= 0 || bw.timer != nil {
+		return
+	}
+
+	bw.generation++
+	generation := bw.generation
+
+	bw.timer = time.AfterFunc(bw.interval, func() {
+		bw.mu.Lock()
+		defer bw.mu.Unlock()
+
+		if bw.timer == nil || bw.generation != generation {
+			return
+		}
+
+		bw.setErr(bw.flush(detachedContext{bw.ctx}))
+	})
+}
+
+// watch will write the buffered records when the context is canceled. The lock
+// must be held.
+func (bw *BufferedWriter) watch(ctx context.Context) {
+	done := ctx.Done()
+	if done == nil || done == bw.watched {
+		return
+	}
+
+	if bw.stop == nil {
+		bw.stop = make(chan struct{})
+	}
+
+	bw.watched = done
+	stop := bw.stop
+
+	go func() {
+		select {
+		case <-done:
+			bw.mu.Lock()
+			defer bw.mu.Unlock()
+
+			bw.setErr(bw.flush(detachedContext{ctx}))
+		case <-stop:
+		}
+	}()
+}
+
+// Write will buffer the records in the list, writing the buffered records if
+// the buffer is full.
+func (bw *BufferedWriter) Write(ctx context.Context, list *structpb.ListValue) error {
+	bw.mu.Lock()
+	defer bw.mu.Unlock()
+
+	if err := bw.takeErr(); err != nil {
+		return err
+	}
+
+	bw.watch(ctx)
+	bw.ctx = ctx
+
+	err := bw.batch.add(list)
+
+	bw.startTimer()
+
+	return err
+}
+
+// Flush will write the buffered records and then flush the wrapped writer if it
+// implements Flusher.
+func (bw *BufferedWriter) Flush() error {
+	bw.mu.Lock()
+	defer bw.mu.Unlock()
+
+	err := joinErrors(bw.takeErr(), bw.flushBuffer())
+
+	if flusher, ok := bw.writer.(Flusher); ok {
+		err = joinErrors(err, flusher.Flush())
+	}
+
+	return err
+}
+
+// flushBuffer will write the buffered records with the context of the most
+// recent write. The lock must be held.
+func (bw *BufferedWriter) flushBuffer() error {
+	var ctx context.Context = detachedContext{context.Background()}
+	if bw.ctx != nil {
+		ctx = detachedContext{bw.ctx}
+	}
+
+	return bw.flush(ctx)
+}
+
+// Close will write the buffered records, stop watching for the cancellation of
+// contexts, and then close the wrapped writer if it implements Closer. The
+// writer can still be written to after it is closed.
+func (bw *BufferedWriter) Close() error {
+	bw.mu.Lock()
+	defer bw.mu.Unlock()
+
+	err := joinErrors(bw.takeErr(), bw.flushBuffer())
+
+	if bw.stop != nil {
+		close(bw.stop)
+		bw.stop, bw.watched = nil, nil
+	}
+
+	if closer, ok := bw.writer.(Closer); ok {
+		err = joinErrors(err, closer.Close())
+	}
+
+	return err
+}
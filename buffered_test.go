@@ -0,0 +1,233 @@
+// Copyright 2023 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+
+package gidari
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	structpb "google.golang.org/protobuf/types/known/structpb"
+)
+
+// listWriterFunc is a ListWriter that calls the function.
+type listWriterFunc func(ctx context.Context, list *structpb.ListValue) error
+
+func (fn listWriterFunc) Write(ctx context.Context, list *structpb.ListValue) error {
+	return fn(ctx, list)
+}
+
+// writeRecords will write each of the records to the writer in its own list.
+func writeRecords(ctx context.Context, t *testing.T, writer ListWriter, records ...string) {
+	t.Helper()
+
+	for _, record := range records {
+		list := &structpb.ListValue{}
+		if err := decodeFuncJSON(strings.NewReader(record))(list); err != nil {
+			t.Fatalf("failed to decode: %v", err)
+		}
+
+		if err := writer.Write(ctx, list); err != nil {
+			t.Fatalf("failed to write: %v", err)
+		}
+	}
+}
+
+// waitForWrites will wait for the writer to be written to n times.
+func waitForWrites(t *testing.T, writer *mockFlushCloseWriter, n int) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+
+	for {
+		writer.countMu.Lock()
+		count := writer.count
+		writer.countMu.Unlock()
+
+		if count >= n {
+			return
+		}
+
+		if time.Now().After(deadline) {
+			t.Fatalf("expected %d writes, got %d", n, count)
+		}
+
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestBufferedWriter(t *testing.T) {
+	t.Parallel()
+
+	records := []string{`{"x":1}`, `{"x":2}`, `{"x":3}`, `{"x":4}`, `{"x":5}`}
+
+	for _, tcase := range []struct {
+		name string
+		opts []BufferedWriterOption
+		want [][]byte
+	}{
+		{
+			name: "no bounds",
+			want: [][]byte{[]byte(`[{"x":1},{"x":2},{"x":3},{"x":4},{"x":5}]`)},
+		},
+		{
+			name: "size",
+			opts: []BufferedWriterOption{WithBufferSize(2)},
+			want: [][]byte{
+				[]byte(`[{"x":1},{"x":2}]`),
+				[]byte(`[{"x":3},{"x":4}]`),
+				[]byte(`[{"x":5}]`),
+			},
+		},
+		{
+			name: "bytes",
+			opts: []BufferedWriterOption{WithBufferBytes(40)},
+			want: [][]byte{
+				[]byte(`[{"x":1},{"x":2},{"x":3}]`),
+				[]byte(`[{"x":4},{"x":5}]`),
+			},
+		},
+	} {
+		tcase := tcase
+
+		t.Run(tcase.name, func(t *testing.T) {
+			t.Parallel()
+
+			writer := &mockFlushCloseWriter{}
+			buffered := NewBufferedWriter(writer, tcase.opts...)
+
+			writeRecords(context.Background(), t, buffered, records...)
+
+			if err := buffered.Flush(); err != nil {
+				t.Fatalf("failed to flush: %v", err)
+			}
+
+			if err := buffered.Close(); err != nil {
+				t.Fatalf("failed to close: %v", err)
+			}
+
+			if writer.flushes != 1 || writer.closes != 1 {
+				t.Fatalf("flushes, closes = %d, %d, want 1, 1", writer.flushes, writer.closes)
+			}
+
+			assertSocketWrites(t, []ListWriter{&writer.mockListWriter}, tcase.want)
+		})
+	}
+}
+
+func TestBufferedWriterInterval(t *testing.T) {
+	t.Parallel()
+
+	writer := &mockFlushCloseWriter{}
+	buffered := NewBufferedWriter(writer, WithFlushInterval(10*time.Millisecond))
+
+	writeRecords(context.Background(), t, buffered, `{"x":1}`, `{"x":2}`)
+	waitForWrites(t, writer, 1)
+
+	writeRecords(context.Background(), t, buffered, `{"x":3}`)
+	waitForWrites(t, writer, 2)
+
+	assertSocketWrites(t, []ListWriter{&writer.mockListWriter}, [][]byte{
+		[]byte(`[{"x":1},{"x":2}]`),
+		[]byte(`[{"x":3}]`),
+	})
+}
+
+func TestBufferedWriterContextCanceled(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	var canceled error
+
+	writer := &mockFlushCloseWriter{}
+	buffered := NewBufferedWriter(listWriterFunc(func(ctx context.Context, list *structpb.ListValue) error {
+		// The buffered records must be written with a context that
+		// is not canceled.
+		canceled = ctx.Err()
+
+		return writer.Write(ctx, list)
+	}))
+
+	writeRecords(ctx, t, buffered, `{"x":1}`, `{"x":2}`)
+	cancel()
+	waitForWrites(t, writer, 1)
+
+	if err := buffered.Close(); err != nil {
+		t.Fatalf("failed to close: %v", err)
+	}
+
+	if canceled != nil {
+		t.Fatalf("expected the records to be written without cancellation, got %v", canceled)
+	}
+}
+
+func TestBufferedWriterBackgroundError(t *testing.T) {
+	t.Parallel()
+
+	errWrite := fmt.Errorf("write error")
+
+	buffered := NewBufferedWriter(listWriterFunc(func(context.Context, *structpb.ListValue) error {
+		return errWrite
+	}), WithFlushInterval(time.Millisecond))
+
+	writeRecords(context.Background(), t, buffered, `{"x":1}`)
+
+	deadline := time.Now().Add(5 * time.Second)
+
+	// Wait for the flush interval to elapse.
+	for {
+		buffered.mu.Lock()
+		err := buffered.err
+		buffered.mu.Unlock()
+
+		if err != nil {
+			break
+		}
+
+		if time.Now().After(deadline) {
+			t.Fatalf("expected the buffered records to be written")
+		}
+
+		time.Sleep(time.Millisecond)
+	}
+
+	if err := buffered.Flush(); !errors.Is(err, errWrite) {
+		t.Fatalf("expected error %v, got %v", errWrite, err)
+	}
+}
+
+func TestSocketStoreBufferedWriter(t *testing.T) {
+	t.Parallel()
+
+	writer := &mockFlushCloseWriter{}
+
+	var data [][]byte
+	for idx := 1; idx <= 5; idx++ {
+		data = append(data, []byte(fmt.Sprintf(`[{"x":%d}]`, idx)))
+	}
+
+	socket := NewSocket(&mockConn{readData: data},
+		WithSocketWriters(NewBufferedWriter(writer, WithBufferSize(100))))
+
+	if err := NewSocketService(nil).Connections(socket).Store(context.Background()); err != nil {
+		t.Fatalf("failed to store: %v", err)
+	}
+
+	if writer.flushes != 1 || writer.closes != 1 {
+		t.Fatalf("flushes, closes = %d, %d, want 1, 1", writer.flushes, writer.closes)
+	}
+
+	assertSocketWrites(t, []ListWriter{&writer.mockListWriter}, [][]byte{
+		[]byte(`[{"x":1},{"x":2},{"x":3},{"x":4},{"x":5}]`),
+	})
+}
@@ -0,0 +1,159 @@
+// Copyright 2023 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+
+package gidari
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+
+	structpb "google.golang.org/protobuf/types/known/structpb"
+)
+
+// utf8BOM is the byte order mark that some CSV exports prepend to the data.
+const utf8BOM = "\ufeff"
+
+type csvDecoder struct {
+	delimiter rune
+	columns   []string
+	infer     bool
+}
+
+// CSVOption is a function for configuring the CSV decoder.
+type CSVOption func(*csvDecoder)
+
+// WithCSVDelimiter will set the field delimiter, e.g. ';' or '\t'. The default
+// delimiter is ','.
+func WithCSVDelimiter(delimiter rune) CSVOption {
+	return func(dec *csvDecoder) {
+		dec.delimiter = delimiter
+	}
+}
+
+// WithCSVColumns will set the column names for data that has no header row.
+// When set, the first row of the data is decoded as a record.
+func WithCSVColumns(columns ...string) CSVOption {
+	return func(dec *csvDecoder) {
+		dec.columns = columns
+	}
+}
+
+// WithCSVTypeInference will decode fields that look like numbers or booleans
+// as such, rather than as strings. Empty fields are decoded as null. Fields
+// that are not finite, such as "NaN", or have leading zeros, such as "00123",
+// are kept as strings.
+func WithCSVTypeInference() CSVOption {
+	return func(dec *csvDecoder) {
+		dec.infer = true
+	}
+}
+
+// NewCSVDecoder will return a decoder factory for CSV data. Each row is decoded
+// into a struct keyed by the column names, which are read from the header row
+// unless they are set with the "WithCSVColumns" option.
+func NewCSVDecoder(opts ...CSVOption) DecoderFactory {
+	dec := &csvDecoder{delimiter: ','}
+	for _, opt := range opts {
+		opt(dec)
+	}
+
+	return func(r io.Reader) DecodeFunc {
+		return func(list *structpb.ListValue) error {
+			return dec.decode(r, list)
+		}
+	}
+}
+
+// hasLeadingZero will report whether the field is a zero-padded number, such as
+// a ZIP code, which is not a number but an identifier.
+func hasLeadingZero(field string) bool {
+	field = strings.TrimLeft(field, "+-")
+
+	return len(field) > 1 && field[0] == '0' && field[1] >= '0' && field[1] <= '9'
+}
+
+// inferValue will convert the field into a number, boolean or null value if
+// possible. Only finite numbers without leading zeros are converted.
+func inferValue(field string) *structpb.Value {
+	if field == "" {
+		return structpb.NewNullValue()
+	}
+
+	if num, err := strconv.ParseFloat(field, 64); err == nil && !math.IsNaN(num) && !math.IsInf(num, 0) &&
+		!hasLeadingZero(field) {
+		return structpb.NewNumberValue(num)
+	}
+
+	switch strings.ToLower(field) {
+	case "true":
+		return structpb.NewBoolValue(true)
+	case "false":
+		return structpb.NewBoolValue(false)
+	}
+
+	return structpb.NewStringValue(field)
+}
+
+func (dec *csvDecoder) decode(r io.Reader, list *structpb.ListValue) error {
+	reader := csv.NewReader(r)
+	reader.Comma = dec.delimiter
+	reader.ReuseRecord = true
+
+	columns := dec.columns
+
+	if len(columns) == 0 {
+		header, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+
+		if err != nil {
+			return fmt.Errorf("failed to read csv header: %w", err)
+		}
+
+		columns = make([]string, len(header))
+		copy(columns, header)
+
+		columns[0] = strings.TrimPrefix(columns[0], utf8BOM)
+	}
+
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+
+		if err != nil {
+			return fmt.Errorf("failed to read csv record: %w", err)
+		}
+
+		if len(record) != len(columns) {
+			line, _ := reader.FieldPos(0)
+
+			return fmt.Errorf("%w: line %d has %d fields, expected %d",
+				csv.ErrFieldCount, line, len(record), len(columns))
+		}
+
+		fields := make(map[string]*structpb.Value, len(columns))
+
+		for idx, field := range record {
+			if dec.infer {
+				fields[columns[idx]] = inferValue(field)
+			} else {
+				fields[columns[idx]] = structpb.NewStringValue(field)
+			}
+		}
+
+		list.Values = append(list.Values, structpb.NewStructValue(&structpb.Struct{Fields: fields}))
+	}
+}
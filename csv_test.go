@@ -0,0 +1,176 @@
+// Copyright 2023 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+
+package gidari
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"google.golang.org/protobuf/proto"
+	structpb "google.golang.org/protobuf/types/known/structpb"
+)
+
+func TestCSVDecoder(t *testing.T) {
+	t.Parallel()
+
+	for _, tcase := range []struct {
+		name            string
+		data            string
+		opts            []CSVOption
+		expectedResults []interface{}
+		err             error
+	}{
+		{
+			name: "empty data",
+		},
+		{
+			name: "header only",
+			data: "id,name\n",
+		},
+		{
+			name: "header and rows",
+			data: "id,name\n1,foo\n2,bar\n",
+			expectedResults: []interface{}{
+				map[string]interface{}{"id": "1", "name": "foo"},
+				map[string]interface{}{"id": "2", "name": "bar"},
+			},
+		},
+		{
+			name: "byte order mark",
+			data: "\ufeffid,name\n1,foo\n",
+			expectedResults: []interface{}{
+				map[string]interface{}{"id": "1", "name": "foo"},
+			},
+		},
+		{
+			name: "quoted fields",
+			data: "id,name\n1,\"foo, bar\"\n",
+			expectedResults: []interface{}{
+				map[string]interface{}{"id": "1", "name": "foo, bar"},
+			},
+		},
+		{
+			name: "custom delimiter",
+			data: "id;name\n1;foo\n",
+			opts: []CSVOption{WithCSVDelimiter(';')},
+			expectedResults: []interface{}{
+				map[string]interface{}{"id": "1", "name": "foo"},
+			},
+		},
+		{
+			name: "header-less with columns",
+			data: "1\tfoo\n2\tbar\n",
+			opts: []CSVOption{WithCSVDelimiter('\t'), WithCSVColumns("id", "name")},
+			expectedResults: []interface{}{
+				map[string]interface{}{"id": "1", "name": "foo"},
+				map[string]interface{}{"id": "2", "name": "bar"},
+			},
+		},
+		{
+			name: "type inference",
+			data: "id,price,active,name,note\n1,9.5,true,foo,\n2,-3,FALSE,007x,n/a\n",
+			opts: []CSVOption{WithCSVTypeInference()},
+			expectedResults: []interface{}{
+				map[string]interface{}{"id": 1, "price": 9.5, "active": true, "name": "foo", "note": nil},
+				map[string]interface{}{"id": 2, "price": -3, "active": false, "name": "007x", "note": "n/a"},
+			},
+		},
+		{
+			name: "type inference of non-finite numbers",
+			data: "a,b,c,d\nNaN,Inf,-infinity,1e400\n",
+			opts: []CSVOption{WithCSVTypeInference()},
+			expectedResults: []interface{}{
+				map[string]interface{}{"a": "NaN", "b": "Inf", "c": "-infinity", "d": "1e400"},
+			},
+		},
+		{
+			name: "type inference of leading zeros",
+			data: "zip,fips,zero,fraction,negative\n00123,-042,0,0.5,-0.25\n",
+			opts: []CSVOption{WithCSVTypeInference()},
+			expectedResults: []interface{}{
+				map[string]interface{}{"zip": "00123", "fips": "-042", "zero": 0, "fraction": 0.5, "negative": -0.25},
+			},
+		},
+		{
+			name: "wrong number of fields",
+			data: "id,name\n1,foo,extra\n",
+			err:  csv.ErrFieldCount,
+		},
+		{
+			name: "wrong number of columns",
+			data: "1,foo,extra\n",
+			opts: []CSVOption{WithCSVColumns("id", "name")},
+			err:  csv.ErrFieldCount,
+		},
+	} {
+		tcase := tcase
+
+		t.Run(tcase.name, func(t *testing.T) {
+			t.Parallel()
+
+			list := &structpb.ListValue{}
+
+			err := NewCSVDecoder(tcase.opts...)(strings.NewReader(tcase.data))(list)
+			if !errors.Is(err, tcase.err) {
+				t.Fatalf("expected error %v, got %v", tcase.err, err)
+			}
+
+			if tcase.err != nil {
+				return
+			}
+
+			expectedList, err := structpb.NewList(tcase.expectedResults)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if !proto.Equal(expectedList, list) {
+				t.Fatalf("unexpected list: %v", list)
+			}
+		})
+	}
+}
+
+func TestHTTPServiceStoreCSV(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		fmt.Fprint(w, "id,name\n1,foo\n2,bar\n")
+	}))
+	defer server.Close()
+
+	svc, err := NewService(context.Background())
+	if err != nil {
+		t.Fatalf("failed to create service: %v", err)
+	}
+
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodGet, server.URL, nil)
+	if err != nil {
+		t.Fatalf("failed to create request: %v", err)
+	}
+
+	writer := &mockListWriter{}
+
+	svc.HTTP.Client(server.Client()).Requests(NewHTTPRequest(req, WithWriters(writer)))
+
+	if err := svc.HTTP.Store(context.Background()); err != nil {
+		t.Fatalf("failed to store: %v", err)
+	}
+
+	assertSocketWrites(t, []ListWriter{writer}, [][]byte{
+		[]byte(`[{"id":"1","name":"foo"},{"id":"2","name":"bar"}]`),
+	})
+}
@@ -0,0 +1,362 @@
+// Copyright 2023 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+
+package gidari
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	structpb "google.golang.org/protobuf/types/known/structpb"
+)
+
+// DeadLetter is data that the services could not store, together with the
+// error and a description of its source.
+type DeadLetter struct {
+	// Err is the error that prevented the data from being stored.
+	Err error
+
+	// Meta describes the source of the data. For HTTP responses,
+	// "Meta.Request" is the request that produced the response.
+	Meta ListMeta
+
+	// List is the list that one or more of the writers failed to write. It
+	// is nil if the data could not be decoded.
+	List *structpb.ListValue
+
+	// Body is the body of a response or the socket message that could not be
+	// decoded, or the body of a response whose status code is not 200. It is
+	// nil if the data was decoded but could not be written.
+	Body []byte
+}
+
+// DeadLetterSink receives the data that the services could not store. A sink
+// must be safe for concurrent use, since sockets are read concurrently. If a
+// sink implements Flusher or Closer, then it is flushed and closed when the
+// services finish storing data, in the same way as the writers.
+type DeadLetterSink interface {
+	WriteDeadLetter(ctx context.Context, letter *DeadLetter) error
+}
+
+// WithDeadLetterSink will send the data that can not be stored to the sink,
+// rather than failing. This includes lists that a writer fails to write,
+// response bodies and socket messages that can not be decoded, and responses
+// whose status code is not 200. The remaining requests and messages continue
+// to be stored, and the services only fail if the sink itself fails.
+//
+// Note that response bodies are held in memory while they are decoded, so
+// that the whole body can be sent to the sink if decoding fails. If a body
+// fails to decode part way through, the lists decoded before the failure have
+// already been written.
+func WithDeadLetterSink(sink DeadLetterSink) ServiceOption {
+	return func(svc *Service) {
+		svc.deadLetters = sink
+	}
+}
+
+// record will return the dead letter as a record, with the source of the data
+// as fields alongside the error. The failed list is in the "records" field,
+// and the body is in the "body" field as a string, or in the "body_base64"
+// field if it is not valid UTF-8.
+func (letter *DeadLetter) record() (*structpb.Struct, error) {
+	fields := make(map[string]any)
+
+	if letter.Err != nil {
+		fields["error"] = letter.Err.Error()
+	}
+
+	meta := letter.Meta
+	if req := meta.Request; req != nil {
+		fields["method"] = req.Method
+		fields["url"] = req.URL.String()
+	}
+
+	for name, val := range map[string]int{
+		"status_code": meta.StatusCode,
+		"page":        meta.Page,
+		"message":     meta.Message,
+	} {
+		if val != 0 {
+			fields[name] = val
+		}
+	}
+
+	if meta.SocketID != "" {
+		fields["socket_id"] = meta.SocketID
+	}
+
+	if !meta.ReceivedAt.IsZero() {
+		fields["received_at"] = meta.ReceivedAt.UTC().Format(time.RFC3339Nano)
+	}
+
+	if letter.List != nil {
+		fields["batch"] = meta.Batch
+	}
+
+	if letter.Body != nil {
+		if utf8.Valid(letter.Body) {
+			fields["body"] = string(letter.Body)
+		} else {
+			// The value of a byte slice is base64 encoded.
+			fields["body_base64"] = letter.Body
+		}
+	}
+
+	record, err := structpb.NewStruct(fields)
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert dead letter: %w", err)
+	}
+
+	if letter.List != nil {
+		record.Fields["records"] = structpb.NewListValue(letter.List)
+	}
+
+	return record, nil
+}
+
+// marshalJSON will encode the dead letter record as JSON.
+func (letter *DeadLetter) marshalJSON() ([]byte, error) {
+	record, err := letter.record()
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := json.Marshal(record.AsMap())
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal dead letter: %w", err)
+	}
+
+	return data, nil
+}
+
+// deadLetterWriter is a DeadLetterSink that writes the dead letters to a list
+// writer.
+type deadLetterWriter struct {
+	writer ListWriter
+}
+
+// NewDeadLetterWriter will create a sink that writes each dead letter to the
+// writer as a list with a single record. The record has the error in the
+// "error" field, the source of the data in fields such as "url" and
+// "status_code", the failed list in the "records" field, and the undecoded
+// body in the "body" field. The writer may also be a writer of the requests,
+// in which case it is still flushed and closed once, after the last dead
+// letter is written.
+func NewDeadLetterWriter(writer ListWriter) DeadLetterSink {
+	return &deadLetterWriter{writer: writer}
+}
+
+// WriteDeadLetter will write the dead letter to the writer.
+func (sink *deadLetterWriter) WriteDeadLetter(ctx context.Context, letter *DeadLetter) error {
+	record, err := letter.record()
+	if err != nil {
+		return err
+	}
+
+	list := &structpb.ListValue{Values: []*structpb.Value{structpb.NewStructValue(record)}}
+
+	if metaWriter, ok := sink.writer.(MetaListWriter); ok {
+		meta := letter.Meta
+
+		return metaWriter.WriteWithMeta(ctx, list, &meta)
+	}
+
+	return sink.writer.Write(ctx, list)
+}
+
+// Flush will flush the writer, if it is a Flusher.
+func (sink *deadLetterWriter) Flush() error {
+	if flusher, ok := sink.writer.(Flusher); ok {
+		return flusher.Flush()
+	}
+
+	return nil
+}
+
+// Close will close the writer, if it is a Closer.
+func (sink *deadLetterWriter) Close() error {
+	if closer, ok := sink.writer.(Closer); ok {
+		return closer.Close()
+	}
+
+	return nil
+}
+
+// deadLetterFile is a DeadLetterSink that appends the dead letters to a file.
+type deadLetterFile struct {
+	path string
+
+	mu   sync.Mutex
+	file *os.File
+}
+
+// NewDeadLetterFile will create a sink that appends each dead letter to the
+// file as a line of JSON, in the format described by "NewDeadLetterWriter".
+// The file is created if it does not exist, and it is opened when the first
+// dead letter is written.
+func NewDeadLetterFile(path string) DeadLetterSink {
+	return &deadLetterFile{path: path}
+}
+
+// WriteDeadLetter will append the dead letter to the file.
+func (sink *deadLetterFile) WriteDeadLetter(_ context.Context, letter *DeadLetter) error {
+	data, err := letter.marshalJSON()
+	if err != nil {
+		return err
+	}
+
+	sink.mu.Lock()
+	defer sink.mu.Unlock()
+
+	if sink.file == nil {
+		file, err := os.OpenFile(sink.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644) //nolint:gosec
+		if err != nil {
+			return fmt.Errorf("failed to open dead letter file: %w", err)
+		}
+
+		sink.file = file
+	}
+
+	if _, err := sink.file.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("failed to write dead letter: %w", err)
+	}
+
+	return nil
+}
+
+// Close will close the file. The file is opened again if another dead letter
+// is written.
+func (sink *deadLetterFile) Close() error {
+	sink.mu.Lock()
+	defer sink.mu.Unlock()
+
+	if sink.file == nil {
+		return nil
+	}
+
+	err := sink.file.Close()
+	sink.file = nil
+
+	if err != nil {
+		return fmt.Errorf("failed to close dead letter file: %w", err)
+	}
+
+	return nil
+}
+
+// deadLetterDir is a DeadLetterSink that writes each dead letter to its own
+// file in a directory.
+type deadLetterDir struct {
+	dir string
+
+	mu  sync.Mutex
+	seq int
+}
+
+// NewDeadLetterDir will create a sink that writes each dead letter to a new
+// JSON file in the directory, in the format described by
+// "NewDeadLetterWriter". The files are named by the time the dead letter is
+// written and a sequence number, so that they sort in the order written. The
+// directory is created if it does not exist.
+func NewDeadLetterDir(dir string) DeadLetterSink {
+	return &deadLetterDir{dir: dir}
+}
+
+// WriteDeadLetter will write the dead letter to a new file in the directory.
+func (sink *deadLetterDir) WriteDeadLetter(_ context.Context, letter *DeadLetter) error {
+	data, err := letter.marshalJSON()
+	if err != nil {
+		return err
+	}
+
+	sink.mu.Lock()
+	sink.seq++
+	seq := sink.seq
+	sink.mu.Unlock()
+
+	if err := os.MkdirAll(sink.dir, 0o755); err != nil { //nolint:gosec
+		return fmt.Errorf("failed to create dead letter directory: %w", err)
+	}
+
+	name := fmt.Sprintf("%s-%06d.json", time.Now().UTC().Format("20060102T150405.000000000Z"), seq)
+
+	if err := os.WriteFile(filepath.Join(sink.dir, name), append(data, '\n'), 0o644); err != nil { //nolint:gosec
+		return fmt.Errorf("failed to write dead letter: %w", err)
+	}
+
+	return nil
+}
+
+// recordedBody is a response body that records the data read from it, so that
+// a body that can not be decoded can be sent to the dead-letter sink.
+type recordedBody struct {
+	io.ReadCloser
+
+	buf *bytes.Buffer
+}
+
+// recordBody will replace the response body with one that records the data
+// read from it into the returned buffer.
+func recordBody(rsp *http.Response) *bytes.Buffer {
+	buf := &bytes.Buffer{}
+
+	if rsp.Body != nil {
+		rsp.Body = &recordedBody{ReadCloser: rsp.Body, buf: buf}
+	}
+
+	return buf
+}
+
+// Read will read from the body, recording the data read.
+func (body *recordedBody) Read(p []byte) (int, error) {
+	n, err := body.ReadCloser.Read(p)
+	body.buf.Write(p[:n])
+
+	return n, err //nolint:wrapcheck
+}
+
+// Close will record the rest of the body, which the decoder may not have read
+// if it failed, and then close the body.
+func (body *recordedBody) Close() error {
+	_, _ = io.Copy(io.Discard, body)
+
+	return body.ReadCloser.Close() //nolint:wrapcheck
+}
+
+// failedListWriterJob will create a job that fails with the error, so that the
+// current response is sent to the dead-letter sink by the list writer.
+func failedListWriterJob(current *Current, err error) *listWriterJob {
+	return &listWriterJob{
+		meta: newListMeta(current),
+		decFunc: func(func(*structpb.ListValue) error) error {
+			return err
+		},
+	}
+}
+
+// writeDeadLetter will send the data that the job failed to store to the job's
+// dead-letter sink. If the sink fails, then the returned error wraps both the
+// sink's error and the error of the dead letter.
+func (job *listWriterJob) writeDeadLetter(ctx context.Context, letter *DeadLetter) error {
+	if err := job.deadLetters.WriteDeadLetter(ctx, letter); err != nil {
+		return joinErrors(letter.Err, fmt.Errorf("failed to write dead letter: %w", err))
+	}
+
+	job.tracker.addDeadLetter()
+
+	return nil
+}
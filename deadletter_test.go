@@ -0,0 +1,391 @@
+// Copyright 2023 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+
+package gidari
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	structpb "google.golang.org/protobuf/types/known/structpb"
+)
+
+var errRejected = fmt.Errorf("rejected")
+
+// rejectWriter is a ListWriter that fails to write lists with a "reject" field,
+// and counts the records written otherwise.
+type rejectWriter struct {
+	mu    sync.Mutex
+	count int
+}
+
+func (w *rejectWriter) Write(_ context.Context, list *structpb.ListValue) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	for _, val := range list.GetValues() {
+		if _, ok := val.GetStructValue().GetFields()["reject"]; ok {
+			return errRejected
+		}
+	}
+
+	w.count += len(list.GetValues())
+
+	return nil
+}
+
+// mockDeadLetterSink is a DeadLetterSink that collects the dead letters.
+type mockDeadLetterSink struct {
+	mu      sync.Mutex
+	letters []*DeadLetter
+	closes  int
+	err     error
+}
+
+func (sink *mockDeadLetterSink) WriteDeadLetter(_ context.Context, letter *DeadLetter) error {
+	sink.mu.Lock()
+	defer sink.mu.Unlock()
+
+	sink.letters = append(sink.letters, letter)
+
+	return sink.err
+}
+
+func (sink *mockDeadLetterSink) Close() error {
+	sink.closes++
+
+	return nil
+}
+
+// deadLetterServer will serve a successful, a failing, an undecodable and an
+// unsupported response, and a response with a record that is rejected by the
+// rejectWriter.
+func deadLetterServer() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/bad":
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusInternalServerError)
+			fmt.Fprint(w, `{"error":"oops"}`)
+		case "/undecodable":
+			w.Header().Set("Content-Type", "application/json")
+			fmt.Fprint(w, `[{"id":1},{"id":`)
+		case "/unsupported":
+			w.Header().Set("Content-Type", "image/png")
+			fmt.Fprint(w, "\x89PNG")
+		case "/reject":
+			w.Header().Set("Content-Type", "application/json")
+			fmt.Fprint(w, `[{"id":1},{"reject":true},{"id":3}]`)
+		default:
+			w.Header().Set("Content-Type", "application/json")
+			fmt.Fprint(w, `[{"id":1},{"id":2}]`)
+		}
+	}))
+}
+
+func TestHTTPServiceStoreDeadLetters(t *testing.T) {
+	t.Parallel()
+
+	server := deadLetterServer()
+	defer server.Close()
+
+	sink := &mockDeadLetterSink{}
+
+	svc, err := NewService(context.Background(), WithDeadLetterSink(sink))
+	if err != nil {
+		t.Fatalf("failed to create service: %v", err)
+	}
+
+	writer := &rejectWriter{}
+
+	var reqs []*Request
+
+	for _, path := range []string{"/ok", "/bad", "/undecodable", "/unsupported", "/reject"} {
+		req, err := http.NewRequestWithContext(context.Background(), http.MethodGet, server.URL+path, nil)
+		if err != nil {
+			t.Fatalf("failed to create request: %v", err)
+		}
+
+		reqs = append(reqs, NewHTTPRequest(req, WithWriters(writer), WithBatchSize(1)))
+	}
+
+	if err := svc.HTTP.Client(server.Client()).Requests(reqs...).Store(context.Background()); err != nil {
+		t.Fatalf("failed to store: %v", err)
+	}
+
+	// The records before the failures are written.
+	if writer.count != 5 {
+		t.Fatalf("expected 5 records, got %d", writer.count)
+	}
+
+	if sink.closes != 1 {
+		t.Fatalf("expected the sink to be closed once, got %d", sink.closes)
+	}
+
+	letters := make(map[string]*DeadLetter)
+	for _, letter := range sink.letters {
+		letters[letter.Meta.Request.URL.Path] = letter
+	}
+
+	for _, tcase := range []struct {
+		path string
+		err  error
+		body string
+		list string
+	}{
+		{path: "/bad", err: ErrBadResponse, body: `{"error":"oops"}`},
+		{path: "/undecodable", body: `[{"id":1},{"id":`},
+		{path: "/unsupported", err: ErrUnsupportedDecodeType, body: "\x89PNG"},
+		{path: "/reject", err: errRejected, list: `[{"reject":true}]`},
+	} {
+		letter, ok := letters[tcase.path]
+		if !ok {
+			t.Fatalf("%s: expected a dead letter, got %d letters", tcase.path, len(sink.letters))
+		}
+
+		if letter.Err == nil || (tcase.err != nil && !errors.Is(letter.Err, tcase.err)) {
+			t.Fatalf("%s: expected error %v, got %v", tcase.path, tcase.err, letter.Err)
+		}
+
+		if string(letter.Body) != tcase.body {
+			t.Fatalf("%s: body = %q, want %q", tcase.path, letter.Body, tcase.body)
+		}
+
+		var list string
+
+		if letter.List != nil {
+			data, _ := json.Marshal(letter.List.AsSlice())
+			list = string(data)
+		}
+
+		if list != tcase.list {
+			t.Fatalf("%s: list = %s, want %s", tcase.path, list, tcase.list)
+		}
+	}
+
+	if len(sink.letters) != 4 {
+		t.Fatalf("expected 4 dead letters, got %d", len(sink.letters))
+	}
+
+	if letter := letters["/reject"]; letter.Meta.Batch != 1 || letter.Meta.StatusCode != http.StatusOK {
+		t.Fatalf("batch, status = %d, %d, want 1, 200", letter.Meta.Batch, letter.Meta.StatusCode)
+	}
+}
+
+func TestHTTPServiceStoreDeadLetterSinkError(t *testing.T) {
+	t.Parallel()
+
+	server := deadLetterServer()
+	defer server.Close()
+
+	errSink := fmt.Errorf("sink error")
+
+	svc, err := NewService(context.Background(), WithDeadLetterSink(&mockDeadLetterSink{err: errSink}))
+	if err != nil {
+		t.Fatalf("failed to create service: %v", err)
+	}
+
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodGet, server.URL+"/bad", nil)
+	if err != nil {
+		t.Fatalf("failed to create request: %v", err)
+	}
+
+	err = svc.HTTP.Client(server.Client()).Requests(NewHTTPRequest(req)).Store(context.Background())
+	if !errors.Is(err, errSink) || !errors.Is(err, ErrBadResponse) {
+		t.Fatalf("expected errors %v and %v, got %v", errSink, ErrBadResponse, err)
+	}
+}
+
+func TestHTTPServiceStoreDeadLetterWriterShared(t *testing.T) {
+	t.Parallel()
+
+	server := deadLetterServer()
+	defer server.Close()
+
+	// The writer is both a request writer and the sink's writer.
+	shared := &mockFlushCloseWriter{}
+
+	svc, err := NewService(context.Background(), WithDeadLetterSink(NewDeadLetterWriter(shared)))
+	if err != nil {
+		t.Fatalf("failed to create service: %v", err)
+	}
+
+	var reqs []*Request
+
+	for _, path := range []string{"/ok", "/bad"} {
+		req, err := http.NewRequestWithContext(context.Background(), http.MethodGet, server.URL+path, nil)
+		if err != nil {
+			t.Fatalf("failed to create request: %v", err)
+		}
+
+		reqs = append(reqs, NewHTTPRequest(req, WithWriters(shared)))
+	}
+
+	if err := svc.HTTP.Client(server.Client()).Requests(reqs...).Store(context.Background()); err != nil {
+		t.Fatalf("failed to store: %v", err)
+	}
+
+	if shared.count != 2 || shared.written != shared.count {
+		t.Fatalf("count, written = %d, %d, want 2, 2", shared.count, shared.written)
+	}
+
+	if shared.flushes != 1 || shared.closes != 1 {
+		t.Fatalf("flushes, closes = %d, %d, want 1, 1", shared.flushes, shared.closes)
+	}
+}
+
+func TestSocketStoreDeadLetters(t *testing.T) {
+	t.Parallel()
+
+	sink := &mockDeadLetterSink{}
+
+	svc, err := NewService(context.Background(), WithDeadLetterSink(sink))
+	if err != nil {
+		t.Fatalf("failed to create service: %v", err)
+	}
+
+	writer := &rejectWriter{}
+
+	conn := &mockConn{readData: [][]byte{
+		[]byte(`[{"reject":true}]`),
+		[]byte(`[1,]`),
+		[]byte(`[{"id":1}]`),
+	}}
+
+	err = svc.Socket.Connections(NewSocket(conn, WithSocketWriters(writer), WithSocketID("a"))).
+		Store(context.Background())
+	if err != nil {
+		t.Fatalf("failed to store: %v", err)
+	}
+
+	if writer.count != 1 {
+		t.Fatalf("expected 1 record, got %d", writer.count)
+	}
+
+	if len(sink.letters) != 2 {
+		t.Fatalf("expected 2 dead letters, got %d", len(sink.letters))
+	}
+
+	if letter := sink.letters[0]; !errors.Is(letter.Err, errRejected) || letter.Meta.Message != 1 {
+		t.Fatalf("unexpected dead letter: %+v", letter)
+	}
+
+	if letter := sink.letters[1]; string(letter.Body) != `[1,]` || letter.Meta.SocketID != "a" {
+		t.Fatalf("unexpected dead letter: %+v", letter)
+	}
+}
+
+func TestDeadLetterSinks(t *testing.T) {
+	t.Parallel()
+
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodGet, "http://example.com/items", nil)
+	if err != nil {
+		t.Fatalf("failed to create request: %v", err)
+	}
+
+	list, err := structpb.NewList([]any{map[string]any{"id": 1}})
+	if err != nil {
+		t.Fatalf("failed to create list: %v", err)
+	}
+
+	letters := []*DeadLetter{
+		{
+			Err:  errRejected,
+			Meta: ListMeta{Request: req, StatusCode: http.StatusOK, Page: 1, Batch: 2},
+			List: list,
+		},
+		{
+			Err:  ErrUnsupportedDecodeType,
+			Meta: ListMeta{SocketID: "a", Message: 3},
+			Body: []byte{0xff},
+		},
+	}
+
+	want := []string{
+		`{"batch":2,"error":"rejected","method":"GET","page":1,"records":[{"id":1}],` +
+			`"status_code":200,"url":"http://example.com/items"}`,
+		`{"body_base64":"/w==","error":"unsupported decode type","message":3,"socket_id":"a"}`,
+	}
+
+	dir := t.TempDir()
+	writer := &mockListWriter{}
+
+	for _, tcase := range []struct {
+		name string
+		sink DeadLetterSink
+		read func() []string
+	}{
+		{
+			name: "file",
+			sink: NewDeadLetterFile(filepath.Join(dir, "letters.ndjson")),
+			read: func() []string {
+				data, _ := os.ReadFile(filepath.Join(dir, "letters.ndjson"))
+
+				return strings.Split(strings.TrimSpace(string(data)), "\n")
+			},
+		},
+		{
+			name: "dir",
+			sink: NewDeadLetterDir(filepath.Join(dir, "letters")),
+			read: func() []string {
+				paths, _ := filepath.Glob(filepath.Join(dir, "letters", "*.json"))
+				sort.Strings(paths)
+
+				var lines []string
+
+				for _, path := range paths {
+					data, _ := os.ReadFile(path)
+					lines = append(lines, strings.TrimSpace(string(data)))
+				}
+
+				return lines
+			},
+		},
+		{
+			name: "writer",
+			sink: NewDeadLetterWriter(writer),
+			read: func() []string {
+				var lines []string
+
+				for _, data := range writer.data {
+					var records []any
+					_ = json.Unmarshal(data, &records)
+
+					line, _ := json.Marshal(records[0])
+					lines = append(lines, string(line))
+				}
+
+				return lines
+			},
+		},
+	} {
+		for _, letter := range letters {
+			if err := tcase.sink.WriteDeadLetter(context.Background(), letter); err != nil {
+				t.Fatalf("%s: failed to write dead letter: %v", tcase.name, err)
+			}
+		}
+
+		if err := finishWriters(nil, tcase.sink); err != nil {
+			t.Fatalf("%s: failed to finish sink: %v", tcase.name, err)
+		}
+
+		if got := tcase.read(); fmt.Sprint(got) != fmt.Sprint(want) {
+			t.Fatalf("%s: dead letters = %v, want %v", tcase.name, got, want)
+		}
+	}
+}
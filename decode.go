@@ -9,12 +9,16 @@
 package gidari
 
 import (
-	"bytes"
+	"bufio"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"mime"
 	"net/http"
 	"regexp"
 	"strings"
+	"sync"
 
 	structpb "google.golang.org/protobuf/types/known/structpb"
 )
@@ -27,10 +31,15 @@ var ErrUnsupportedDecodeType = fmt.Errorf("unsupported decode type")
 // supported.
 var ErrUnsupportedProtobufType = fmt.Errorf("unsupported proto type")
 
-// ErrBadResponse is returned when a response's status code is not 200 or 'OK'.
+// ErrBadResponse is returned when a response's status code is not a success
+// according to the status policy, which by default is only 200 or 'OK'. See
+// StatusError.
 var ErrBadResponse = fmt.Errorf("response status code not OK")
 
 // DecodeType is an enum that represents the type of data that is being decoded.
+//
+// Deprecated: Responses are decoded by the decoder registered for their
+// content type in the DecoderRegistry. DecodeType is not used.
 type DecodeType int32
 
 const (
@@ -41,39 +50,276 @@ const (
 	DecodeTypeJSON
 )
 
-func addValue(list *structpb.ListValue, val *structpb.Value) error {
-	switch val.Kind.(type) {
-	case *structpb.Value_StructValue:
+// addValue will add the value to the list, flattening a list into its
+// elements. Elements that are not objects are added as lists of one element, so
+// that the scalar policy can tell them apart from top-level values that are not
+// objects.
+func addValue(list *structpb.ListValue, val *structpb.Value) {
+	vals := val.GetListValue()
+	if vals == nil {
 		list.Values = append(list.Values, val)
-	case *structpb.Value_ListValue:
-		list.Values = append(list.Values, val.GetListValue().Values...)
-	default:
-		return fmt.Errorf("%w: %T", ErrUnsupportedProtobufType, val.Kind)
+
+		return
 	}
 
-	return nil
+	for _, elem := range vals.Values {
+		if elem.GetStructValue() == nil {
+			elem = structpb.NewListValue(&structpb.ListValue{Values: []*structpb.Value{elem}})
+		}
+
+		list.Values = append(list.Values, elem)
+	}
 }
 
 // DecodeFunc is a function that will decode the results of a request into a
 // the target.
 type DecodeFunc func(list *structpb.ListValue) error
 
-func decodeFuncJSON(rsp *http.Response) DecodeFunc {
-	return func(list *structpb.ListValue) error {
-		defer func() {
-			if err := rsp.Body.Close(); err != nil {
-				panic(err)
-			}
-		}()
+// DecoderFactory returns a DecodeFunc that decodes the data read from r.
+type DecoderFactory func(r io.Reader) DecodeFunc
 
-		// Check to see if the response is empty. If it is, then we can
-		// just return nil.
-		if rsp.ContentLength == 0 {
-			return nil
+// StreamDecodeFunc is a function that will decode the results of a request in
+// chunks, calling flush with each chunk as it is decoded. Chunks may be of any
+// size, they are batched before they are passed to the list writers.
+type StreamDecodeFunc func(flush func(list *structpb.ListValue) error) error
+
+// StreamDecoderFactory returns a StreamDecodeFunc that decodes the data read
+// from r.
+type StreamDecoderFactory func(r io.Reader) StreamDecodeFunc
+
+// defaultChunkSize is the maximum number of values that are passed to the list
+// writers at once for responses that can only be decoded by a streaming
+// decoder, if no batch size is set.
+const defaultChunkSize = 1000
+
+// streamDecodeFunc will adapt the DecodeFunc into a StreamDecodeFunc that
+// flushes all of the decoded values as a single chunk.
+func streamDecodeFunc(decFunc DecodeFunc) StreamDecodeFunc {
+	return func(flush func(list *structpb.ListValue) error) error {
+		list := &structpb.ListValue{}
+		if err := decFunc(list); err != nil {
+			return err
+		}
+
+		return flush(list)
+	}
+}
+
+// decoder is a registered decoder, which is either a DecoderFactory or a
+// StreamDecoderFactory.
+type decoder struct {
+	factory DecoderFactory
+	stream  StreamDecoderFactory
+}
+
+// decoderFactory will return the decoder as a DecoderFactory, collecting the
+// chunks of a streaming decoder into the list.
+func (dec decoder) decoderFactory() DecoderFactory {
+	if dec.factory != nil {
+		return dec.factory
+	}
+
+	return func(r io.Reader) DecodeFunc {
+		return func(list *structpb.ListValue) error {
+			return dec.stream(r)(func(chunk *structpb.ListValue) error {
+				list.Values = append(list.Values, chunk.Values...)
+
+				return nil
+			})
+		}
+	}
+}
+
+// streamDecodeFunc will return the StreamDecodeFunc for the data read from r
+// and the batch size for its chunks. A decoder that has both forms only
+// streams if a batch size is set. A decoder that can only stream is batched by
+// the default chunk size if no batch size is set.
+func (dec decoder) streamDecodeFunc(r io.Reader, batch batchSize) (StreamDecodeFunc, batchSize) {
+	switch {
+	case dec.stream == nil:
+		return streamDecodeFunc(dec.factory(r)), batch
+	case dec.factory == nil && batch.isZero():
+		return dec.stream(r), batchSize{values: defaultChunkSize}
+	case dec.factory == nil || !batch.isZero():
+		return dec.stream(r), batch
+	default:
+		return streamDecodeFunc(dec.factory(r)), batch
+	}
+}
+
+// defaultMediaType is the media type used to decode responses that do not
+// have a "Content-Type" header.
+const defaultMediaType = "application/json"
+
+// DecoderRegistry is a set of decoder factories keyed by media type. The HTTP
+// Service uses the registry to decode a response according to its
+// "Content-Type" header.
+//
+// A media type may be registered as:
+//
+//   - a full media type, e.g. "application/json"
+//   - a structured syntax suffix, e.g. "+json", which matches any media type
+//     with that suffix such as "application/vnd.api+json"
+//   - a wildcard subtype, e.g. "text/*"
+//
+// Lookups prefer full media types, then suffixes and finally wildcards.
+type DecoderRegistry struct {
+	mu       sync.RWMutex
+	decoders map[string]decoder
+}
+
+// NewDecoderRegistry will return a registry with the built-in decoders. The
+// built-in decoders cover "application/json", the "+json" suffix, "text/csv"
+// with a header row, and "application/xml", "text/xml" and the "+xml" suffix
+// with the root element as the only record. Newline-delimited JSON, e.g.
+// "application/x-ndjson", is decoded in chunks.
+func NewDecoderRegistry() *DecoderRegistry {
+	reg := &DecoderRegistry{decoders: make(map[string]decoder)}
+
+	reg.register("application/json", decoder{factory: decodeFuncJSON, stream: decodeFuncJSONStream})
+	reg.register("+json", decoder{factory: decodeFuncJSON, stream: decodeFuncJSONStream})
+	reg.Register("text/csv", NewCSVDecoder())
+	reg.Register("application/xml", NewXMLDecoder())
+	reg.Register("text/xml", NewXMLDecoder())
+	reg.Register("+xml", NewXMLDecoder())
+
+	for _, mediaType := range ndjsonMediaTypes {
+		reg.RegisterStream(mediaType, decodeFuncNDJSON)
+	}
+
+	return reg
+}
+
+func (reg *DecoderRegistry) register(mediaType string, dec decoder) *DecoderRegistry {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+
+	reg.decoders[strings.ToLower(mediaType)] = dec
+
+	return reg
+}
+
+// Register will register the decoder factory for the media type, replacing any
+// existing factory for the same media type.
+func (reg *DecoderRegistry) Register(mediaType string, factory DecoderFactory) *DecoderRegistry {
+	return reg.register(mediaType, decoder{factory: factory})
+}
+
+// RegisterStream will register the streaming decoder factory for the media
+// type, replacing any existing factory for the same media type. Streaming
+// decoders pass the decoded values to the list writers in chunks, rather than
+// holding the entire response in memory.
+func (reg *DecoderRegistry) RegisterStream(mediaType string, factory StreamDecoderFactory) *DecoderRegistry {
+	return reg.register(mediaType, decoder{stream: factory})
+}
+
+// Lookup will return the decoder factory for the given content type, which
+// may include parameters such as "charset". Streaming decoders are returned
+// as a decoder factory that collects all chunks into the list.
+func (reg *DecoderRegistry) Lookup(contentType string) (DecoderFactory, bool) {
+	dec, ok := reg.lookup(contentType)
+	if !ok {
+		return nil, false
+	}
+
+	return dec.decoderFactory(), true
+}
+
+func (reg *DecoderRegistry) lookup(contentType string) (decoder, bool) {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return decoder{}, false
+	}
+
+	reg.mu.RLock()
+	defer reg.mu.RUnlock()
+
+	if dec, ok := reg.decoders[mediaType]; ok {
+		return dec, true
+	}
+
+	if idx := strings.LastIndex(mediaType, "+"); idx >= 0 {
+		if dec, ok := reg.decoders[mediaType[idx:]]; ok {
+			return dec, true
 		}
+	}
 
+	if typ, _, ok := strings.Cut(mediaType, "/"); ok {
+		if dec, ok := reg.decoders[typ+"/*"]; ok {
+			return dec, true
+		}
+	}
+
+	dec, ok := reg.decoders["*/*"]
+
+	return dec, ok
+}
+
+// decodeOptions are the request's options for decoding its responses.
+type decodeOptions struct {
+	// contentType overrides the "Content-Type" header of the response.
+	contentType string
+
+	batch    batchSize
+	selector *selector
+	scalars  *ScalarPolicy
+}
+
+// decodeFunc will return the StreamDecodeFunc for the response, which flushes
+// the selected values in lists bounded by the batch size. If the content type
+// is empty, then the response's "Content-Type" header is used. If the response
+// has no "Content-Type" header, then it is decoded as JSON. The returned
+// StreamDecodeFunc closes the response body.
+func (reg *DecoderRegistry) decodeFunc(rsp *http.Response, opts decodeOptions) (StreamDecodeFunc, error) {
+	if opts.selector != nil && opts.selector.err != nil {
+		discardResponse(rsp)
+
+		return nil, opts.selector.err
+	}
+
+	contentType := opts.contentType
+	if contentType == "" {
+		contentType = rsp.Header.Get("Content-Type")
+	}
+
+	if contentType == "" {
+		contentType = defaultMediaType
+	}
+
+	dec, ok := reg.lookup(contentType)
+	if !ok {
+		discardResponse(rsp)
+
+		return nil, fmt.Errorf("%w: %q", ErrUnsupportedDecodeType, contentType)
+	}
+
+	decFunc, batch := dec.streamDecodeFunc(rsp.Body, opts.batch)
+
+	return func(flush func(list *structpb.ListValue) error) error {
+		bat := newBatcher(batch, flush)
+
+		add := opts.scalars.apply(bat.add)
+		if opts.selector != nil {
+			add = opts.selector.apply(add)
+		}
+
+		err := decFunc(add)
+		if err == nil {
+			err = bat.close()
+		}
+
+		if closeErr := rsp.Body.Close(); closeErr != nil && err == nil {
+			err = fmt.Errorf("failed to close response body: %w", closeErr)
+		}
+
+		return err
+	}, nil
+}
+
+func decodeFuncJSON(r io.Reader) DecodeFunc {
+	return func(list *structpb.ListValue) error {
 		// Decode the response into a list of values.
-		dec := json.NewDecoder(rsp.Body)
+		dec := json.NewDecoder(r)
 
 		for dec.More() {
 			val := &structpb.Value{}
@@ -81,19 +327,55 @@ func decodeFuncJSON(rsp *http.Response) DecodeFunc {
 				return fmt.Errorf("failed to decode json: %w", err)
 			}
 
-			if err := addValue(list, val); err != nil {
-				return fmt.Errorf("failed to add value to list: %w", err)
-			}
+			addValue(list, val)
 		}
 
 		return nil
 	}
 }
 
-func decodeFuncJSONFromBytes(b []byte) DecodeFunc {
-	return func(list *structpb.ListValue) error {
-		// Decode the response into a list of values.
-		dec := json.NewDecoder(bytes.NewReader(b))
+// decodeFuncJSONStream will decode JSON data, flushing each element of a
+// top-level array as it is decoded. Any other top-level values are flushed
+// whole, in the same way as "decodeFuncJSON".
+func decodeFuncJSONStream(r io.Reader) StreamDecodeFunc {
+	return func(flush func(list *structpb.ListValue) error) error {
+		reader := bufio.NewReader(r)
+		dec := json.NewDecoder(reader)
+
+		first, err := peekNonSpace(reader)
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+
+		if err != nil {
+			return err
+		}
+
+		if first == '[' {
+			// Consume the opening bracket.
+			if _, err := dec.Token(); err != nil {
+				return fmt.Errorf("failed to decode json: %w", err)
+			}
+
+			for dec.More() {
+				val := &structpb.Value{}
+				if err := dec.Decode(val); err != nil {
+					return fmt.Errorf("failed to decode json: %w", err)
+				}
+
+				list := &structpb.ListValue{}
+				addValue(list, structpb.NewListValue(&structpb.ListValue{Values: []*structpb.Value{val}}))
+
+				if err := flush(list); err != nil {
+					return err
+				}
+			}
+
+			// Consume the closing bracket.
+			if _, err := dec.Token(); err != nil {
+				return fmt.Errorf("failed to decode json: %w", err)
+			}
+		}
 
 		for dec.More() {
 			val := &structpb.Value{}
@@ -101,8 +383,11 @@ func decodeFuncJSONFromBytes(b []byte) DecodeFunc {
 				return fmt.Errorf("failed to decode json: %w", err)
 			}
 
-			if err := addValue(list, val); err != nil {
-				return fmt.Errorf("failed to add value to list: %w", err)
+			list := &structpb.ListValue{}
+			addValue(list, val)
+
+			if err := flush(list); err != nil {
+				return err
 			}
 		}
 
@@ -110,6 +395,28 @@ func decodeFuncJSONFromBytes(b []byte) DecodeFunc {
 	}
 }
 
+// peekNonSpace will discard any leading whitespace from the reader and return
+// the next byte without consuming it.
+func peekNonSpace(reader *bufio.Reader) (byte, error) {
+	for {
+		char, err := reader.ReadByte()
+		if err != nil {
+			return 0, fmt.Errorf("failed to read: %w", err)
+		}
+
+		switch char {
+		case ' ', '\t', '\r', '\n':
+			continue
+		}
+
+		if err := reader.UnreadByte(); err != nil {
+			return 0, fmt.Errorf("failed to unread: %w", err)
+		}
+
+		return char, nil
+	}
+}
+
 func isPartialJSON(data []byte) bool {
 	if len(data) == 0 {
 		return true
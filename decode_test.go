@@ -10,10 +10,12 @@ package gidari
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"net/http/httptest"
 	"testing"
 
 	"google.golang.org/protobuf/proto"
@@ -26,18 +28,15 @@ func TestDecode(t *testing.T) {
 	for _, tcase := range []struct {
 		name            string
 		data            []byte
-		dataType        DecodeType
 		expectedResults []interface{}
 		err             error
 	}{
 		{
-			name:     "empty data",
-			dataType: DecodeTypeJSON,
+			name: "empty data",
 		},
 		{
-			name:     "json object",
-			data:     []byte(`{"foo": "bar"}`),
-			dataType: DecodeTypeJSON,
+			name: "json object",
+			data: []byte(`{"foo": "bar"}`),
 			expectedResults: []interface{}{
 				map[string]interface{}{
 					"foo": "bar",
@@ -45,9 +44,8 @@ func TestDecode(t *testing.T) {
 			},
 		},
 		{
-			name:     "json array",
-			data:     []byte(`[{"foo": "bar"}]`),
-			dataType: DecodeTypeJSON,
+			name: "json array",
+			data: []byte(`[{"foo": "bar"}]`),
 			expectedResults: []interface{}{
 				map[string]interface{}{
 					"foo": "bar",
@@ -55,9 +53,8 @@ func TestDecode(t *testing.T) {
 			},
 		},
 		{
-			name:     "json array with multiple objects",
-			data:     []byte(`[{"foo": "bar"}, {"foo": "baz"}]`),
-			dataType: DecodeTypeJSON,
+			name: "json array with multiple objects",
+			data: []byte(`[{"foo": "bar"}, {"foo": "baz"}]`),
 			expectedResults: []interface{}{
 				map[string]interface{}{
 					"foo": "bar",
@@ -73,19 +70,7 @@ func TestDecode(t *testing.T) {
 		t.Run(tcase.name, func(t *testing.T) {
 			t.Parallel()
 
-			var decFunc DecodeFunc
-
-			switch tcase.dataType {
-			case DecodeTypeJSON:
-				decFunc = decodeFuncJSON(&http.Response{
-					Body:          io.NopCloser(bytes.NewReader(tcase.data)),
-					ContentLength: int64(len(tcase.data)),
-				})
-			case DecodeTypeUnknown:
-				fallthrough
-			default:
-				t.Fatalf("unsupported decode type: %v", tcase.dataType)
-			}
+			decFunc := decodeFuncJSON(bytes.NewReader(tcase.data))
 
 			// Then we call the DecodeUpsertRequest function.
 			list := &structpb.ListValue{}
@@ -108,6 +93,238 @@ func TestDecode(t *testing.T) {
 	}
 }
 
+func TestDecodeFuncJSONStream(t *testing.T) {
+	t.Parallel()
+
+	for _, tcase := range []struct {
+		name string
+		data string
+
+		// flushes is the number of expected calls to flush.
+		flushes int
+		err     bool
+	}{
+		{
+			name: "empty data",
+			data: " \n",
+		},
+		{
+			name:    "json object",
+			data:    `{"foo": "bar"}`,
+			flushes: 1,
+		},
+		{
+			name:    "json array",
+			data:    ` [{"foo": "bar"}, {"foo": "baz"}, [1, 2]]`,
+			flushes: 3,
+		},
+		{
+			name:    "concatenated values",
+			data:    `[{"foo": "bar"}] {"foo": "baz"} [{"foo": "qux"}]`,
+			flushes: 3,
+		},
+		{
+			name: "malformed element",
+			data: `[{"foo": "bar"}, {"foo": ]`,
+			err:  true,
+		},
+	} {
+		tcase := tcase
+
+		t.Run(tcase.name, func(t *testing.T) {
+			t.Parallel()
+
+			var flushes int
+
+			list := &structpb.ListValue{}
+
+			err := decodeFuncJSONStream(bytes.NewBufferString(tcase.data))(func(chunk *structpb.ListValue) error {
+				flushes++
+				list.Values = append(list.Values, chunk.Values...)
+
+				return nil
+			})
+			if (err != nil) != tcase.err {
+				t.Fatalf("expected error %v, got %v", tcase.err, err)
+			}
+
+			if tcase.err {
+				return
+			}
+
+			if flushes != tcase.flushes {
+				t.Fatalf("expected %d flushes, got %d", tcase.flushes, flushes)
+			}
+
+			// The streamed values must match the values decoded whole.
+			expectedList := &structpb.ListValue{}
+			if err := decodeFuncJSON(bytes.NewBufferString(tcase.data))(expectedList); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if !proto.Equal(expectedList, list) {
+				t.Fatalf("unexpected list: %v", list)
+			}
+		})
+	}
+}
+
+func TestDecoderRegistryLookup(t *testing.T) {
+	t.Parallel()
+
+	// newFactory returns a factory that decodes into a single value
+	// identifying the factory.
+	newFactory := func(name string) DecoderFactory {
+		return func(io.Reader) DecodeFunc {
+			return func(list *structpb.ListValue) error {
+				list.Values = append(list.Values, structpb.NewStringValue(name))
+
+				return nil
+			}
+		}
+	}
+
+	reg := NewDecoderRegistry().
+		Register("text/csv", newFactory("csv")).
+		Register("text/*", newFactory("text")).
+		Register("+xml", newFactory("xml"))
+
+	for _, tcase := range []struct {
+		contentType string
+
+		// want is the name of the factory, or "json" for the built-in
+		// JSON decoder. If empty, then no factory is expected.
+		want string
+	}{
+		{contentType: "application/json", want: "json"},
+		{contentType: "application/json; charset=utf-8", want: "json"},
+		{contentType: "APPLICATION/JSON", want: "json"},
+		{contentType: "application/vnd.api+json", want: "json"},
+		{contentType: "application/problem+json", want: "json"},
+		{contentType: "text/csv", want: "csv"},
+		{contentType: "text/csv; header=present", want: "csv"},
+		{contentType: "text/plain", want: "text"},
+		{contentType: "application/atom+xml", want: "xml"},
+		{contentType: "application/x-ndjson", want: "json"},
+		{contentType: "application/octet-stream"},
+		{contentType: "not a media type"},
+	} {
+		tcase := tcase
+
+		t.Run(tcase.contentType, func(t *testing.T) {
+			t.Parallel()
+
+			factory, ok := reg.Lookup(tcase.contentType)
+			if ok != (tcase.want != "") {
+				t.Fatalf("Lookup(%q) ok = %v, want %v", tcase.contentType, ok, !ok)
+			}
+
+			if !ok {
+				return
+			}
+
+			data := []byte(`{"name":"json"}`)
+
+			list := &structpb.ListValue{}
+			if err := factory(bytes.NewReader(data))(list); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			var got string
+			if val := list.Values[0]; val.GetStructValue() != nil {
+				got = val.GetStructValue().Fields["name"].GetStringValue()
+			} else {
+				got = val.GetStringValue()
+			}
+
+			if got != tcase.want {
+				t.Fatalf("Lookup(%q) = %q decoder, want %q", tcase.contentType, got, tcase.want)
+			}
+		})
+	}
+}
+
+func TestHTTPServiceStoreContentType(t *testing.T) {
+	t.Parallel()
+
+	for _, tcase := range []struct {
+		name        string
+		contentType string
+		override    string
+		err         error
+	}{
+		{
+			name:        "json",
+			contentType: "application/json; charset=utf-8",
+		},
+		{
+			name:        "json suffix",
+			contentType: "application/vnd.api+json",
+		},
+		{
+			name: "no content type",
+		},
+		{
+			name:        "unsupported content type",
+			contentType: "text/html",
+			err:         ErrUnsupportedDecodeType,
+		},
+		{
+			name:        "override content type",
+			contentType: "text/html",
+			override:    "application/json",
+		},
+	} {
+		tcase := tcase
+
+		t.Run(tcase.name, func(t *testing.T) {
+			t.Parallel()
+
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				// Prevent the server from sniffing the
+				// content type.
+				w.Header()["Content-Type"] = nil
+				if tcase.contentType != "" {
+					w.Header().Set("Content-Type", tcase.contentType)
+				}
+
+				fmt.Fprint(w, `[{"x":1},{"x":2}]`)
+			}))
+			defer server.Close()
+
+			svc, err := NewService(context.Background())
+			if err != nil {
+				t.Fatalf("failed to create service: %v", err)
+			}
+
+			req, err := http.NewRequestWithContext(context.Background(), http.MethodGet, server.URL, nil)
+			if err != nil {
+				t.Fatalf("failed to create request: %v", err)
+			}
+
+			writer := &mockListWriter{}
+
+			var opts []RequestOption
+			if tcase.override != "" {
+				opts = append(opts, WithResponseContentType(tcase.override))
+			}
+
+			opts = append(opts, WithWriters(writer))
+
+			svc.HTTP.Client(server.Client()).Requests(NewHTTPRequest(req, opts...))
+
+			err = svc.HTTP.Store(context.Background())
+			if !errors.Is(err, tcase.err) {
+				t.Fatalf("expected error %v, got %v", tcase.err, err)
+			}
+
+			if tcase.err == nil && writer.count != 1 {
+				t.Fatalf("expected 1 write, got %d", writer.count)
+			}
+		})
+	}
+}
+
 func TestIsPartialJSON(t *testing.T) {
 	t.Parallel()
 
@@ -186,12 +403,7 @@ func BenchmarkDecodeUpsertRequest(b *testing.B) {
 
 	b.RunParallel(func(pb *testing.PB) {
 		for pb.Next() {
-			httpResp := &http.Response{
-				Body:          io.NopCloser(bytes.NewReader(data)),
-				ContentLength: int64(len(data)),
-			}
-
-			err := decodeFuncJSON(httpResp)(&structpb.ListValue{})
+			err := decodeFuncJSON(bytes.NewReader(data))(&structpb.ListValue{})
 			if err != nil {
 				b.Fatalf("unexpected error: %v", err)
 			}
@@ -0,0 +1,197 @@
+// Copyright 2023 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+
+package gidari
+
+import (
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+)
+
+// ErrUnsupportedContentEncoding is returned when the content encoding of a
+// response or socket message is not supported.
+var ErrUnsupportedContentEncoding = fmt.Errorf("unsupported content encoding")
+
+// acceptEncoding is the value of the "Accept-Encoding" header that advertises
+// the supported content encodings.
+const acceptEncoding = "gzip, deflate, br, zstd"
+
+// decompressor wraps the reader of compressed data, closing both the
+// decompressor and the underlying reader.
+type decompressor struct {
+	io.Reader
+
+	closers []io.Closer
+}
+
+func (dec *decompressor) Close() error {
+	var firstErr error
+
+	for _, closer := range dec.closers {
+		if err := closer.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	return firstErr
+}
+
+// isZlibHeader will check if the data starts with a zlib header. Some web APIs
+// send raw deflate data rather than the zlib format required for the "deflate"
+// content encoding.
+func isZlibHeader(header []byte) bool {
+	const (
+		deflateMethod = 8
+		checkBase     = 31
+	)
+
+	return len(header) == 2 && header[0]&0x0f == deflateMethod &&
+		(uint16(header[0])<<8|uint16(header[1]))%checkBase == 0
+}
+
+// newDecompressReader will wrap the reader in a decompressor for the coding.
+func newDecompressReader(rdr io.Reader, coding string) (io.Reader, io.Closer, error) {
+	switch coding {
+	case "gzip", "x-gzip":
+		zr, err := gzip.NewReader(rdr)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to read gzip header: %w", err)
+		}
+
+		return zr, zr, nil
+	case "deflate":
+		buffered := bufio.NewReader(rdr)
+
+		header, _ := buffered.Peek(2)
+		if !isZlibHeader(header) {
+			fr := flate.NewReader(buffered)
+
+			return fr, fr, nil
+		}
+
+		zr, err := zlib.NewReader(buffered)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to read zlib header: %w", err)
+		}
+
+		return zr, zr, nil
+	case "br":
+		return brotli.NewReader(rdr), nil, nil
+	case "zstd":
+		zr, err := zstd.NewReader(rdr)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to create zstd reader: %w", err)
+		}
+
+		return zr, zr.IOReadCloser(), nil
+	default:
+		return nil, nil, fmt.Errorf("%w: %q", ErrUnsupportedContentEncoding, coding)
+	}
+}
+
+// NewDecompressReader will return a reader that decompresses the data read from
+// rdr according to the content encoding, e.g. "gzip" or "gzip, br". The
+// supported codings are "gzip", "deflate", "br" and "zstd". Closing the
+// returned reader closes rdr if it is an io.Closer.
+func NewDecompressReader(rdr io.Reader, encoding string) (io.ReadCloser, error) {
+	dec := &decompressor{Reader: rdr}
+
+	if closer, ok := rdr.(io.Closer); ok {
+		dec.closers = append(dec.closers, closer)
+	}
+
+	codings := strings.Split(encoding, ",")
+
+	// Codings are listed in the order they were applied, so they are
+	// removed in reverse.
+	for idx := len(codings) - 1; idx >= 0; idx-- {
+		coding := strings.ToLower(strings.TrimSpace(codings[idx]))
+		if coding == "" || coding == "identity" {
+			continue
+		}
+
+		reader, closer, err := newDecompressReader(dec.Reader, coding)
+		if err != nil {
+			_ = dec.Close()
+
+			return nil, err
+		}
+
+		dec.Reader = reader
+
+		if closer != nil {
+			// Close the outermost decompressor first.
+			dec.closers = append([]io.Closer{closer}, dec.closers...)
+		}
+	}
+
+	return dec, nil
+}
+
+// decompressResponse will replace the body of the response with a decompressed
+// body according to the "Content-Encoding" header. As with the transparent
+// decompression in the "net/http" package, the "Content-Encoding" and
+// "Content-Length" headers are removed.
+func decompressResponse(rsp *http.Response) error {
+	encoding := rsp.Header.Get("Content-Encoding")
+	if encoding == "" || rsp.Body == nil {
+		return nil
+	}
+
+	body, err := NewDecompressReader(rsp.Body, encoding)
+	if err != nil {
+		discardResponse(rsp)
+
+		return fmt.Errorf("failed to decompress response: %w", err)
+	}
+
+	rsp.Body = body
+	rsp.Header.Del("Content-Encoding")
+	rsp.Header.Del("Content-Length")
+	rsp.ContentLength = -1
+	rsp.Uncompressed = true
+
+	return nil
+}
+
+// decompressBytes will decompress the data according to the content encoding.
+// If the data is truncated, then the returned error wraps io.ErrUnexpectedEOF.
+func decompressBytes(data []byte, encoding string) ([]byte, error) {
+	reader, err := NewDecompressReader(bytes.NewReader(data), encoding)
+	if err != nil {
+		return nil, err
+	}
+
+	defer reader.Close()
+
+	out, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress: %w", err)
+	}
+
+	return out, nil
+}
+
+// WithSocketContentEncoding will decompress each message read from the socket
+// according to the content encoding, e.g. "gzip". See "NewDecompressReader"
+// for the supported codings.
+func WithSocketContentEncoding(encoding string) SocketOption {
+	return func(soc *Socket) {
+		soc.encoding = encoding
+	}
+}
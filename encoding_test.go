@@ -0,0 +1,239 @@
+// Copyright 2023 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+
+package gidari
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+)
+
+// compress will compress the data with the codings in the given order.
+func compress(t *testing.T, data []byte, codings ...string) []byte {
+	t.Helper()
+
+	for _, coding := range codings {
+		buf := &bytes.Buffer{}
+
+		var writer io.WriteCloser
+
+		switch coding {
+		case "gzip":
+			writer = gzip.NewWriter(buf)
+		case "deflate":
+			writer = zlib.NewWriter(buf)
+		case "raw-deflate":
+			writer, _ = flate.NewWriter(buf, flate.DefaultCompression)
+		case "br":
+			writer = brotli.NewWriter(buf)
+		case "zstd":
+			var err error
+			if writer, err = zstd.NewWriter(buf); err != nil {
+				t.Fatalf("failed to create zstd writer: %v", err)
+			}
+		default:
+			t.Fatalf("unknown coding %q", coding)
+		}
+
+		if _, err := writer.Write(data); err != nil {
+			t.Fatalf("failed to compress: %v", err)
+		}
+
+		if err := writer.Close(); err != nil {
+			t.Fatalf("failed to compress: %v", err)
+		}
+
+		data = buf.Bytes()
+	}
+
+	return data
+}
+
+func TestNewDecompressReader(t *testing.T) {
+	t.Parallel()
+
+	data := []byte(`[{"x":1},{"x":2}]`)
+
+	for _, tcase := range []struct {
+		name     string
+		codings  []string
+		encoding string
+		err      error
+	}{
+		{name: "identity", encoding: "identity"},
+		{name: "empty"},
+		{name: "gzip", codings: []string{"gzip"}, encoding: "gzip"},
+		{name: "x-gzip", codings: []string{"gzip"}, encoding: "X-Gzip"},
+		{name: "deflate", codings: []string{"deflate"}, encoding: "deflate"},
+		{name: "raw deflate", codings: []string{"raw-deflate"}, encoding: "deflate"},
+		{name: "brotli", codings: []string{"br"}, encoding: "br"},
+		{name: "zstd", codings: []string{"zstd"}, encoding: "zstd"},
+		{name: "multiple codings", codings: []string{"gzip", "br"}, encoding: "gzip, br"},
+		{name: "unsupported", codings: []string{"gzip"}, encoding: "compress", err: ErrUnsupportedContentEncoding},
+	} {
+		tcase := tcase
+
+		t.Run(tcase.name, func(t *testing.T) {
+			t.Parallel()
+
+			reader, err := NewDecompressReader(bytes.NewReader(compress(t, data, tcase.codings...)), tcase.encoding)
+			if !errors.Is(err, tcase.err) {
+				t.Fatalf("expected error %v, got %v", tcase.err, err)
+			}
+
+			if tcase.err != nil {
+				return
+			}
+
+			defer reader.Close()
+
+			got, err := io.ReadAll(reader)
+			if err != nil {
+				t.Fatalf("failed to read: %v", err)
+			}
+
+			if !bytes.Equal(got, data) {
+				t.Fatalf("got %q, want %q", got, data)
+			}
+		})
+	}
+}
+
+func TestDecompressBytesTruncated(t *testing.T) {
+	t.Parallel()
+
+	for _, coding := range []string{"gzip", "deflate", "br", "zstd"} {
+		coding := coding
+
+		t.Run(coding, func(t *testing.T) {
+			t.Parallel()
+
+			data := compress(t, bytes.Repeat([]byte(`{"x":1}`), 100), coding)
+
+			_, err := decompressBytes(data[:len(data)/2], coding)
+			if !errors.Is(err, io.ErrUnexpectedEOF) {
+				t.Fatalf("expected error %v, got %v", io.ErrUnexpectedEOF, err)
+			}
+		})
+	}
+}
+
+func TestHTTPServiceStoreCompressed(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Accept-Encoding") != acceptEncoding {
+			w.WriteHeader(http.StatusNotAcceptable)
+
+			return
+		}
+
+		coding := r.URL.Query().Get("coding")
+
+		page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+
+		next := `null`
+		if page < 2 {
+			next = strconv.Itoa(page + 1)
+		}
+
+		body := []byte(fmt.Sprintf(`{"page":%d,"next":%s}`, page, next))
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Content-Encoding", coding)
+		_, _ = w.Write(compress(t, body, coding))
+	}))
+	defer server.Close()
+
+	for _, coding := range []string{"gzip", "deflate", "br", "zstd"} {
+		svc, err := NewService(context.Background())
+		if err != nil {
+			t.Fatalf("failed to create service: %v", err)
+		}
+
+		req, err := http.NewRequestWithContext(context.Background(), http.MethodGet,
+			server.URL+"?page=1&coding="+coding, nil)
+		if err != nil {
+			t.Fatalf("failed to create request: %v", err)
+		}
+
+		writer := &mockListWriter{}
+
+		svc.HTTP.Client(server.Client()).AcceptEncoding(true).Requests(NewHTTPRequest(req,
+			WithWriters(writer),
+			WithPaginator(NewCursorPaginator("next", "page"))))
+
+		if err := svc.HTTP.Store(context.Background()); err != nil {
+			t.Fatalf("%s: failed to store: %v", coding, err)
+		}
+
+		assertSocketWrites(t, []ListWriter{writer}, [][]byte{
+			[]byte(`[{"page":1,"next":2}]`),
+			[]byte(`[{"page":2,"next":null}]`),
+		})
+	}
+}
+
+// chunkedConn returns the data in chunks of the given size.
+type chunkedConn struct {
+	data []byte
+	size int
+}
+
+func (c *chunkedConn) Read(b []byte) (int, error) {
+	if len(c.data) == 0 {
+		return 0, io.EOF
+	}
+
+	if len(b) > c.size {
+		b = b[:c.size]
+	}
+
+	n := copy(b, c.data)
+	c.data = c.data[n:]
+
+	return n, nil
+}
+
+func (c *chunkedConn) Write(b []byte) (int, error) {
+	return len(b), nil
+}
+
+func TestSocketStoreContentEncoding(t *testing.T) {
+	t.Parallel()
+
+	// Send a compressed JSON array that is read in many small chunks.
+	data := compress(t, []byte(`[`+strings.Repeat(`{"x":1},`, 199)+`{"x":1}]`), "gzip")
+
+	writer := &mockListWriter{}
+	socket := NewSocket(&chunkedConn{data: data, size: 16},
+		WithSocketWriters(writer),
+		WithSocketContentEncoding("gzip"))
+
+	if err := NewSocketService(nil).Connections(socket).Store(context.Background()); err != nil {
+		t.Fatalf("failed to store: %v", err)
+	}
+
+	if writer.count != 1 {
+		t.Fatalf("expected 1 write, got %d", writer.count)
+	}
+}
@@ -0,0 +1,201 @@
+// Copyright 2023 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+
+package gidari
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// RequestError is the error of an HTTP request, or of decoding or writing the
+// data of its response, with the context of the request. Use "errors.As" to get
+// the RequestError from the errors returned by the HTTP service.
+type RequestError struct {
+	// Method and URL are the method and URL of the request. For a
+	// follow-up request for a page, the URL is that of the page.
+	Method string
+	URL    *url.URL
+
+	// Page is the one-based number of the request in a sequence of
+	// paginated requests.
+	Page int
+
+	// Attempt is the number of times the request was made, including
+	// retries. It is zero if the request was not made.
+	Attempt int
+
+	// StatusCode is the status code of the response. It is zero if there
+	// was no response.
+	StatusCode int
+
+	// Writer identifies the writer that failed, if any, by the result of
+	// its "String" method if it implements "fmt.Stringer", or by its type
+	// otherwise.
+	Writer string
+
+	// Err is the cause of the error.
+	Err error
+}
+
+func (err *RequestError) Error() string {
+	var msg strings.Builder
+
+	msg.WriteString(err.Method)
+
+	if err.URL != nil {
+		msg.WriteString(" " + err.URL.Redacted())
+	}
+
+	if err.Writer != "" {
+		msg.WriteString(" (writer " + err.Writer + ")")
+	}
+
+	return fmt.Sprintf("%s: %v", msg.String(), err.Err)
+}
+
+// Unwrap will return the cause of the error.
+func (err *RequestError) Unwrap() error {
+	return err.Err
+}
+
+// SocketError is the error of reading from a socket, or of decoding or writing
+// the data of its messages, with the context of the socket. Use "errors.As" to
+// get the SocketError from the errors returned by the socket service.
+type SocketError struct {
+	// SocketID is the identity of the socket, set with the "WithSocketID"
+	// option.
+	SocketID string
+
+	// Message is the one-based number of the message that was being read
+	// or written.
+	Message int
+
+	// Writer identifies the writer that failed, if any, by the result of
+	// its "String" method if it implements "fmt.Stringer", or by its type
+	// otherwise.
+	Writer string
+
+	// Err is the cause of the error.
+	Err error
+}
+
+func (err *SocketError) Error() string {
+	msg := fmt.Sprintf("socket %q message %d", err.SocketID, err.Message)
+	if err.Writer != "" {
+		msg += " (writer " + err.Writer + ")"
+	}
+
+	return fmt.Sprintf("%s: %v", msg, err.Err)
+}
+
+// Unwrap will return the cause of the error.
+func (err *SocketError) Unwrap() error {
+	return err.Err
+}
+
+// writerError is the error of a writer, which keeps the writer so that it can
+// be identified by the RequestError or SocketError that wraps the error.
+type writerError struct {
+	writer ListWriter
+	err    error
+}
+
+func (err *writerError) Error() string {
+	return err.err.Error()
+}
+
+// Unwrap will return the writer's error.
+func (err *writerError) Unwrap() error {
+	return err.err
+}
+
+// writerName will return the identity of the writer, which is the result of
+// its "String" method if it implements "fmt.Stringer", or its type otherwise.
+func writerName(writer ListWriter) string {
+	if stringer, ok := writer.(fmt.Stringer); ok {
+		return stringer.String()
+	}
+
+	return fmt.Sprintf("%T", writer)
+}
+
+// hasContext will report whether the error is already a RequestError or a
+// SocketError, so that it is not wrapped again.
+func hasContext(err error) bool {
+	var reqErr *RequestError
+	if errors.As(err, &reqErr) {
+		return true
+	}
+
+	var socErr *SocketError
+
+	return errors.As(err, &socErr)
+}
+
+// writerCause will return the name of the writer that failed, if any, and the
+// error without the writerError that identifies the writer.
+func writerCause(err error) (string, error) {
+	var writerErr *writerError
+	if !errors.As(err, &writerErr) {
+		return "", err
+	}
+
+	if err == writerErr { //nolint:errorlint,goerr113
+		err = writerErr.err
+	}
+
+	return writerName(writerErr.writer), err
+}
+
+// newRequestError will wrap the error with the context of the request, unless
+// the error already has context. The status code is zero if there was no
+// response.
+func newRequestError(req *Request, attempt, statusCode int, err error) error {
+	if err == nil || hasContext(err) {
+		return err
+	}
+
+	reqErr := &RequestError{
+		Method:     req.http.Method,
+		URL:        req.http.URL,
+		Page:       req.page + 1,
+		Attempt:    attempt,
+		StatusCode: statusCode,
+	}
+
+	reqErr.Writer, reqErr.Err = writerCause(err)
+
+	return reqErr
+}
+
+// statusCode will return the status code of the response, or zero if there is
+// no response.
+func statusCode(rsp *http.Response) int {
+	if rsp == nil {
+		return 0
+	}
+
+	return rsp.StatusCode
+}
+
+// newSocketError will wrap the error with the context of the socket, unless
+// the error already has context.
+func newSocketError(id string, message int, err error) error {
+	if err == nil || hasContext(err) {
+		return err
+	}
+
+	socErr := &SocketError{SocketID: id, Message: message}
+	socErr.Writer, socErr.Err = writerCause(err)
+
+	return socErr
+}
@@ -0,0 +1,173 @@
+// Copyright 2023 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+
+package gidari
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// namedRejectWriter is a rejectWriter that identifies itself by name.
+type namedRejectWriter struct {
+	rejectWriter
+}
+
+func (w *namedRejectWriter) String() string {
+	return "reject"
+}
+
+func TestHTTPServiceStoreRequestError(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		switch r.URL.Path {
+		case "/bad":
+			w.WriteHeader(http.StatusServiceUnavailable)
+		case "/pages":
+			if r.URL.Query().Get("page") == "" {
+				w.Header().Set("Link", `</pages?page=2>; rel="next"`)
+				fmt.Fprint(w, `[{"id":1}]`)
+
+				return
+			}
+
+			fmt.Fprint(w, `[{"reject":true}]`)
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	// A refused connection is not retried, so it is attempted once.
+	closed := httptest.NewServer(http.NotFoundHandler())
+	closed.Close()
+
+	retry := NewRetryPolicy(2)
+	retry.MinBackoff = time.Millisecond
+	retry.MaxBackoff = time.Millisecond
+
+	for _, tcase := range []struct {
+		name  string
+		url   string
+		opts  []RequestOption
+		want  RequestError
+		cause error
+	}{
+		{
+			name:  "status",
+			url:   server.URL + "/bad",
+			opts:  []RequestOption{WithRetryPolicy(retry)},
+			want:  RequestError{Page: 1, Attempt: 2, StatusCode: http.StatusServiceUnavailable},
+			cause: ErrBadResponse,
+		},
+		{
+			name: "writer",
+			url:  server.URL + "/pages",
+			opts: []RequestOption{
+				WithPaginator(NewLinkHeaderPaginator()),
+				WithWriters(&namedRejectWriter{}),
+			},
+			want:  RequestError{Page: 2, Attempt: 1, StatusCode: http.StatusOK, Writer: "reject"},
+			cause: errRejected,
+		},
+		{
+			name: "fetch",
+			url:  closed.URL,
+			opts: []RequestOption{WithRetryPolicy(retry)},
+			want: RequestError{Page: 1, Attempt: 1},
+		},
+	} {
+		tcase := tcase
+
+		t.Run(tcase.name, func(t *testing.T) {
+			t.Parallel()
+
+			svc, err := NewService(context.Background())
+			if err != nil {
+				t.Fatalf("failed to create service: %v", err)
+			}
+
+			req, err := http.NewRequestWithContext(context.Background(), http.MethodGet, tcase.url, nil)
+			if err != nil {
+				t.Fatalf("failed to create request: %v", err)
+			}
+
+			err = svc.HTTP.Client(server.Client()).Requests(NewHTTPRequest(req, tcase.opts...)).
+				Store(context.Background())
+			if err == nil || (tcase.cause != nil && !errors.Is(err, tcase.cause)) {
+				t.Fatalf("expected error %v, got %v", tcase.cause, err)
+			}
+
+			var reqErr *RequestError
+			if !errors.As(err, &reqErr) {
+				t.Fatalf("expected a *RequestError, got %T: %v", err, err)
+			}
+
+			if reqErr.Method != http.MethodGet || !strings.HasPrefix(reqErr.URL.String(), tcase.url) {
+				t.Fatalf("method, url = %s, %v, want %s, %s", reqErr.Method, reqErr.URL,
+					http.MethodGet, tcase.url)
+			}
+
+			got := RequestError{
+				Page:       reqErr.Page,
+				Attempt:    reqErr.Attempt,
+				StatusCode: reqErr.StatusCode,
+				Writer:     reqErr.Writer,
+			}
+
+			if got != tcase.want {
+				t.Fatalf("request error = %+v, want %+v", got, tcase.want)
+			}
+
+			if !strings.Contains(err.Error(), reqErr.URL.Redacted()) {
+				t.Fatalf("expected the error to contain the URL, got %q", err.Error())
+			}
+		})
+	}
+}
+
+func TestSocketStoreSocketError(t *testing.T) {
+	t.Parallel()
+
+	svc, err := NewService(context.Background())
+	if err != nil {
+		t.Fatalf("failed to create service: %v", err)
+	}
+
+	conn := &mockConn{readData: [][]byte{
+		[]byte(`[{"id":1}]`),
+		[]byte(`[{"reject":true}]`),
+	}}
+
+	err = svc.Socket.Connections(NewSocket(conn, WithSocketWriters(&namedRejectWriter{}), WithSocketID("a"))).
+		Store(context.Background())
+	if !errors.Is(err, errRejected) {
+		t.Fatalf("expected error %v, got %v", errRejected, err)
+	}
+
+	var socErr *SocketError
+	if !errors.As(err, &socErr) {
+		t.Fatalf("expected a *SocketError, got %T: %v", err, err)
+	}
+
+	want := SocketError{SocketID: "a", Message: 2, Writer: "reject", Err: errRejected}
+	if *socErr != want {
+		t.Fatalf("socket error = %+v, want %+v", *socErr, want)
+	}
+
+	if got, want := err.Error(), `socket "a" message 2 (writer reject): rejected`; got != want {
+		t.Fatalf("error = %q, want %q", got, want)
+	}
+}
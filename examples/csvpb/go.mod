@@ -10,4 +10,8 @@ require (
 	golang.org/x/time v0.3.0
 )
 
-require google.golang.org/protobuf v1.28.1 // indirect
+require (
+	github.com/andybalholm/brotli v1.0.5 // indirect
+	github.com/klauspost/compress v1.16.7 // indirect
+	google.golang.org/protobuf v1.28.1 // indirect
+)
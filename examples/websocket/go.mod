@@ -7,7 +7,11 @@ replace github.com/alpstable/gidari => ../../
 require (
 	github.com/alpstable/gidari v0.0.0-00010101000000-000000000000
 	golang.org/x/net v0.9.0
-	google.golang.org/protobuf v1.30.0
 )
 
-require golang.org/x/time v0.3.0 // indirect
+require (
+	github.com/andybalholm/brotli v1.0.5 // indirect
+	github.com/klauspost/compress v1.16.7 // indirect
+	golang.org/x/time v0.3.0 // indirect
+	google.golang.org/protobuf v1.30.0 // indirect
+)
@@ -16,19 +16,24 @@ import (
 
 	"github.com/alpstable/gidari"
 	"golang.org/x/net/websocket"
-	"google.golang.org/protobuf/types/known/structpb"
 )
 
-type OSListWriter struct{}
+// Ticker is a message from the Coinbase "ticker" channel.
+type Ticker struct {
+	Type      string    `json:"type"`
+	ProductID string    `json:"product_id"`
+	Price     string    `json:"price"`
+	Time      time.Time `json:"time"`
+}
 
-func (lw *OSListWriter) Write(ctx context.Context, list *structpb.ListValue) error {
-	for _, v := range list.GetValues() {
-		m, ok := v.GetKind().(*structpb.Value_StructValue)
-		if !ok {
+// printTickers will print the ticker messages to stdout.
+func printTickers(ctx context.Context, tickers []Ticker) error {
+	for _, ticker := range tickers {
+		if ticker.Type != "ticker" {
 			continue
 		}
 
-		fmt.Println(m.StructValue.AsMap())
+		fmt.Printf("%s %s %s\n", ticker.Time.Format(time.RFC3339), ticker.ProductID, ticker.Price)
 	}
 
 	return nil
@@ -52,10 +57,10 @@ func main() {
 		panic(err.Error())
 	}
 
-	// Create a socket with the connection that writes with the
-	// OSListWriter.
+	// Create a socket with the connection that writes the messages as
+	// Tickers.
 	socket := gidari.NewSocket(conn,
-		gidari.WithSocketWriters(&OSListWriter{}))
+		gidari.WithSocketWriters(gidari.NewTypedWriter(printTickers)))
 
 	// Add the socket to the service.
 	svc.Socket.Connections(socket)
@@ -3,8 +3,14 @@ module github.com/alpstable/gidari
 go 1.19
 
 require (
+	github.com/andybalholm/brotli v1.0.5
+	github.com/klauspost/compress v1.16.7
+	golang.org/x/net v0.9.0
 	golang.org/x/time v0.3.0
 	google.golang.org/protobuf v1.28.1
 )
 
-require golang.org/x/xerrors v0.0.0-20220907171357-04be3eba64a2 // indirect
+require (
+	golang.org/x/text v0.9.0 // indirect
+	golang.org/x/xerrors v0.0.0-20220907171357-04be3eba64a2 // indirect
+)
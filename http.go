@@ -9,6 +9,7 @@
 package gidari
 
 import (
+	"bytes"
 	"context"
 	"errors"
 	"fmt"
@@ -16,8 +17,8 @@ import (
 	"net/http"
 	"runtime"
 	"sync"
+	"time"
 
-	"github.com/alpstable/gidari/third_party/accept"
 	"golang.org/x/time/rate"
 )
 
@@ -26,8 +27,31 @@ import (
 type Request struct {
 	http *http.Request
 
-	auth    func(*http.Request) (*http.Response, error) // round tripper
-	writers []ListWriter
+	auth      func(*http.Request) (*http.Response, error) // round tripper
+	writers   []ListWriter
+	paginator Paginator
+	retry     *RetryPolicy
+	rlimiter  *rate.Limiter
+	batch     batchSize
+	selector  *selector
+	scalars   *ScalarPolicy
+	statuses  *StatusPolicy
+
+	// page is the zero-based number of the request in a sequence of
+	// paginated requests.
+	page int
+
+	// contentType overrides the "Content-Type" header of the response
+	// when selecting a decoder.
+	contentType string
+
+	// root is the request that a follow-up request for a page was created
+	// from, or nil if the request is not a follow-up.
+	root *Request
+
+	// visited are the URLs of the pages requested so far, shared by the
+	// follow-up requests of a paginated request.
+	visited map[string]bool
 }
 
 // RequestOption is used to set an option on a request.
@@ -48,6 +72,16 @@ func NewHTTPRequest(req *http.Request, opts ...RequestOption) *Request {
 	return hreq
 }
 
+// rootRequest will return the request that the request was created from, which
+// is the request itself unless it is a follow-up request for a page.
+func (req *Request) rootRequest() *Request {
+	if req.root != nil {
+		return req.root
+	}
+
+	return req
+}
+
 // WithAuth will set a round tripper to be used by the service to authenticate
 // the request during the http transport.
 func WithAuth(auth func(*http.Request) (*http.Response, error)) RequestOption {
@@ -56,6 +90,15 @@ func WithAuth(auth func(*http.Request) (*http.Response, error)) RequestOption {
 	}
 }
 
+// WithResponseContentType will set the media type used to select the decoder
+// for the response, overriding the response's "Content-Type" header. This is
+// useful for web APIs that send an incorrect "Content-Type".
+func WithResponseContentType(mediaType string) RequestOption {
+	return func(req *Request) {
+		req.contentType = mediaType
+	}
+}
+
 // WithWriters sets optional writers to be used by the HTTP Service upsert
 // method to write the data from the response.
 func WithWriters(w ...ListWriter) RequestOption {
@@ -84,13 +127,29 @@ type HTTPService struct {
 	// defined by the "net/http" package.
 	Iterator *HTTPIteratorService
 
-	rlimiter *rate.Limiter
-	requests []*Request
+	rlimiter  *rate.Limiter
+	rlimiters *RateLimiterRegistry
+	adaptive  *AdaptiveLimiter
+	retry     *RetryPolicy
+	decoders  *DecoderRegistry
+	batch     batchSize
+	scalars   *ScalarPolicy
+	statuses  *StatusPolicy
+	requests  []*Request
+
+	maxInFlight        int
+	maxInFlightPerHost int
+	acceptEncoding     bool
+	continueOnError    bool
 }
 
 // NewHTTPService will create a new HTTPService.
 func NewHTTPService(svc *Service) *HTTPService {
-	httpSvc := &HTTPService{svc: svc, client: http.DefaultClient}
+	httpSvc := &HTTPService{
+		svc:      svc,
+		client:   http.DefaultClient,
+		decoders: NewDecoderRegistry(),
+	}
 	httpSvc.Iterator = NewHTTPIteratorService(httpSvc)
 
 	return httpSvc
@@ -104,6 +163,181 @@ func (svc *HTTPService) RateLimiter(rlimiter *rate.Limiter) *HTTPService {
 	return svc
 }
 
+// RateLimiters sets an optional registry of rate limiters for the service. A
+// limiter from the registry takes precedence over the limiter set by the
+// "RateLimiter" method, but not over a limiter set on the request with the
+// "WithRateLimiter" option.
+func (svc *HTTPService) RateLimiters(reg *RateLimiterRegistry) *HTTPService {
+	svc.rlimiters = reg
+
+	return svc
+}
+
+// AdaptiveRateLimiter sets an optional adaptive limiter for the service. The
+// limiter reads the rate limit headers from every response and delays
+// subsequent requests before the web API's quota is exhausted. The adaptive
+// limiter is applied in addition to any static rate limiters.
+func (svc *HTTPService) AdaptiveRateLimiter(lim *AdaptiveLimiter) *HTTPService {
+	svc.adaptive = lim
+
+	return svc
+}
+
+// Decoders sets the registry used to decode response bodies by their
+// "Content-Type". By default, the service uses the registry returned by
+// "NewDecoderRegistry".
+func (svc *HTTPService) Decoders(reg *DecoderRegistry) *HTTPService {
+	svc.decoders = reg
+
+	return svc
+}
+
+// BatchSize sets the maximum number of values passed to a list writer at once
+// for every request that does not set its own with the "WithBatchSize" option.
+// See "WithBatchSize" for details.
+func (svc *HTTPService) BatchSize(n int) *HTTPService {
+	svc.batch.values = n
+
+	return svc
+}
+
+// BatchBytes sets the approximate maximum number of bytes passed to a list
+// writer at once for every request that does not set its own with the
+// "WithBatchBytes" option. See "WithBatchSize" for details.
+func (svc *HTTPService) BatchBytes(n int) *HTTPService {
+	svc.batch.bytes = n
+
+	return svc
+}
+
+// ScalarPolicy sets the policy for decoded values that are not objects for
+// every request that does not set its own policy with the "WithScalarPolicy"
+// option. If no policy is set, such values result in an error.
+func (svc *HTTPService) ScalarPolicy(policy *ScalarPolicy) *HTTPService {
+	svc.scalars = policy
+
+	return svc
+}
+
+// StatusPolicy sets the policy for handling responses by their status codes for
+// every request that does not set its own policy with the "WithStatusPolicy"
+// option. If no policy is set, only 200 (OK) responses are decoded and any
+// other status code fails the request.
+func (svc *HTTPService) StatusPolicy(policy *StatusPolicy) *HTTPService {
+	svc.statuses = policy
+
+	return svc
+}
+
+// RetryPolicy sets the optional retry policy for the service. The policy is
+// used for every request that does not set its own policy with the
+// "WithRetryPolicy" option. If no policy is set, requests are not retried.
+func (svc *HTTPService) RetryPolicy(policy *RetryPolicy) *HTTPService {
+	svc.retry = policy
+
+	return svc
+}
+
+// AcceptEncoding will set the "Accept-Encoding" header to advertise all of the
+// supported content encodings, which are "gzip", "deflate", "br" and "zstd",
+// for every request that does not set the header itself. Regardless of this
+// setting, response bodies are decompressed according to their
+// "Content-Encoding" header before they are paginated or decoded.
+func (svc *HTTPService) AcceptEncoding(enabled bool) *HTTPService {
+	svc.acceptEncoding = enabled
+
+	return svc
+}
+
+// ContinueOnError will make "Store" run every request to completion, rather
+// than stopping at the first request that fails. A request fails if it can not
+// be made, if a response's status code is not 200, or if a response can not be
+// decoded or written. Once every request is finished, "Store" returns the
+// errors of the failed requests joined together. Use "StoreWithReport" to get
+// the outcome of each request.
+func (svc *HTTPService) ContinueOnError(enabled bool) *HTTPService {
+	svc.continueOnError = enabled
+
+	return svc
+}
+
+// MaxInFlight sets the maximum number of requests the service will have in
+// flight at any one time. If the value is not positive, then the number of
+// CPUs is used.
+func (svc *HTTPService) MaxInFlight(n int) *HTTPService {
+	svc.maxInFlight = n
+
+	return svc
+}
+
+// MaxInFlightPerHost sets the maximum number of requests the service will have
+// in flight to any single host at one time. If the value is not positive, then
+// there is no per-host limit.
+func (svc *HTTPService) MaxInFlightPerHost(n int) *HTTPService {
+	svc.maxInFlightPerHost = n
+
+	return svc
+}
+
+// deadLetterSink will return the service's dead-letter sink, if any.
+func (svc *HTTPService) deadLetterSink() DeadLetterSink {
+	if svc.svc == nil {
+		return nil
+	}
+
+	return svc.svc.deadLetters
+}
+
+// inFlightLimit will return the maximum number of requests in flight.
+func (svc *HTTPService) inFlightLimit() int {
+	if svc.maxInFlight <= 0 {
+		return runtime.NumCPU()
+	}
+
+	return svc.maxInFlight
+}
+
+// newWebWorkerJob will create a web worker job for the request using the
+// service's configuration.
+func (svc *HTTPService) newWebWorkerJob(req *Request) webWorkerJob {
+	retry := req.retry
+	if retry == nil {
+		retry = svc.retry
+	}
+
+	statuses := svc.statusPolicy(req)
+
+	// Use the most specific rate limiter for the request.
+	rlimiter := req.rlimiter
+	if rlimiter == nil {
+		rlimiter = svc.rlimiters.Limiter(req.http)
+	}
+
+	if rlimiter == nil {
+		rlimiter = svc.rlimiter
+	}
+
+	return webWorkerJob{
+		req:      req,
+		client:   svc.client,
+		rlimiter: rlimiter,
+		adaptive: svc.adaptive,
+		retry:    statuses.retryPolicy(retry),
+		statuses: statuses,
+
+		acceptEncoding: svc.acceptEncoding,
+	}
+}
+
+// statusPolicy will return the status policy for the request.
+func (svc *HTTPService) statusPolicy(req *Request) *StatusPolicy {
+	if req.statuses != nil {
+		return req.statuses
+	}
+
+	return svc.statuses
+}
+
 // Client sets the optional client to be used by the service. If no client is
 // set, the default "http.DefaultClient" defined by the "net/http" package
 // will be used.
@@ -122,61 +356,135 @@ func (svc *HTTPService) Requests(reqs ...*Request) *HTTPService {
 	return svc
 }
 
-// isDecodeTypeJSON will check if the provided "accept" struct is typed for
-// decoding into JSON.
-func isDecodeTypeJSON(acceptHeader accept.Accept) bool {
-	return acceptHeader.Typ == "application" &&
-		(acceptHeader.Subtype == "json" || acceptHeader.Subtype == "*") ||
-		acceptHeader.Typ == "*" && acceptHeader.Subtype == "*"
+// newListMeta will return the metadata describing the current response.
+func newListMeta(current *Current) ListMeta {
+	meta := ListMeta{
+		Request:     current.req.http,
+		RequestedAt: current.requestedAt,
+		ReceivedAt:  current.receivedAt,
+		Page:        current.req.page + 1,
+	}
+
+	if rsp := current.Response; rsp != nil {
+		meta.StatusCode = rsp.StatusCode
+		meta.Header = rsp.Header
+	}
+
+	return meta
 }
 
-// bestFitDecodeType will parse the provided Accept(-Charset|-Encoding|-Language)
-// header and return the header that best fits the decoding algorithm. If the
-// "Accept" header is not set, then this method will return a decodeTypeJSON.
-// If the "Accept" header is set, but no match is found, then this method will
-// return a decodeTypeUnkown.
-//
-// See the "acceptSlice.Less" method in the "third_party/accept" package for
-// more informaiton on how the "best fit" is determined.
-func bestFitDecodeType(header string) DecodeType {
-	decodeType := DecodeTypeUnknown
+// newListWriterJob will create the job that decodes the current response and
+// writes the data to the request's writers. If there is no response, or the
+// response is skipped by the status policy, then the returned job is nil.
+func (svc *HTTPService) newListWriterJob(current *Current) (*listWriterJob, error) {
+	rsp := current.Response
+	if rsp == nil {
+		return nil, nil
+	}
 
-	for _, acceptHeader := range accept.ParseAcceptHeader(header) {
-		if isDecodeTypeJSON(acceptHeader) {
-			decodeType = DecodeTypeJSON
+	req := current.req
 
-			break
-		}
+	// Only decode the response if its status code is a success. Responses
+	// that are skipped have no data, and any other response fails.
+	statuses := svc.statusPolicy(req)
+
+	switch statuses.class(rsp.StatusCode) {
+	case StatusSuccess:
+	case StatusSkip:
+		discardResponse(rsp)
+
+		return nil, nil
+	case StatusFatal, StatusRetry:
+		fallthrough
+	default:
+		statusErr := newStatusError(rsp, statuses.maxErrorBody())
+
+		return nil, newRequestError(req, current.attempts, rsp.StatusCode, statusErr)
+	}
+
+	job := &listWriterJob{
+		writers: current.writers,
+		meta:    newListMeta(current),
+		req:     req,
+		attempt: current.attempts,
+	}
+
+	scalars := req.scalars
+	if scalars == nil {
+		scalars = svc.scalars
+	}
+
+	// Get the decoder for the response's content type. If there is
+	// no decoder for the content type, then return an error.
+	decFunc, err := svc.decoders.decodeFunc(rsp, decodeOptions{
+		contentType: req.contentType,
+		batch:       req.batch.or(svc.batch),
+		selector:    req.selector,
+		scalars:     scalars,
+	})
+	if err != nil {
+		return nil, newRequestError(req, current.attempts, rsp.StatusCode, err)
 	}
 
-	return decodeType
+	job.decFunc = decFunc
+
+	return job, nil
 }
 
-func (svc *HTTPService) store(ctx context.Context, jobs chan<- listWriterJob, done <-chan struct{}) error {
+// store will send a job to the list writer for each response. Unless the
+// service continues on errors, it returns the first error encountered.
+func (svc *HTTPService) store(ctx context.Context, jobs chan<- listWriterJob,
+	trackers map[*Request]*requestTracker,
+) error {
+	// Close the jobs channel once there are no more responses to decode,
+	// signaling the list writer to stop.
+	defer close(jobs)
+
+	// Stop any web workers that are still running if this method returns
+	// early.
+	defer func() { _ = svc.Iterator.Close() }()
+
+	sink := svc.deadLetterSink()
+
 	for svc.Iterator.Next(ctx) {
-		rsp := svc.Iterator.Current.Response
+		current := svc.Iterator.Current
 
-		// If there is no response, then do nothing.
-		if rsp == nil {
-			continue
+		tracker := trackers[current.req.rootRequest()]
+		tracker.receive(current)
+
+		// Record the body, so that it can be sent to the dead-letter
+		// sink if it can not be decoded.
+		var body *bytes.Buffer
+		if sink != nil && current.Response != nil {
+			body = recordBody(current.Response)
 		}
 
-		// If response status code is not 200 (OK) return with an error
-		if rsp.StatusCode != http.StatusOK {
-			return fmt.Errorf("%w: %d", ErrBadResponse, rsp.StatusCode)
+		job, err := svc.newListWriterJob(current)
+		if err != nil && sink != nil {
+			job, err = failedListWriterJob(current, err), nil
+		}
+
+		if err != nil {
+			tracker.finish(err)
+
+			if svc.continueOnError {
+				continue
+			}
+
+			return err
 		}
 
-		job := &listWriterJob{writers: svc.Iterator.Current.writers}
+		// If there is no response, then do nothing.
+		if job == nil {
+			tracker.finish(nil)
 
-		// Get the best fit type for decoding the response body. If the
-		// best fit is "Unknown", then return an error.
-		switch bestFitDecodeType(rsp.Header.Get("Accept")) {
-		case DecodeTypeJSON:
-			job.decFunc = decodeFuncJSON(rsp)
-		case DecodeTypeUnknown:
-			return fmt.Errorf("%w: %q", ErrUnsupportedDecodeType, rsp.Request.URL.String())
+			continue
 		}
 
+		job.deadLetters = sink
+		job.body = body
+		job.tracker = tracker
+
 		jobs <- *job
 	}
 
@@ -184,13 +492,6 @@ func (svc *HTTPService) store(ctx context.Context, jobs chan<- listWriterJob, do
 		return fmt.Errorf("error iterating over requests: %w", err)
 	}
 
-	for w := 1; w <= len(svc.requests); w++ {
-		<-done
-	}
-
-	// Close the jobs channel.
-	close(jobs)
-
 	if err := svc.Iterator.Close(); err != nil {
 		return fmt.Errorf("failed to close iterator: %w", err)
 	}
@@ -201,32 +502,68 @@ func (svc *HTTPService) store(ctx context.Context, jobs chan<- listWriterJob, do
 // Store will concurrently make the requests to the client and store the data
 // from the responses in the provided storage. If no storage is provided, then
 // the data will be discarded.
+//
+// Once the requests are finished, whether or not they succeed, every distinct
+// writer and the dead-letter sink are flushed and closed if they implement
+// Flusher or Closer. See "WithDeadLetterSink" for storing the responses that
+// fail without failing the other requests.
 func (svc *HTTPService) Store(ctx context.Context) error {
-	reqCount := len(svc.requests)
+	_, err := svc.StoreWithReport(ctx)
+
+	return err
+}
+
+// StoreWithReport will store the data in the same way as "Store", and also
+// return a report of the outcome of each request, including the number of
+// responses, bytes and records, the time taken and any error. The report is
+// returned even if an error is returned.
+//
+// Unless the service continues on errors, "StoreWithReport" stops at the first
+// error, and the requests that have not finished by then fail with
+// ErrRequestNotCompleted in the report. See "ContinueOnError".
+func (svc *HTTPService) StoreWithReport(ctx context.Context) (*StoreReport, error) {
+	start := time.Now()
+	trackers := newStoreTrackers(svc.requests)
 
 	// If there are no requests, do nothing.
-	if reqCount == 0 {
-		return nil
+	if len(svc.requests) == 0 {
+		return newStoreReport(nil, trackers, 0), nil
 	}
 
 	// Reset the iterator.
 	svc.Iterator = NewHTTPIteratorService(svc)
+	svc.Iterator.continueOnError = svc.continueOnError
 
-	listWriterCh := startListWriter(ctx, reqCount)
+	// The list writer is buffered by the number of requests in flight so
+	// that the number of undecoded responses is bounded.
+	listWriterCh := startListWriter(ctx, svc.inFlightLimit())
 
 	upsertWorkerJobs := listWriterCh.jobs
-	done := listWriterCh.done
 	errCh := listWriterCh.err
 
-	if err := svc.store(ctx, upsertWorkerJobs, done); err != nil {
-		return fmt.Errorf("failed to upsert data: %w", err)
+	var err error
+	if storeErr := svc.store(ctx, upsertWorkerJobs, trackers); storeErr != nil {
+		err = fmt.Errorf("failed to upsert data: %w", storeErr)
 	}
 
-	if err := <-errCh; err != nil {
-		return fmt.Errorf("error in upsert worker: %w", err)
+	// Always wait for the list writer, so that the writers are not
+	// finished while they are still being written to. If the service
+	// continues on errors, then the errors are in the report.
+	if writeErr := <-errCh; writeErr != nil && err == nil && !svc.continueOnError {
+		err = fmt.Errorf("error in upsert worker: %w", writeErr)
 	}
 
-	return nil
+	report := newStoreReport(svc.requests, trackers, time.Since(start))
+	if svc.continueOnError {
+		err = joinErrors(err, report.Err())
+	}
+
+	writers := make([][]ListWriter, len(svc.requests))
+	for idx, req := range svc.requests {
+		writers[idx] = req.writers
+	}
+
+	return report, joinErrors(err, finishWriters(distinctWriters(writers...), svc.deadLetterSink()))
 }
 
 // Current is a struct that represents the most recent response by calling the
@@ -234,6 +571,14 @@ func (svc *HTTPService) Store(ctx context.Context) error {
 type Current struct {
 	Response *http.Response // HTTP response from the request.
 	writers  []ListWriter   // Writer for storage.
+	req      *Request       // Request that produced the response.
+
+	requestedAt time.Time // Time the final attempt was sent.
+	receivedAt  time.Time // Time the response headers were received.
+	attempts    int       // Number of times the request was made.
+
+	next bool  // Whether a follow-up request for a page was made.
+	err  error // Error of the request, if the iterator continues on errors.
 }
 
 // HTTPIteratorService is a service that will iterate over the requests defined
@@ -248,6 +593,10 @@ type HTTPIteratorService struct {
 	currentChan chan *Current
 	errCh       chan error
 
+	// done is closed when the iterator is closed, stopping the web
+	// workers.
+	done chan struct{}
+
 	// closemu prevents the iterator from closing while there is an active
 	// streaming  result. It is held for read during non-close operations
 	// and exclusively during close.
@@ -256,16 +605,25 @@ type HTTPIteratorService struct {
 	closemu sync.RWMutex
 	closed  bool
 	lasterr error
+
+	// continueOnError will return the responses of the requests that fail
+	// with their errors, rather than stopping at the first error.
+	continueOnError bool
 }
 
 // NewHTTPIteratorService will return a new HTTPIteratorService.
 func NewHTTPIteratorService(svc *HTTPService) *HTTPIteratorService {
-	iter := &HTTPIteratorService{svc: svc, errCh: make(chan error, 1)}
+	iter := &HTTPIteratorService{
+		svc:   svc,
+		errCh: make(chan error, 1),
+		done:  make(chan struct{}),
+	}
 
 	return iter
 }
 
-// Close closes the iterator.
+// Close closes the iterator, canceling any requests that have not yet been
+// made.
 func (iter *HTTPIteratorService) Close() error {
 	iter.closemu.Lock()
 	defer iter.closemu.Unlock()
@@ -275,6 +633,7 @@ func (iter *HTTPIteratorService) Close() error {
 	}
 
 	iter.closed = true
+	close(iter.done)
 
 	return nil
 }
@@ -296,19 +655,136 @@ type webWorkerJob struct {
 	req      *Request
 	client   Client
 	rlimiter *rate.Limiter
+	adaptive *AdaptiveLimiter
+	retry    *RetryPolicy
+	statuses *StatusPolicy
+
+	// acceptEncoding will advertise the supported content encodings if
+	// the request does not set the "Accept-Encoding" header.
+	acceptEncoding bool
+
+	// requestedAt and receivedAt are set by "fetch" to the time the final
+	// attempt was sent and the time its response was received, and
+	// attempts to the number of attempts made.
+	requestedAt time.Time
+	receivedAt  time.Time
+	attempts    int
 }
 
-type webWorkerConfig struct {
-	// id is a unique identifier for the worker. This value MUST be set in
-	// order to start a web worker. One and only one web worker
-	// configuration MUST have an ID of 1 in order to close the response
-	// channel.
-	id int
+// webWorkerQueue is a FIFO queue of web worker jobs. The queue keeps track of
+// the number of pending jobs, i.e. jobs that have been pushed but not yet
+// marked as done, and is closed once there are no pending jobs left. This
+// allows workers to push follow-up jobs without the risk of blocking.
+//
+// If a per-host limit is set, then "pop" will only return jobs for hosts that
+// have fewer than that many jobs in flight.
+type webWorkerQueue struct {
+	mu   sync.Mutex
+	cond *sync.Cond
+
+	jobs      []webWorkerJob
+	pending   int
+	closed    bool
+	hostLimit int
+	inFlight  map[string]int
+
+	// newJob is used to create the jobs for follow-up requests.
+	newJob func(*Request) webWorkerJob
+}
+
+func newWebWorkerQueue(hostLimit int) *webWorkerQueue {
+	queue := &webWorkerQueue{
+		hostLimit: hostLimit,
+		inFlight:  make(map[string]int),
+	}
+
+	queue.cond = sync.NewCond(&queue.mu)
+
+	return queue
+}
+
+// push will add a job to the queue. Jobs pushed after the queue has been
+// closed are dropped.
+func (queue *webWorkerQueue) push(job webWorkerJob) {
+	queue.mu.Lock()
+	defer queue.mu.Unlock()
+
+	if queue.closed {
+		return
+	}
+
+	queue.jobs = append(queue.jobs, job)
+	queue.pending++
+
+	queue.cond.Signal()
+}
+
+// pop will block until a job is available or the queue is closed. The boolean
+// is false if the queue has been closed.
+func (queue *webWorkerQueue) pop() (webWorkerJob, bool) {
+	queue.mu.Lock()
+	defer queue.mu.Unlock()
+
+	for {
+		for idx, job := range queue.jobs {
+			host := job.req.http.URL.Host
+			if queue.hostLimit > 0 && queue.inFlight[host] >= queue.hostLimit {
+				continue
+			}
+
+			queue.jobs = append(queue.jobs[:idx], queue.jobs[idx+1:]...)
+			queue.inFlight[host]++
+
+			return job, true
+		}
+
+		if queue.closed {
+			return webWorkerJob{}, false
+		}
+
+		queue.cond.Wait()
+	}
+}
+
+// done will mark a job returned by "pop" as done. If there are no pending jobs
+// left, then the queue is closed.
+func (queue *webWorkerQueue) done(job webWorkerJob) {
+	queue.mu.Lock()
+	defer queue.mu.Unlock()
+
+	queue.inFlight[job.req.http.URL.Host]--
+	queue.pending--
+
+	if queue.pending <= 0 {
+		queue.closed = true
+	}
+
+	// Wake up all workers, since a host slot may have been released or
+	// the queue may have been closed.
+	queue.cond.Broadcast()
+}
+
+// close will close the queue, dropping any jobs that have not yet been
+// popped.
+func (queue *webWorkerQueue) close() {
+	queue.mu.Lock()
+	defer queue.mu.Unlock()
+
+	queue.pending -= len(queue.jobs)
+	queue.jobs = nil
+	queue.closed = true
 
-	jobs      chan webWorkerJob
+	queue.cond.Broadcast()
+}
+
+type webWorkerConfig struct {
+	queue     *webWorkerQueue
 	currentCh chan *Current
-	done      chan bool
 	errCh     chan error
+
+	// continueOnError will set the errors on the current responses,
+	// rather than pushing them onto the error channel.
+	continueOnError bool
 }
 
 type authRoundTripper struct {
@@ -320,129 +796,209 @@ func (a *authRoundTripper) RoundTrip(req *http.Request) (*http.Response, error)
 	return a.rt(req)
 }
 
-func fetch(ctx context.Context, job *webWorkerJob) (<-chan *http.Response, <-chan error) {
-	out := make(chan *http.Response, 1)
-	errs := make(chan error, 1)
+// fetch will make the request for the job, retrying it according to the job's
+// retry policy.
+func fetch(ctx context.Context, job *webWorkerJob) (*http.Response, error) {
+	// Copy the client in case it is modified.
+	client := job.client
 
-	go func() {
+	// If the client is an *http.Client, then set the auth
+	// round-tripper.
+	if client, ok := client.(*http.Client); ok && job.req.auth != nil {
+		client.Transport = &authRoundTripper{rt: job.req.auth}
+	}
+
+	if job.acceptEncoding && job.req.http.Header.Get("Accept-Encoding") == "" {
+		if job.req.http.Header == nil {
+			job.req.http.Header = make(http.Header)
+		}
+
+		job.req.http.Header.Set("Accept-Encoding", acceptEncoding)
+	}
+
+	for attempt := 1; ; attempt++ {
 		// If the rate limiter is not set, set it with defaults.
 		if rlimiter := job.rlimiter; rlimiter != nil {
 			if err := job.rlimiter.Wait(ctx); err != nil {
-				errs <- fmt.Errorf("rate limiter error: %w", err)
+				return nil, fmt.Errorf("rate limiter error: %w", err)
 			}
 		}
 
-		// Copy the client in case it is modified.
-		client := job.client
+		if err := job.adaptive.Wait(ctx, job.req.http); err != nil {
+			return nil, fmt.Errorf("adaptive rate limiter error: %w", err)
+		}
 
-		// If the client is an *http.Client, then set the auth
-		// round-tripper.
-		if client, ok := client.(*http.Client); ok && job.req.auth != nil {
-			client.Transport = &authRoundTripper{rt: job.req.auth}
+		// Replay the body for every attempt after the first.
+		if attempt > 1 {
+			if err := rewindBody(job.req.http); err != nil {
+				return nil, err
+			}
 		}
 
+		job.requestedAt = time.Now()
+		job.attempts = attempt
+
 		//nolint:bodyclose
 		rsp, err := client.Do(job.req.http)
-		if err != nil {
-			errs <- fmt.Errorf("failed to make request: %w", err)
+
+		job.receivedAt = time.Now()
+
+		job.adaptive.Observe(rsp)
+
+		delay, ok := job.retry.retry(attempt, job.req.http, rsp, err)
+		if !ok {
+			if err != nil {
+				return nil, fmt.Errorf("failed to make request: %w", err)
+			}
+
+			if err := decompressResponse(rsp); err != nil {
+				return nil, err
+			}
+
+			return rsp, nil
 		}
 
-		out <- rsp
+		discardResponse(rsp)
 
-		close(out)
-		close(errs)
-	}()
+		if err := sleepWithContext(ctx, delay); err != nil {
+			return nil, err
+		}
+	}
+}
 
-	return out, errs
+// sendErr will push the error onto the error channel without blocking. If the
+// channel already holds an error, then the new error is dropped.
+func sendErr(errCh chan<- error, err error) {
+	select {
+	case errCh <- err:
+	default:
+	}
 }
 
 // startWebWorker will start a worker upto the given specifications of the
-// configuration. The worker will listen for jobs defined by the confirugation,
-// asynchronous make web requests, and then propagate them onto the response
-// channel.
+// configuration. The worker will pop jobs from the queue, make the web
+// requests one at a time, and then propagate the responses onto the current
+// channel. Since each worker only handles one request at a time, the number of
+// workers is the maximum number of requests in flight.
 //
-// This function should be the only function that sends to the response channel
-// (i.e. "rspCh"). Because this function is meant to be used as a worker pool,
-// it is important that the response channel is not closed until all workers
-// have finished. Therefore, this function will close the response channel ONLY
-// when the worker with ID 1 has finished. This works because all workers will
-// be blocked from the "defer" method until the "jobs" channel is closed.
+// The worker will push follow-up requests for paginated resources onto the
+// queue before marking the job as done, so that the queue is not closed
+// prematurely.
 //
 // If an error is encountered, the worker will push the error onto the error
-// channel and then exit. Note that only the  most recent error will be
-// propagated to the "errCh" channel, per the rules of "errgroup.Group". Also,
-// regardless of errors encountered, the worker will always continue to process
-// jobs until the jobs channel is closed.
+// channel, or set it on the current response if the iterator continues on
+// errors. Note that only the first error will be propagated to the "errCh"
+// channel. Also, regardless of errors encountered, the worker will always
+// continue to process jobs until the queue is closed.
 func startWebWorker(ctx context.Context, cfg *webWorkerConfig) {
-	for job := range cfg.jobs {
-		go func(job webWorkerJob) {
-			defer func() {
-				cfg.done <- true
-			}()
+	for {
+		job, ok := cfg.queue.pop()
+		if !ok {
+			return
+		}
 
-			//nolint:bodyclose
-			rspCh, errCh := fetch(ctx, &job)
+		var next *Request
 
-			err := <-errCh
-			if err != nil {
-				cfg.errCh <- err
+		//nolint:bodyclose
+		rsp, err := fetch(ctx, &job)
+		if err == nil {
+			next, err = paginate(job.req, rsp, job.statuses)
+			if next != nil {
+				cfg.queue.push(cfg.queue.newJob(next))
 			}
+		}
 
-			cfg.currentCh <- &Current{
-				Response: <-rspCh,
-				writers:  job.req.writers,
-			}
-		}(job)
-	}
+		err = newRequestError(job.req, job.attempts, statusCode(rsp), err)
 
-	if cfg.id == 1 {
-		close(cfg.currentCh)
-		close(cfg.done)
-		close(cfg.errCh)
+		current := &Current{
+			Response:    rsp,
+			writers:     job.req.writers,
+			req:         job.req,
+			requestedAt: job.requestedAt,
+			receivedAt:  job.receivedAt,
+			attempts:    job.attempts,
+			next:        next != nil,
+		}
+
+		if err != nil && cfg.continueOnError {
+			current.err = err
+		} else if err != nil {
+			sendErr(cfg.errCh, err)
+		}
+
+		select {
+		case cfg.currentCh <- current:
+		case <-ctx.Done():
+			discardResponse(rsp)
+		}
+
+		cfg.queue.done(job)
 	}
 }
 
 // startWorkers will start the iterator's web workers and response workers. This
 // method can be used to lazy load the underlying buffered channels.
 func (iter *HTTPIteratorService) startWorkers(ctx context.Context) {
-	reqCount := len(iter.svc.requests)
-	iter.currentChan = make(chan *Current, reqCount)
+	ctx, cancel := context.WithCancel(ctx)
+
+	workerCount := iter.svc.inFlightLimit()
+
+	// The current channel is buffered by the number of workers, rather than
+	// the number of requests, so that the number of unread responses is
+	// bounded.
+	iter.currentChan = make(chan *Current, workerCount)
+
+	queue := newWebWorkerQueue(iter.svc.maxInFlightPerHost)
+	queue.newJob = iter.svc.newWebWorkerJob
 
-	// webWorkerJobChan is responsible for making HTTP requests and pushing
-	// the response body onto the responseWorkerJobChan. This channel is
-	// buffered to be equal to the number of requests made.
-	webWorkerJobChan := make(chan webWorkerJob, reqCount)
-	done := make(chan bool, reqCount)
+	// Enqueue the requests before starting the workers, so that the queue
+	// is closed immediately if there are no requests.
+	for _, req := range iter.svc.requests {
+		queue.push(iter.svc.newWebWorkerJob(req))
+	}
+
+	if len(iter.svc.requests) == 0 {
+		queue.close()
+	}
+
+	workers := &sync.WaitGroup{}
+	workers.Add(workerCount)
 
 	// Start the web workers.
-	for i := 0; i < runtime.NumCPU(); i++ {
-		go startWebWorker(ctx, &webWorkerConfig{
-			id:        i + 1,
-			jobs:      webWorkerJobChan,
-			currentCh: iter.currentChan,
-			done:      done,
-			errCh:     iter.errCh,
-		})
+	for i := 0; i < workerCount; i++ {
+		go func() {
+			defer workers.Done()
+
+			startWebWorker(ctx, &webWorkerConfig{
+				queue:     queue,
+				currentCh: iter.currentChan,
+				errCh:     iter.errCh,
+
+				continueOnError: iter.continueOnError,
+			})
+		}()
 	}
 
 	go func() {
-		// Send the flattened requests to the web workers for processing.
-		for _, req := range iter.svc.requests {
-			webWorkerJobChan <- webWorkerJob{
-				req:      req,
-				client:   iter.svc.client,
-				rlimiter: iter.svc.rlimiter,
-			}
+		// Stop the workers if the context is canceled or the
+		// iterator is closed.
+		select {
+		case <-ctx.Done():
+		case <-iter.done:
+			cancel()
 		}
+
+		queue.close()
 	}()
 
 	go func() {
-		// Wait for all the web workers to finish.
-		for i := 0; i < reqCount; i++ {
-			<-done
-		}
+		// Wait for all the web workers to finish before closing the
+		// channels.
+		workers.Wait()
+		cancel()
 
-		close(webWorkerJobChan)
+		close(iter.currentChan)
+		close(iter.errCh)
 	}()
 }
 
@@ -454,7 +1010,7 @@ func (iter *HTTPIteratorService) next(ctx context.Context) error {
 		case <-ctx.Done():
 			return fmt.Errorf("context canceled: %w", ctx.Err())
 		case result, ok := <-iter.currentChan:
-			if !ok || result.Response == nil {
+			if !ok || (result.Response == nil && result.err == nil) {
 				// If we don't get a response, then we know
 				// something is wrong and we need to wait for
 				// the error channel to be closed.
@@ -11,6 +11,11 @@ package gidari
 import (
 	"context"
 	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -287,6 +292,220 @@ func TestIterator(t *testing.T) {
 	})
 }
 
+// newConcurrencyServer will return a test server that records the maximum
+// number of requests it has handled concurrently.
+func newConcurrencyServer(t *testing.T, maxSeen *int32) *httptest.Server {
+	t.Helper()
+
+	var inFlight int32
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cur := atomic.AddInt32(&inFlight, 1)
+		defer atomic.AddInt32(&inFlight, -1)
+
+		for {
+			seen := atomic.LoadInt32(maxSeen)
+			if cur <= seen || atomic.CompareAndSwapInt32(maxSeen, seen, cur) {
+				break
+			}
+		}
+
+		time.Sleep(5 * time.Millisecond)
+
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `[{"x":1}]`)
+	}))
+}
+
+func TestHTTPServiceMaxInFlight(t *testing.T) {
+	t.Parallel()
+
+	for _, tcase := range []struct {
+		name        string
+		reqCount    int
+		maxInFlight int
+		perHost     int
+
+		// serverCount is the number of hosts to distribute the
+		// requests over.
+		serverCount int
+
+		// wantMax is the maximum number of concurrent requests that
+		// any one server may observe.
+		wantMax int32
+	}{
+		{
+			name:        "single in flight",
+			reqCount:    20,
+			maxInFlight: 1,
+			serverCount: 1,
+			wantMax:     1,
+		},
+		{
+			name:        "many in flight",
+			reqCount:    100,
+			maxInFlight: 4,
+			serverCount: 1,
+			wantMax:     4,
+		},
+		{
+			name:        "per host limit",
+			reqCount:    40,
+			maxInFlight: 8,
+			perHost:     2,
+			serverCount: 2,
+			wantMax:     2,
+		},
+	} {
+		tcase := tcase
+
+		t.Run(tcase.name, func(t *testing.T) {
+			t.Parallel()
+
+			maxSeen := make([]int32, tcase.serverCount)
+			servers := make([]*httptest.Server, tcase.serverCount)
+
+			for i := range servers {
+				servers[i] = newConcurrencyServer(t, &maxSeen[i])
+				defer servers[i].Close()
+			}
+
+			svc, err := NewService(context.Background())
+			if err != nil {
+				t.Fatalf("failed to create service: %v", err)
+			}
+
+			writer := &mockListWriter{}
+
+			for i := 0; i < tcase.reqCount; i++ {
+				url := servers[i%tcase.serverCount].URL
+
+				req, err := http.NewRequestWithContext(context.Background(), http.MethodGet, url, nil)
+				if err != nil {
+					t.Fatalf("failed to create request: %v", err)
+				}
+
+				svc.HTTP.Requests(NewHTTPRequest(req, WithWriters(writer)))
+			}
+
+			svc.HTTP.
+				MaxInFlight(tcase.maxInFlight).
+				MaxInFlightPerHost(tcase.perHost)
+
+			if err := svc.HTTP.Store(context.Background()); err != nil {
+				t.Fatalf("failed to store: %v", err)
+			}
+
+			if writer.count != tcase.reqCount {
+				t.Errorf("expected %d writes, got %d", tcase.reqCount, writer.count)
+			}
+
+			for i, seen := range maxSeen {
+				if seen > tcase.wantMax {
+					t.Errorf("server %d saw %d concurrent requests, want at most %d",
+						i, seen, tcase.wantMax)
+				}
+			}
+		})
+	}
+}
+
+func TestWebWorkerQueue(t *testing.T) {
+	t.Parallel()
+
+	newJob := func(url string) webWorkerJob {
+		req, _ := http.NewRequestWithContext(context.Background(), http.MethodGet, url, nil)
+
+		return webWorkerJob{req: &Request{http: req}}
+	}
+
+	t.Run("closes when no jobs are pending", func(t *testing.T) {
+		t.Parallel()
+
+		queue := newWebWorkerQueue(0)
+		queue.push(newJob("http://a"))
+
+		job, ok := queue.pop()
+		if !ok {
+			t.Fatal("expected a job")
+		}
+
+		// A follow-up job pushed before "done" keeps the queue open.
+		queue.push(newJob("http://a?page=2"))
+		queue.done(job)
+
+		job, ok = queue.pop()
+		if !ok {
+			t.Fatal("expected a follow-up job")
+		}
+
+		queue.done(job)
+
+		if _, ok := queue.pop(); ok {
+			t.Fatal("expected the queue to be closed")
+		}
+	})
+
+	t.Run("skips hosts at their limit", func(t *testing.T) {
+		t.Parallel()
+
+		queue := newWebWorkerQueue(1)
+		queue.push(newJob("http://a/1"))
+		queue.push(newJob("http://a/2"))
+		queue.push(newJob("http://b/1"))
+
+		first, _ := queue.pop()
+		second, _ := queue.pop()
+
+		if got := second.req.http.URL.Host; got != "b" {
+			t.Fatalf("expected job for host b, got %q", got)
+		}
+
+		popped := make(chan webWorkerJob, 1)
+
+		go func() {
+			job, _ := queue.pop()
+			popped <- job
+		}()
+
+		// The remaining job for host "a" is blocked until the first
+		// job is done.
+		select {
+		case <-popped:
+			t.Fatal("expected pop to block")
+		case <-time.After(10 * time.Millisecond):
+		}
+
+		queue.done(first)
+
+		if got := (<-popped).req.http.URL.String(); got != "http://a/2" {
+			t.Fatalf("expected http://a/2, got %q", got)
+		}
+	})
+
+	t.Run("close drops queued jobs", func(t *testing.T) {
+		t.Parallel()
+
+		queue := newWebWorkerQueue(0)
+
+		wg := &sync.WaitGroup{}
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			if _, ok := queue.pop(); ok {
+				t.Error("expected the queue to be closed")
+			}
+		}()
+
+		queue.close()
+		queue.push(newJob("http://a"))
+
+		wg.Wait()
+	})
+}
+
 func BenchmarkIterator(b *testing.B) {
 	// Create a new service.
 	svc := newMockService(mockServiceOptions{
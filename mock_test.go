@@ -210,6 +210,55 @@ func (m *mockListWriter) Write(_ context.Context, val *structpb.ListValue) error
 	return nil
 }
 
+type mockMetaListWriter struct {
+	mockListWriter
+
+	metas []ListMeta
+}
+
+func (m *mockMetaListWriter) WriteWithMeta(ctx context.Context, val *structpb.ListValue, meta *ListMeta) error {
+	if err := m.Write(ctx, val); err != nil {
+		return err
+	}
+
+	m.countMu.Lock()
+	defer m.countMu.Unlock()
+
+	m.metas = append(m.metas, *meta)
+
+	return nil
+}
+
+type mockFlushCloseWriter struct {
+	mockListWriter
+
+	flushes  int
+	closes   int
+	flushErr error
+
+	// written is the number of writes when the writer was flushed.
+	written int
+}
+
+func (m *mockFlushCloseWriter) Flush() error {
+	m.countMu.Lock()
+	defer m.countMu.Unlock()
+
+	m.flushes++
+	m.written = m.count
+
+	return m.flushErr
+}
+
+func (m *mockFlushCloseWriter) Close() error {
+	m.countMu.Lock()
+	defer m.countMu.Unlock()
+
+	m.closes++
+
+	return nil
+}
+
 type mockConnBlocker struct{}
 
 func (m *mockConnBlocker) Read(b []byte) (int, error) {
@@ -0,0 +1,66 @@
+// Copyright 2023 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+
+package gidari
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+
+	structpb "google.golang.org/protobuf/types/known/structpb"
+)
+
+// ndjsonMediaTypes are the media types of newline-delimited JSON, also known
+// as JSON Lines.
+var ndjsonMediaTypes = []string{
+	"application/x-ndjson",
+	"application/ndjson",
+	"application/jsonl",
+	"application/x-jsonlines",
+}
+
+// decodeFuncNDJSON will decode newline-delimited JSON line by line, flushing
+// the values of each line as it is decoded. Blank lines are skipped. Lines are
+// not limited in length.
+func decodeFuncNDJSON(r io.Reader) StreamDecodeFunc {
+	return func(flush func(list *structpb.ListValue) error) error {
+		reader := bufio.NewReader(r)
+
+		for lineNum := 1; ; lineNum++ {
+			line, readErr := reader.ReadBytes('\n')
+			if readErr != nil && !errors.Is(readErr, io.EOF) {
+				return fmt.Errorf("failed to read ndjson line %d: %w", lineNum, readErr)
+			}
+
+			if lineNum == 1 {
+				line = bytes.TrimPrefix(line, []byte(utf8BOM))
+			}
+
+			if line = bytes.TrimSpace(line); len(line) > 0 {
+				val := &structpb.Value{}
+				if err := val.UnmarshalJSON(line); err != nil {
+					return fmt.Errorf("failed to decode ndjson line %d: %w", lineNum, err)
+				}
+
+				list := &structpb.ListValue{}
+				addValue(list, val)
+
+				if err := flush(list); err != nil {
+					return err
+				}
+			}
+
+			if readErr != nil {
+				return nil
+			}
+		}
+	}
+}
@@ -0,0 +1,157 @@
+// Copyright 2023 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+
+package gidari
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	structpb "google.golang.org/protobuf/types/known/structpb"
+)
+
+func TestDecodeFuncNDJSON(t *testing.T) {
+	t.Parallel()
+
+	for _, tcase := range []struct {
+		name   string
+		data   string
+		size   int
+		chunks []string
+		err    string
+	}{
+		{
+			name:   "empty data",
+			chunks: []string{`[]`},
+		},
+		{
+			name:   "single line without newline",
+			data:   `{"x":1}`,
+			chunks: []string{`[{"x":1}]`},
+		},
+		{
+			name:   "blank lines and carriage returns",
+			data:   "\r\n{\"x\":1}\r\n\n  \n{\"x\":2}\r\n\n",
+			chunks: []string{`[{"x":1},{"x":2}]`},
+		},
+		{
+			name:   "byte order mark",
+			data:   "\ufeff{\"x\":1}\n",
+			chunks: []string{`[{"x":1}]`},
+		},
+		{
+			name:   "chunks",
+			data:   "{\"x\":1}\n{\"x\":2}\n{\"x\":3}\n{\"x\":4}\n{\"x\":5}\n",
+			size:   2,
+			chunks: []string{`[{"x":1},{"x":2}]`, `[{"x":3},{"x":4}]`, `[{"x":5}]`},
+		},
+		{
+			name:   "chunks without remainder",
+			data:   "{\"x\":1}\n{\"x\":2}\n",
+			size:   2,
+			chunks: []string{`[{"x":1},{"x":2}]`},
+		},
+		{
+			name: "malformed line",
+			data: "{\"x\":1}\n\n{\"x\":\n",
+			err:  "line 3",
+		},
+		{
+			name:   "scalar line",
+			data:   "{\"x\":1}\n2\n",
+			chunks: []string{`[{"x":1},2]`},
+		},
+	} {
+		tcase := tcase
+
+		t.Run(tcase.name, func(t *testing.T) {
+			t.Parallel()
+
+			var chunks []string
+
+			bat := newBatcher(batchSize{values: tcase.size}, func(list *structpb.ListValue) error {
+				data, err := list.MarshalJSON()
+				if err != nil {
+					return fmt.Errorf("failed to marshal list: %w", err)
+				}
+
+				chunks = append(chunks, strings.ReplaceAll(string(data), " ", ""))
+
+				return nil
+			})
+
+			err := decodeFuncNDJSON(strings.NewReader(tcase.data))(bat.add)
+			if err == nil {
+				err = bat.close()
+			}
+
+			if tcase.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tcase.err) {
+					t.Fatalf("expected error containing %q, got %v", tcase.err, err)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if strings.Join(chunks, "\n") != strings.Join(tcase.chunks, "\n") {
+				t.Fatalf("chunks = %v, want %v", chunks, tcase.chunks)
+			}
+		})
+	}
+}
+
+func TestHTTPServiceStoreNDJSON(t *testing.T) {
+	t.Parallel()
+
+	const lineCount = defaultChunkSize + 1
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/x-ndjson")
+
+		for i := 0; i < lineCount; i++ {
+			fmt.Fprintf(w, "{\"id\":%d}\n", i)
+		}
+	}))
+	defer server.Close()
+
+	svc, err := NewService(context.Background())
+	if err != nil {
+		t.Fatalf("failed to create service: %v", err)
+	}
+
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodGet, server.URL, nil)
+	if err != nil {
+		t.Fatalf("failed to create request: %v", err)
+	}
+
+	writer := &mockListWriter{}
+
+	svc.HTTP.Client(server.Client()).Requests(NewHTTPRequest(req, WithWriters(writer)))
+
+	if err := svc.HTTP.Store(context.Background()); err != nil {
+		t.Fatalf("failed to store: %v", err)
+	}
+
+	// The response should be written in two chunks.
+	if writer.count != 2 {
+		t.Fatalf("expected 2 writes, got %d", writer.count)
+	}
+
+	assertSocketWrites(t, []ListWriter{writer}, [][]byte{
+		writer.data[0],
+		[]byte(fmt.Sprintf(`[{"id":%d}]`, lineCount-1)),
+	})
+}
@@ -0,0 +1,386 @@
+// Copyright 2023 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+
+package gidari
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// ErrInvalidCursor is returned when a paginator is unable to read the cursor
+// from a response.
+var ErrInvalidCursor = fmt.Errorf("invalid cursor")
+
+// Paginator is used to determine the follow-up request for a paginated
+// resource. Given the request and the response of the current page, the
+// paginator returns the request for the next page. If there are no more pages,
+// then the paginator MUST return a nil request.
+//
+// Paginators that inspect the response body are responsible for leaving the
+// body readable for the decoders, see the "peekBody" function for an example.
+type Paginator interface {
+	Next(req *http.Request, rsp *http.Response) (*http.Request, error)
+}
+
+// PaginatorFunc is an adapter to allow the use of ordinary functions as
+// Paginators.
+type PaginatorFunc func(req *http.Request, rsp *http.Response) (*http.Request, error)
+
+// Next calls fn(req, rsp).
+func (fn PaginatorFunc) Next(req *http.Request, rsp *http.Response) (*http.Request, error) {
+	return fn(req, rsp)
+}
+
+// WithPaginator will set the paginator used by the HTTP Service to make
+// follow-up requests for the request. Each follow-up request inherits the
+// options of the request that produced it, including the writers.
+func WithPaginator(paginator Paginator) RequestOption {
+	return func(req *Request) {
+		req.paginator = paginator
+	}
+}
+
+// paginate will return the follow-up request for the given request and
+// response, if any. A follow-up request is only made for successful responses.
+func paginate(req *Request, rsp *http.Response, statuses *StatusPolicy) (*Request, error) {
+	if req.paginator == nil || rsp == nil || statuses.class(rsp.StatusCode) != StatusSuccess {
+		return nil, nil
+	}
+
+	nextHTTP, err := req.paginator.Next(req.http, rsp)
+	if err != nil {
+		return nil, fmt.Errorf("failed to paginate: %w", err)
+	}
+
+	if nextHTTP == nil {
+		return nil, nil
+	}
+
+	// Guard against paginators that would request the same pages forever,
+	// e.g. a cursor that cycles between pages. The first page does not
+	// share its URLs, since the same request may be stored more than once.
+	visited := req.visited
+	if visited == nil {
+		visited = map[string]bool{req.http.URL.String(): true}
+	}
+
+	if visited[nextHTTP.URL.String()] {
+		return nil, nil
+	}
+
+	visited[nextHTTP.URL.String()] = true
+
+	next := *req
+	next.http = nextHTTP
+	next.page++
+	next.root = req.rootRequest()
+	next.visited = visited
+
+	return &next, nil
+}
+
+// peekBody will read the entire response body and then replace it with an
+// in-memory copy, so that it can be read again by the decoders.
+func peekBody(rsp *http.Response) ([]byte, error) {
+	if rsp.Body == nil {
+		return nil, nil
+	}
+
+	body, err := io.ReadAll(rsp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response body: %w", err)
+	}
+
+	if err := rsp.Body.Close(); err != nil {
+		return nil, fmt.Errorf("failed to close response body: %w", err)
+	}
+
+	rsp.Body = io.NopCloser(bytes.NewReader(body))
+
+	return body, nil
+}
+
+// nextRequest will clone the request with the given URL. If the request has a
+// body, then it is replayed using "GetBody".
+func nextRequest(req *http.Request, next *url.URL) (*http.Request, error) {
+	clone := req.Clone(req.Context())
+	clone.URL = next
+	clone.Host = ""
+
+	if req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get request body: %w", err)
+		}
+
+		clone.Body = body
+	}
+
+	return clone, nil
+}
+
+// withQueryParam will return a copy of the URL with the query parameter set to
+// the given value.
+func withQueryParam(u *url.URL, param, value string) *url.URL {
+	next := *u
+
+	query := next.Query()
+	query.Set(param, value)
+	next.RawQuery = query.Encode()
+
+	return &next
+}
+
+type linkHeaderPaginator struct{}
+
+// NewLinkHeaderPaginator will return a paginator that follows the RFC 5988
+// "Link" header, requesting the URL with the relation type "next" until there
+// is no such link.
+func NewLinkHeaderPaginator() Paginator {
+	return &linkHeaderPaginator{}
+}
+
+// parseLinkHeader will return the target of the link with the given relation
+// type, if any.
+func parseLinkHeader(header, rel string) string {
+	for _, link := range strings.Split(header, ",") {
+		segments := strings.Split(link, ";")
+
+		target := strings.TrimSpace(segments[0])
+		if !strings.HasPrefix(target, "<") || !strings.HasSuffix(target, ">") {
+			continue
+		}
+
+		for _, param := range segments[1:] {
+			key, val, ok := strings.Cut(strings.TrimSpace(param), "=")
+			if !ok || !strings.EqualFold(strings.TrimSpace(key), "rel") {
+				continue
+			}
+
+			// The "rel" parameter may contain a space-separated
+			// list of relation types.
+			for _, typ := range strings.Fields(strings.Trim(val, `"`)) {
+				if strings.EqualFold(typ, rel) {
+					return strings.Trim(target, "<>")
+				}
+			}
+		}
+	}
+
+	return ""
+}
+
+// Next will return the request for the "next" link in the response's "Link"
+// header.
+func (p *linkHeaderPaginator) Next(req *http.Request, rsp *http.Response) (*http.Request, error) {
+	link := parseLinkHeader(rsp.Header.Get("Link"), "next")
+	if link == "" {
+		return nil, nil
+	}
+
+	next, err := req.URL.Parse(link)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse link header: %w", err)
+	}
+
+	return nextRequest(req, next)
+}
+
+type bodyFieldPaginator struct {
+	field string
+	param string
+}
+
+// NewCursorPaginator will return a paginator that reads a cursor from the JSON
+// response body and sets it as a query parameter on the next request. The
+// field is a dot-separated path to the cursor, e.g. "meta.next_cursor". If
+// the cursor is an absolute URL, then the URL is requested as-is. Pagination
+// stops when the cursor is empty, null or missing.
+func NewCursorPaginator(field, param string) Paginator {
+	return &bodyFieldPaginator{field: field, param: param}
+}
+
+// NewPageTokenPaginator will return a paginator that reads a page token from
+// the JSON response body and sets it as a query parameter on the next request.
+// If the field and param are empty, then they default to "nextPageToken" and
+// "pageToken" respectively. Pagination stops when the token is empty, null or
+// missing.
+func NewPageTokenPaginator(field, param string) Paginator {
+	if field == "" {
+		field = "nextPageToken"
+	}
+
+	if param == "" {
+		param = "pageToken"
+	}
+
+	return &bodyFieldPaginator{field: field, param: param}
+}
+
+// lookupField will return the value at the dot-separated path in the decoded
+// JSON data.
+func lookupField(data interface{}, path string) (interface{}, bool) {
+	for _, key := range strings.Split(path, ".") {
+		obj, ok := data.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+
+		if data, ok = obj[key]; !ok {
+			return nil, false
+		}
+	}
+
+	return data, true
+}
+
+// Next will return the request with the cursor from the response body.
+func (p *bodyFieldPaginator) Next(req *http.Request, rsp *http.Response) (*http.Request, error) {
+	body, err := peekBody(rsp)
+	if err != nil {
+		return nil, err
+	}
+
+	// Decode numbers as json.Number so that integer cursors do not lose
+	// precision as float64.
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+
+	var data interface{}
+	if err := decoder.Decode(&data); err != nil {
+		return nil, fmt.Errorf("failed to decode cursor: %w", err)
+	}
+
+	val, ok := lookupField(data, p.field)
+	if !ok || val == nil {
+		return nil, nil
+	}
+
+	var cursor string
+
+	switch val := val.(type) {
+	case string:
+		cursor = val
+	case json.Number:
+		cursor = val.String()
+	default:
+		return nil, fmt.Errorf("%w: %q is %T", ErrInvalidCursor, p.field, val)
+	}
+
+	if cursor == "" {
+		return nil, nil
+	}
+
+	// If the cursor is a URL, then there is no need to set the query
+	// parameter.
+	if next, err := url.Parse(cursor); err == nil && next.IsAbs() {
+		return nextRequest(req, next)
+	}
+
+	return nextRequest(req, withQueryParam(req.URL, p.param, cursor))
+}
+
+type offsetPaginator struct {
+	field       string
+	offsetParam string
+	limitParam  string
+	limit       int
+}
+
+// NewOffsetPaginator will return a paginator that increments the offset query
+// parameter by the limit for every page. The response body must be a JSON
+// array, pagination stops when a page contains fewer records than the limit.
+func NewOffsetPaginator(offsetParam, limitParam string, limit int) Paginator {
+	return &offsetPaginator{
+		offsetParam: offsetParam,
+		limitParam:  limitParam,
+		limit:       limit,
+	}
+}
+
+// NewOffsetFieldPaginator will return a paginator like "NewOffsetPaginator"
+// for response bodies that are JSON objects with the records in an array at
+// the field, a dot-separated path such as "data". Pagination also stops when
+// the field is null or missing.
+func NewOffsetFieldPaginator(field, offsetParam, limitParam string, limit int) Paginator {
+	return &offsetPaginator{
+		field:       field,
+		offsetParam: offsetParam,
+		limitParam:  limitParam,
+		limit:       limit,
+	}
+}
+
+// count will return the number of records in the response body.
+func (p *offsetPaginator) count(body []byte) (int, error) {
+	if len(bytes.TrimSpace(body)) == 0 {
+		return 0, nil
+	}
+
+	if p.field == "" {
+		var records []json.RawMessage
+		if err := json.Unmarshal(body, &records); err != nil {
+			return 0, fmt.Errorf("failed to decode records: %w", err)
+		}
+
+		return len(records), nil
+	}
+
+	var data interface{}
+	if err := json.Unmarshal(body, &data); err != nil {
+		return 0, fmt.Errorf("failed to decode records: %w", err)
+	}
+
+	val, ok := lookupField(data, p.field)
+	if !ok || val == nil {
+		return 0, nil
+	}
+
+	records, ok := val.([]interface{})
+	if !ok {
+		return 0, fmt.Errorf("%w: %q is %T, not an array", ErrInvalidCursor, p.field, val)
+	}
+
+	return len(records), nil
+}
+
+// Next will return the request for the next offset.
+func (p *offsetPaginator) Next(req *http.Request, rsp *http.Response) (*http.Request, error) {
+	if p.limit <= 0 {
+		return nil, nil
+	}
+
+	body, err := peekBody(rsp)
+	if err != nil {
+		return nil, err
+	}
+
+	count, err := p.count(body)
+	if err != nil || count < p.limit {
+		return nil, err
+	}
+
+	offset := 0
+	if val := req.URL.Query().Get(p.offsetParam); val != "" {
+		if offset, err = strconv.Atoi(val); err != nil {
+			return nil, fmt.Errorf("failed to parse offset: %w", err)
+		}
+	}
+
+	next := withQueryParam(req.URL, p.offsetParam, strconv.Itoa(offset+p.limit))
+	next = withQueryParam(next, p.limitParam, strconv.Itoa(p.limit))
+
+	return nextRequest(req, next)
+}
@@ -0,0 +1,330 @@
+// Copyright 2023 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+
+package gidari
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+)
+
+func TestParseLinkHeader(t *testing.T) {
+	t.Parallel()
+
+	for _, tcase := range []struct {
+		name   string
+		header string
+		rel    string
+		want   string
+	}{
+		{
+			name: "empty",
+			rel:  "next",
+		},
+		{
+			name:   "single link",
+			header: `<https://api.example.com/items?page=2>; rel="next"`,
+			rel:    "next",
+			want:   "https://api.example.com/items?page=2",
+		},
+		{
+			name: "multiple links",
+			header: `<https://api.example.com/items?page=1>; rel="prev", ` +
+				`<https://api.example.com/items?page=3>; rel="next", ` +
+				`<https://api.example.com/items?page=9>; rel="last"`,
+			rel:  "next",
+			want: "https://api.example.com/items?page=3",
+		},
+		{
+			name:   "multiple relation types",
+			header: `</items?page=2>; rel="next last"`,
+			rel:    "next",
+			want:   "/items?page=2",
+		},
+		{
+			name:   "unquoted relation type",
+			header: `</items?page=2>; rel=next`,
+			rel:    "next",
+			want:   "/items?page=2",
+		},
+		{
+			name:   "no next link",
+			header: `<https://api.example.com/items?page=1>; rel="prev"`,
+			rel:    "next",
+		},
+	} {
+		tcase := tcase
+
+		t.Run(tcase.name, func(t *testing.T) {
+			t.Parallel()
+
+			if got := parseLinkHeader(tcase.header, tcase.rel); got != tcase.want {
+				t.Fatalf("parseLinkHeader() = %q, want %q", got, tcase.want)
+			}
+		})
+	}
+}
+
+func TestPaginatorNext(t *testing.T) {
+	t.Parallel()
+
+	for _, tcase := range []struct {
+		name      string
+		paginator Paginator
+		url       string
+		header    http.Header
+		body      string
+
+		// want is the URL of the next request, if empty then no next
+		// request is expected.
+		want string
+		err  bool
+	}{
+		{
+			name:      "link header",
+			paginator: NewLinkHeaderPaginator(),
+			url:       "https://api.example.com/items",
+			header:    http.Header{"Link": []string{`</items?page=2>; rel="next"`}},
+			want:      "https://api.example.com/items?page=2",
+		},
+		{
+			name:      "link header without next",
+			paginator: NewLinkHeaderPaginator(),
+			url:       "https://api.example.com/items",
+		},
+		{
+			name:      "cursor",
+			paginator: NewCursorPaginator("meta.next_cursor", "cursor"),
+			url:       "https://api.example.com/items?limit=2",
+			body:      `{"data":[{"x":1}],"meta":{"next_cursor":"abc"}}`,
+			want:      "https://api.example.com/items?cursor=abc&limit=2",
+		},
+		{
+			name:      "cursor as url",
+			paginator: NewCursorPaginator("next", "cursor"),
+			url:       "https://api.example.com/items",
+			body:      `{"results":[{"x":1}],"next":"https://api.example.com/items?page=2"}`,
+			want:      "https://api.example.com/items?page=2",
+		},
+		{
+			name:      "large integer cursor",
+			paginator: NewCursorPaginator("next", "cursor"),
+			url:       "https://api.example.com/items",
+			body:      `{"results":[{"x":1}],"next":12345678901234567891}`,
+			want:      "https://api.example.com/items?cursor=12345678901234567891",
+		},
+		{
+			name:      "null cursor",
+			paginator: NewCursorPaginator("next", "cursor"),
+			url:       "https://api.example.com/items",
+			body:      `{"results":[{"x":1}],"next":null}`,
+		},
+		{
+			name:      "page token",
+			paginator: NewPageTokenPaginator("", ""),
+			url:       "https://api.example.com/items",
+			body:      `{"items":[{"x":1}],"nextPageToken":"t1"}`,
+			want:      "https://api.example.com/items?pageToken=t1",
+		},
+		{
+			name:      "empty page token",
+			paginator: NewPageTokenPaginator("", ""),
+			url:       "https://api.example.com/items",
+			body:      `{"items":[{"x":1}],"nextPageToken":""}`,
+		},
+		{
+			name:      "offset",
+			paginator: NewOffsetPaginator("offset", "limit", 2),
+			url:       "https://api.example.com/items?offset=4&limit=2",
+			body:      `[{"x":1},{"x":2}]`,
+			want:      "https://api.example.com/items?limit=2&offset=6",
+		},
+		{
+			name:      "offset on last page",
+			paginator: NewOffsetPaginator("offset", "limit", 2),
+			url:       "https://api.example.com/items?offset=4&limit=2",
+			body:      `[{"x":1}]`,
+		},
+		{
+			name:      "offset with envelope",
+			paginator: NewOffsetPaginator("offset", "limit", 2),
+			url:       "https://api.example.com/items?offset=4&limit=2",
+			body:      `{"data":[{"x":1},{"x":2}]}`,
+			err:       true,
+		},
+		{
+			name:      "offset field",
+			paginator: NewOffsetFieldPaginator("data", "offset", "limit", 2),
+			url:       "https://api.example.com/items?offset=4&limit=2",
+			body:      `{"data":[{"x":1},{"x":2}],"total":9}`,
+			want:      "https://api.example.com/items?limit=2&offset=6",
+		},
+		{
+			name:      "offset field on last page",
+			paginator: NewOffsetFieldPaginator("data", "offset", "limit", 2),
+			url:       "https://api.example.com/items?offset=8&limit=2",
+			body:      `{"data":[{"x":1}],"total":9}`,
+		},
+		{
+			name:      "offset field missing",
+			paginator: NewOffsetFieldPaginator("data", "offset", "limit", 2),
+			url:       "https://api.example.com/items?offset=8&limit=2",
+			body:      `{"total":9}`,
+		},
+		{
+			name:      "offset field not an array",
+			paginator: NewOffsetFieldPaginator("data", "offset", "limit", 2),
+			url:       "https://api.example.com/items?offset=8&limit=2",
+			body:      `{"data":{"x":1}}`,
+			err:       true,
+		},
+	} {
+		tcase := tcase
+
+		t.Run(tcase.name, func(t *testing.T) {
+			t.Parallel()
+
+			req, err := http.NewRequestWithContext(context.Background(), http.MethodGet, tcase.url, nil)
+			if err != nil {
+				t.Fatalf("failed to create request: %v", err)
+			}
+
+			header := tcase.header
+			if header == nil {
+				header = http.Header{}
+			}
+
+			rsp := &http.Response{
+				StatusCode: http.StatusOK,
+				Header:     header,
+				Body:       io.NopCloser(bytes.NewBufferString(tcase.body)),
+				Request:    req,
+			}
+
+			next, err := paginate(&Request{http: req, paginator: tcase.paginator}, rsp, nil)
+			if (err != nil) != tcase.err {
+				t.Fatalf("expected error %v, got %v", tcase.err, err)
+			}
+
+			if tcase.err {
+				return
+			}
+
+			if tcase.want == "" {
+				if next != nil {
+					t.Fatalf("expected no next request, got %q", next.http.URL)
+				}
+
+				return
+			}
+
+			if next == nil {
+				t.Fatalf("expected next request %q, got nil", tcase.want)
+			}
+
+			if got := next.http.URL.String(); got != tcase.want {
+				t.Fatalf("next request = %q, want %q", got, tcase.want)
+			}
+
+			// The body must still be readable by the decoders.
+			body, err := io.ReadAll(rsp.Body)
+			if err != nil {
+				t.Fatalf("failed to read body: %v", err)
+			}
+
+			if string(body) != tcase.body {
+				t.Fatalf("body = %q, want %q", body, tcase.body)
+			}
+		})
+	}
+}
+
+func TestPaginateCycle(t *testing.T) {
+	t.Parallel()
+
+	// The cursor cycles from page a to b and back to a.
+	cycle := map[string]string{"a": "b", "b": "a"}
+
+	paginator := PaginatorFunc(func(req *http.Request, _ *http.Response) (*http.Request, error) {
+		return nextRequest(req, withQueryParam(req.URL, "page", cycle[req.URL.Query().Get("page")]))
+	})
+
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodGet,
+		"https://api.example.com/items?page=a", nil)
+	if err != nil {
+		t.Fatalf("failed to create request: %v", err)
+	}
+
+	var pages []string
+
+	for page := &(Request{http: req, paginator: paginator}); page != nil; {
+		pages = append(pages, page.http.URL.Query().Get("page"))
+
+		rsp := &http.Response{StatusCode: http.StatusOK, Header: http.Header{}, Request: page.http}
+
+		if page, err = paginate(page, rsp, nil); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if len(pages) > len(cycle) {
+			t.Fatalf("expected pagination to stop, got pages %v", pages)
+		}
+	}
+
+	if fmt.Sprint(pages) != "[a b]" {
+		t.Fatalf("pages = %v, want [a b]", pages)
+	}
+}
+
+func TestHTTPServiceStorePagination(t *testing.T) {
+	t.Parallel()
+
+	const pageCount = 5
+
+	// Create a server that paginates using the "Link" header.
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+		if page < pageCount {
+			w.Header().Set("Link", fmt.Sprintf(`</items?page=%d>; rel="next"`, page+1))
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `[{"page":%d},{"page":%d}]`, page, page)
+	}))
+	defer server.Close()
+
+	svc, err := NewService(context.Background())
+	if err != nil {
+		t.Fatalf("failed to create service: %v", err)
+	}
+
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodGet, server.URL+"/items?page=1", nil)
+	if err != nil {
+		t.Fatalf("failed to create request: %v", err)
+	}
+
+	writer := &mockListWriter{}
+
+	svc.HTTP.Client(server.Client()).Requests(NewHTTPRequest(req,
+		WithWriters(writer),
+		WithPaginator(NewLinkHeaderPaginator())))
+
+	if err := svc.HTTP.Store(context.Background()); err != nil {
+		t.Fatalf("failed to store: %v", err)
+	}
+
+	if writer.count != pageCount {
+		t.Fatalf("expected %d writes, got %d", pageCount, writer.count)
+	}
+}
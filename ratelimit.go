@@ -0,0 +1,350 @@
+// Copyright 2023 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+
+package gidari
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// defaultSlowdown is the default fraction of the rate limit below which the
+// adaptive limiter starts spreading requests over the remaining window.
+const defaultSlowdown = 0.1
+
+// WithRateLimiter will set a rate limiter for the request. This limiter takes
+// precedence over the limiters set on the HTTP Service. Follow-up requests for
+// paginated resources share the limiter of the request that produced them.
+func WithRateLimiter(rlimiter *rate.Limiter) RequestOption {
+	return func(req *Request) {
+		req.rlimiter = rlimiter
+	}
+}
+
+// RateLimiterKeyFunc returns the key used to select a rate limiter for a
+// request from a RateLimiterRegistry.
+type RateLimiterKeyFunc func(*http.Request) string
+
+// HostKey is a RateLimiterKeyFunc that keys requests by their host.
+func HostKey(req *http.Request) string {
+	return req.URL.Host
+}
+
+// RateLimiterRegistry is a set of rate limiters keyed by a user-defined
+// function of the request, e.g. by host. This allows a single HTTP Service to
+// respect the rate limits of multiple web APIs.
+type RateLimiterRegistry struct {
+	keyFunc    RateLimiterKeyFunc
+	newLimiter func(key string) *rate.Limiter
+
+	mu       sync.Mutex
+	limiters map[string]*rate.Limiter
+}
+
+// NewRateLimiterRegistry will create a new registry that selects rate limiters
+// using the given key function. If the key function is nil, then requests are
+// keyed by their host.
+func NewRateLimiterRegistry(keyFunc RateLimiterKeyFunc) *RateLimiterRegistry {
+	if keyFunc == nil {
+		keyFunc = HostKey
+	}
+
+	return &RateLimiterRegistry{
+		keyFunc:  keyFunc,
+		limiters: make(map[string]*rate.Limiter),
+	}
+}
+
+// Set will set the rate limiter for the given key.
+func (reg *RateLimiterRegistry) Set(key string, rlimiter *rate.Limiter) *RateLimiterRegistry {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+
+	reg.limiters[key] = rlimiter
+
+	return reg
+}
+
+// Default sets an optional function to create a rate limiter for keys that
+// have not been set. The limiter is created once per key and then re-used for
+// all subsequent requests with that key.
+func (reg *RateLimiterRegistry) Default(newLimiter func(key string) *rate.Limiter) *RateLimiterRegistry {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+
+	reg.newLimiter = newLimiter
+
+	return reg
+}
+
+// Limiter will return the rate limiter for the request, or nil if there is no
+// limiter for the request's key.
+func (reg *RateLimiterRegistry) Limiter(req *http.Request) *rate.Limiter {
+	if reg == nil {
+		return nil
+	}
+
+	key := reg.keyFunc(req)
+
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+
+	if rlimiter, ok := reg.limiters[key]; ok {
+		return rlimiter
+	}
+
+	if reg.newLimiter == nil {
+		return nil
+	}
+
+	rlimiter := reg.newLimiter(key)
+	reg.limiters[key] = rlimiter
+
+	return rlimiter
+}
+
+// rateLimitQuota is the state of a rate limit as advertised by a web API.
+type rateLimitQuota struct {
+	limit     int
+	remaining int
+	reset     time.Time
+
+	// next is the earliest time at which the next request may be made
+	// when requests are being spread over the remaining window.
+	next time.Time
+}
+
+// AdaptiveLimiter is a rate limiter that paces requests using the rate limit
+// headers of the responses, rather than a static rate. Once the remaining
+// quota for a key falls below a fraction of the limit, requests are spread
+// evenly over the time until the quota resets. If the quota is exhausted, then
+// requests are paused until the reset. Once the reset time has passed, requests
+// are no longer delayed.
+//
+// The following headers are supported:
+//
+//   - X-RateLimit-Limit, X-RateLimit-Remaining and X-RateLimit-Reset, where the
+//     reset may be a Unix timestamp or a number of seconds
+//   - X-Rate-Limit-Limit, X-Rate-Limit-Remaining and X-Rate-Limit-Reset
+//   - RateLimit-Limit, RateLimit-Remaining, RateLimit-Reset and
+//     RateLimit-Policy from the IETF "RateLimit header fields" draft
+//   - RateLimit, e.g. "limit=100, remaining=50, reset=5"
+//   - Retry-After on 429 (Too Many Requests) responses
+type AdaptiveLimiter struct {
+	keyFunc  RateLimiterKeyFunc
+	slowdown float64
+	now      func() time.Time
+
+	mu     sync.Mutex
+	quotas map[string]*rateLimitQuota
+}
+
+// NewAdaptiveLimiter will create a new adaptive limiter that tracks the rate
+// limit quota per key. If the key function is nil, then requests are keyed by
+// their host.
+func NewAdaptiveLimiter(keyFunc RateLimiterKeyFunc) *AdaptiveLimiter {
+	if keyFunc == nil {
+		keyFunc = HostKey
+	}
+
+	return &AdaptiveLimiter{
+		keyFunc:  keyFunc,
+		slowdown: defaultSlowdown,
+		now:      time.Now,
+		quotas:   make(map[string]*rateLimitQuota),
+	}
+}
+
+// Slowdown sets the fraction of the rate limit below which requests are
+// spread over the time until the quota resets. The default is 0.1, i.e. 10% of
+// the limit. If the limit is unknown, then requests are only paused once the
+// quota is exhausted.
+func (lim *AdaptiveLimiter) Slowdown(fraction float64) *AdaptiveLimiter {
+	lim.mu.Lock()
+	defer lim.mu.Unlock()
+
+	lim.slowdown = fraction
+
+	return lim
+}
+
+// Wait will block until the request may be made, or the context is done.
+func (lim *AdaptiveLimiter) Wait(ctx context.Context, req *http.Request) error {
+	if lim == nil {
+		return nil
+	}
+
+	delay := lim.reserve(lim.keyFunc(req), lim.now())
+	if delay <= 0 {
+		return nil
+	}
+
+	return sleepWithContext(ctx, delay)
+}
+
+// reserve will reserve a request against the quota for the key, returning the
+// delay before the request may be made.
+func (lim *AdaptiveLimiter) reserve(key string, now time.Time) time.Duration {
+	lim.mu.Lock()
+	defer lim.mu.Unlock()
+
+	quota, ok := lim.quotas[key]
+	if !ok {
+		return 0
+	}
+
+	// If the quota has been reset, then speed back up.
+	if !now.Before(quota.reset) {
+		delete(lim.quotas, key)
+
+		return 0
+	}
+
+	untilReset := quota.reset.Sub(now)
+
+	if quota.remaining <= 0 {
+		return untilReset
+	}
+
+	// Reserve the request against the quota so that concurrent requests
+	// do not overrun the limit before the next response is observed.
+	quota.remaining--
+
+	if float64(quota.remaining) >= float64(quota.limit)*lim.slowdown {
+		return 0
+	}
+
+	// Spread the remaining requests evenly over the time between the next
+	// available slot and the reset.
+	next := quota.next
+	if next.Before(now) {
+		next = now
+	}
+
+	quota.next = next.Add(quota.reset.Sub(next) / time.Duration(quota.remaining+1))
+
+	return next.Sub(now)
+}
+
+// Observe will update the quota for the request's key using the rate limit
+// headers from the response. Responses without rate limit headers are ignored.
+func (lim *AdaptiveLimiter) Observe(rsp *http.Response) {
+	if lim == nil || rsp == nil || rsp.Request == nil {
+		return
+	}
+
+	now := lim.now()
+
+	quota, ok := parseRateLimitHeaders(rsp.Header, now)
+
+	// A 429 response with a "Retry-After" header means that the quota has
+	// been exhausted, regardless of the other headers.
+	if rsp.StatusCode == http.StatusTooManyRequests {
+		if delay, retryOK := retryAfter(rsp, now); retryOK {
+			quota.remaining = 0
+			quota.reset = now.Add(delay)
+			ok = true
+		}
+	}
+
+	if !ok {
+		return
+	}
+
+	key := lim.keyFunc(rsp.Request)
+
+	lim.mu.Lock()
+	defer lim.mu.Unlock()
+
+	// Preserve the pacing of the previous quota for the same window.
+	if prev, found := lim.quotas[key]; found && prev.reset.Equal(quota.reset) {
+		quota.next = prev.next
+	}
+
+	lim.quotas[key] = quota
+}
+
+// parseRateLimitHeaders will parse the rate limit quota from the response
+// headers. The boolean is false if the headers do not contain both the
+// remaining quota and the reset time.
+func parseRateLimitHeaders(header http.Header, now time.Time) (*rateLimitQuota, bool) {
+	quota := &rateLimitQuota{limit: -1, remaining: -1}
+
+	var (
+		reset    time.Duration
+		resetOK  bool
+		windowOK bool
+	)
+
+	// Parse the combined "RateLimit" header, e.g.
+	// "limit=100, remaining=50, reset=5".
+	if val := header.Get("RateLimit"); val != "" {
+		for _, param := range strings.Split(val, ",") {
+			key, val, _ := strings.Cut(strings.TrimSpace(param), "=")
+
+			switch strings.ToLower(key) {
+			case "limit":
+				quota.limit = atoi(val, quota.limit)
+			case "remaining":
+				quota.remaining = atoi(val, quota.remaining)
+			case "reset":
+				reset, resetOK = parseResetHeader(val, now)
+			}
+		}
+	}
+
+	for _, prefix := range []string{"X-RateLimit-", "X-Rate-Limit-", "RateLimit-"} {
+		quota.limit = atoi(header.Get(prefix+"Limit"), quota.limit)
+		quota.remaining = atoi(header.Get(prefix+"Remaining"), quota.remaining)
+
+		if !resetOK {
+			reset, resetOK = parseResetHeader(header.Get(prefix+"Reset"), now)
+		}
+	}
+
+	// The "RateLimit-Policy" header, e.g. "100;w=60", gives the limit and
+	// the window, which is used as the reset if no reset is given.
+	if val := header.Get("RateLimit-Policy"); val != "" {
+		params := strings.Split(strings.Split(val, ",")[0], ";")
+		quota.limit = atoi(strings.TrimSpace(params[0]), quota.limit)
+
+		for _, param := range params[1:] {
+			if key, val, _ := strings.Cut(strings.TrimSpace(param), "="); key == "w" && !resetOK {
+				var window time.Duration
+
+				window, windowOK = parseResetHeader(val, now)
+				reset = window
+			}
+		}
+	}
+
+	if quota.remaining < 0 || (!resetOK && !windowOK) {
+		return quota, false
+	}
+
+	quota.reset = now.Add(reset)
+
+	return quota, true
+}
+
+// atoi will parse the integer value, returning the fallback if the value is
+// not an integer.
+func atoi(val string, fallback int) int {
+	n, err := strconv.Atoi(strings.TrimSpace(val))
+	if err != nil {
+		return fallback
+	}
+
+	return n
+}
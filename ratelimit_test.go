@@ -0,0 +1,357 @@
+// Copyright 2023 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+
+package gidari
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+func TestRateLimiterRegistry(t *testing.T) {
+	t.Parallel()
+
+	vendorA := rate.NewLimiter(1, 1)
+	vendorB := rate.NewLimiter(2, 2)
+
+	newReq := func(url string) *http.Request {
+		req, _ := http.NewRequestWithContext(context.Background(), http.MethodGet, url, nil)
+
+		return req
+	}
+
+	t.Run("by host", func(t *testing.T) {
+		t.Parallel()
+
+		reg := NewRateLimiterRegistry(nil).
+			Set("a.example.com", vendorA).
+			Set("b.example.com", vendorB)
+
+		for url, want := range map[string]*rate.Limiter{
+			"https://a.example.com/items": vendorA,
+			"https://b.example.com/items": vendorB,
+			"https://c.example.com/items": nil,
+		} {
+			if got := reg.Limiter(newReq(url)); got != want {
+				t.Errorf("Limiter(%q) = %p, want %p", url, got, want)
+			}
+		}
+	})
+
+	t.Run("by key function", func(t *testing.T) {
+		t.Parallel()
+
+		reg := NewRateLimiterRegistry(func(req *http.Request) string {
+			return req.URL.Query().Get("vendor")
+		}).Set("a", vendorA)
+
+		if got := reg.Limiter(newReq("https://example.com?vendor=a")); got != vendorA {
+			t.Errorf("expected vendor a limiter, got %p", got)
+		}
+
+		if got := reg.Limiter(newReq("https://example.com?vendor=b")); got != nil {
+			t.Errorf("expected no limiter, got %p", got)
+		}
+	})
+
+	t.Run("default limiter is created once per key", func(t *testing.T) {
+		t.Parallel()
+
+		created := 0
+
+		reg := NewRateLimiterRegistry(nil).Default(func(string) *rate.Limiter {
+			created++
+
+			return rate.NewLimiter(1, 1)
+		})
+
+		first := reg.Limiter(newReq("https://a.example.com/1"))
+		second := reg.Limiter(newReq("https://a.example.com/2"))
+		other := reg.Limiter(newReq("https://b.example.com/1"))
+
+		if first == nil || first != second {
+			t.Errorf("expected the same limiter for the same host")
+		}
+
+		if other == first {
+			t.Errorf("expected a different limiter for a different host")
+		}
+
+		if created != 2 {
+			t.Errorf("expected 2 limiters to be created, got %d", created)
+		}
+	})
+
+	t.Run("nil registry", func(t *testing.T) {
+		t.Parallel()
+
+		var reg *RateLimiterRegistry
+		if got := reg.Limiter(newReq("https://a.example.com")); got != nil {
+			t.Errorf("expected no limiter, got %p", got)
+		}
+	})
+}
+
+func TestHTTPServiceRateLimiterPrecedence(t *testing.T) {
+	t.Parallel()
+
+	svcLimiter := rate.NewLimiter(1, 1)
+	hostLimiter := rate.NewLimiter(2, 2)
+	reqLimiter := rate.NewLimiter(3, 3)
+
+	svc, err := NewService(context.Background())
+	if err != nil {
+		t.Fatalf("failed to create service: %v", err)
+	}
+
+	svc.HTTP.
+		RateLimiter(svcLimiter).
+		RateLimiters(NewRateLimiterRegistry(nil).Set("a.example.com", hostLimiter))
+
+	for _, tcase := range []struct {
+		name string
+		url  string
+		opts []RequestOption
+		want *rate.Limiter
+	}{
+		{
+			name: "service limiter",
+			url:  "https://b.example.com",
+			want: svcLimiter,
+		},
+		{
+			name: "registry limiter",
+			url:  "https://a.example.com",
+			want: hostLimiter,
+		},
+		{
+			name: "request limiter",
+			url:  "https://a.example.com",
+			opts: []RequestOption{WithRateLimiter(reqLimiter)},
+			want: reqLimiter,
+		},
+	} {
+		req, _ := http.NewRequestWithContext(context.Background(), http.MethodGet, tcase.url, nil)
+
+		job := svc.HTTP.newWebWorkerJob(NewHTTPRequest(req, tcase.opts...))
+		if job.rlimiter != tcase.want {
+			t.Errorf("%s: got limiter %p, want %p", tcase.name, job.rlimiter, tcase.want)
+		}
+	}
+}
+
+func TestParseRateLimitHeaders(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	for _, tcase := range []struct {
+		name          string
+		header        http.Header
+		wantOK        bool
+		wantLimit     int
+		wantRemaining int
+		wantReset     time.Duration
+	}{
+		{
+			name:   "no headers",
+			header: http.Header{},
+		},
+		{
+			name: "github style",
+			header: http.Header{
+				"X-Ratelimit-Limit":     []string{"5000"},
+				"X-Ratelimit-Remaining": []string{"42"},
+				"X-Ratelimit-Reset":     []string{strconv.FormatInt(now.Add(time.Hour).Unix(), 10)},
+			},
+			wantOK:        true,
+			wantLimit:     5000,
+			wantRemaining: 42,
+			wantReset:     time.Hour,
+		},
+		{
+			name: "twitter style",
+			header: http.Header{
+				"X-Rate-Limit-Limit":     []string{"15"},
+				"X-Rate-Limit-Remaining": []string{"3"},
+				"X-Rate-Limit-Reset":     []string{"60"},
+			},
+			wantOK:        true,
+			wantLimit:     15,
+			wantRemaining: 3,
+			wantReset:     time.Minute,
+		},
+		{
+			name: "ietf draft",
+			header: http.Header{
+				"Ratelimit-Limit":     []string{"100"},
+				"Ratelimit-Remaining": []string{"10"},
+				"Ratelimit-Reset":     []string{"30"},
+			},
+			wantOK:        true,
+			wantLimit:     100,
+			wantRemaining: 10,
+			wantReset:     30 * time.Second,
+		},
+		{
+			name: "ietf draft with policy",
+			header: http.Header{
+				"Ratelimit-Remaining": []string{"10"},
+				"Ratelimit-Policy":    []string{"100;w=60"},
+			},
+			wantOK:        true,
+			wantLimit:     100,
+			wantRemaining: 10,
+			wantReset:     time.Minute,
+		},
+		{
+			name: "combined header",
+			header: http.Header{
+				"Ratelimit": []string{"limit=100, remaining=50, reset=5"},
+			},
+			wantOK:        true,
+			wantLimit:     100,
+			wantRemaining: 50,
+			wantReset:     5 * time.Second,
+		},
+		{
+			name: "remaining without reset",
+			header: http.Header{
+				"X-Ratelimit-Remaining": []string{"10"},
+			},
+		},
+	} {
+		tcase := tcase
+
+		t.Run(tcase.name, func(t *testing.T) {
+			t.Parallel()
+
+			quota, ok := parseRateLimitHeaders(tcase.header, now)
+			if ok != tcase.wantOK {
+				t.Fatalf("parseRateLimitHeaders() ok = %v, want %v", ok, tcase.wantOK)
+			}
+
+			if !ok {
+				return
+			}
+
+			if quota.limit != tcase.wantLimit {
+				t.Errorf("limit = %d, want %d", quota.limit, tcase.wantLimit)
+			}
+
+			if quota.remaining != tcase.wantRemaining {
+				t.Errorf("remaining = %d, want %d", quota.remaining, tcase.wantRemaining)
+			}
+
+			if got := quota.reset.Sub(now); got != tcase.wantReset {
+				t.Errorf("reset = %v, want %v", got, tcase.wantReset)
+			}
+		})
+	}
+}
+
+func TestAdaptiveLimiter(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	newResponse := func(status int, header http.Header) *http.Response {
+		req, _ := http.NewRequestWithContext(context.Background(), http.MethodGet, "https://api.example.com", nil)
+
+		return &http.Response{StatusCode: status, Header: header, Request: req}
+	}
+
+	const key = "api.example.com"
+
+	t.Run("no delay with plenty of quota", func(t *testing.T) {
+		t.Parallel()
+
+		lim := NewAdaptiveLimiter(nil)
+		lim.now = func() time.Time { return now }
+
+		lim.Observe(newResponse(http.StatusOK, http.Header{
+			"X-Ratelimit-Limit":     []string{"100"},
+			"X-Ratelimit-Remaining": []string{"90"},
+			"X-Ratelimit-Reset":     []string{"60"},
+		}))
+
+		if delay := lim.reserve(key, now); delay != 0 {
+			t.Fatalf("expected no delay, got %v", delay)
+		}
+	})
+
+	t.Run("spread requests below the slowdown threshold", func(t *testing.T) {
+		t.Parallel()
+
+		lim := NewAdaptiveLimiter(nil)
+		lim.now = func() time.Time { return now }
+
+		lim.Observe(newResponse(http.StatusOK, http.Header{
+			"X-Ratelimit-Limit":     []string{"100"},
+			"X-Ratelimit-Remaining": []string{"4"},
+			"X-Ratelimit-Reset":     []string{"40"},
+		}))
+
+		// The 4 remaining requests are spread over the 40 seconds
+		// until the reset.
+		for i, want := range []time.Duration{0, 10 * time.Second, 20 * time.Second, 30 * time.Second} {
+			if delay := lim.reserve(key, now); delay != want {
+				t.Fatalf("reserve %d: expected delay %v, got %v", i, want, delay)
+			}
+		}
+
+		// Once the quota is exhausted, wait for the reset.
+		if delay := lim.reserve(key, now); delay != 40*time.Second {
+			t.Fatalf("expected delay until reset, got %v", delay)
+		}
+
+		// After the reset, there is no delay.
+		if delay := lim.reserve(key, now.Add(time.Minute)); delay != 0 {
+			t.Fatalf("expected no delay after reset, got %v", delay)
+		}
+	})
+
+	t.Run("pause on too many requests", func(t *testing.T) {
+		t.Parallel()
+
+		lim := NewAdaptiveLimiter(nil)
+		lim.now = func() time.Time { return now }
+
+		lim.Observe(newResponse(http.StatusTooManyRequests, http.Header{
+			"Retry-After": []string{"5"},
+		}))
+
+		if delay := lim.reserve(key, now); delay != 5*time.Second {
+			t.Fatalf("expected delay of 5s, got %v", delay)
+		}
+	})
+
+	t.Run("wait respects the context", func(t *testing.T) {
+		t.Parallel()
+
+		lim := NewAdaptiveLimiter(nil)
+		lim.Observe(newResponse(http.StatusOK, http.Header{
+			"X-Ratelimit-Remaining": []string{"0"},
+			"X-Ratelimit-Reset":     []string{"60"},
+		}))
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+		defer cancel()
+
+		req, _ := http.NewRequestWithContext(ctx, http.MethodGet, "https://api.example.com", nil)
+		if err := lim.Wait(ctx, req); !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("expected deadline exceeded, got %v", err)
+		}
+	})
+}
@@ -0,0 +1,277 @@
+// Copyright 2023 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+
+package gidari
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	structpb "google.golang.org/protobuf/types/known/structpb"
+)
+
+// Record is a single record decoded from an HTTP response.
+type Record struct {
+	// Value is the decoded record.
+	Value *structpb.Value
+
+	// Meta describes the response that the record was decoded from. It is
+	// shared by all of the records in the same batch.
+	Meta *ListMeta
+
+	// Index is the index of the record in its batch.
+	Index int
+}
+
+// recordList is a decoded batch of records and the metadata of its source.
+type recordList struct {
+	list *structpb.ListValue
+	meta *ListMeta
+}
+
+// RecordIterator will iterate over the records decoded from the responses of
+// the HTTPService's requests. The responses are decoded in the same way as by
+// "Store", i.e. using the service's decoders, paginators, selectors and scalar
+// policies, but the records are returned rather than written to the requests'
+// writers.
+//
+// Calling "Close" before the iterator is exhausted stops the remaining
+// requests and discards any responses that have not been decoded.
+type RecordIterator struct {
+	// Current is the most recent record from the iterator. This value is
+	// set by the "Next" method, updating with each iteration.
+	Current *Record
+
+	ctx    context.Context //nolint:containedctx
+	cancel context.CancelFunc
+
+	lists chan recordList
+	errCh chan error
+
+	list  *structpb.ListValue
+	meta  *ListMeta
+	index int
+
+	lasterr error
+}
+
+// Records will start making the HTTPService's requests and return an iterator
+// over the decoded records. The iterator must be closed once it is no longer
+// used.
+//
+//	records := svc.HTTP.Records(ctx)
+//	defer records.Close()
+//
+//	for records.Next() {
+//		fmt.Println(records.Current.Value)
+//	}
+//
+//	if err := records.Err(); err != nil {
+//		return err
+//	}
+func (svc *HTTPService) Records(ctx context.Context) *RecordIterator {
+	ctx, cancel := context.WithCancel(ctx)
+
+	iter := &RecordIterator{
+		ctx:    ctx,
+		cancel: cancel,
+		lists:  make(chan recordList),
+		errCh:  make(chan error, 1),
+	}
+
+	go func() {
+		defer close(iter.lists)
+
+		iter.errCh <- iter.decode(svc)
+	}()
+
+	return iter
+}
+
+// decode will make the requests and send each decoded batch of records to the
+// lists channel until the requests are exhausted or the iterator is closed.
+func (iter *RecordIterator) decode(svc *HTTPService) error {
+	responses := NewHTTPIteratorService(svc)
+
+	defer func() {
+		_ = responses.Close()
+
+		// Discard the responses of the requests that were in flight
+		// when the iterator was closed.
+		if responses.currentChan != nil {
+			for current := range responses.currentChan {
+				discardResponse(current.Response)
+			}
+		}
+	}()
+
+	for responses.Next(iter.ctx) {
+		job, err := svc.newListWriterJob(responses.Current)
+		if err != nil {
+			return err
+		}
+
+		// If there is no response, then do nothing.
+		if job == nil {
+			continue
+		}
+
+		meta := job.meta
+
+		err = job.decFunc(func(list *structpb.ListValue) error {
+			defer func() { meta.Batch++ }()
+
+			meta := meta
+
+			select {
+			case iter.lists <- recordList{list: list, meta: &meta}:
+				return nil
+			case <-iter.ctx.Done():
+				return fmt.Errorf("context canceled: %w", iter.ctx.Err())
+			}
+		})
+		if err != nil {
+			return job.wrapError(err)
+		}
+	}
+
+	if err := responses.Err(); err != nil {
+		return fmt.Errorf("error iterating over requests: %w", err)
+	}
+
+	return nil
+}
+
+// Next will set the next record as the iterator's "Current" record. If there
+// are no more records or an error is encountered, the returned boolean will be
+// false.
+func (iter *RecordIterator) Next() bool {
+	for iter.lasterr == nil {
+		if values := iter.list.GetValues(); iter.index < len(values) {
+			iter.Current = &Record{Value: values[iter.index], Meta: iter.meta, Index: iter.index}
+			iter.index++
+
+			return true
+		}
+
+		next, ok := <-iter.lists
+		if !ok {
+			iter.lasterr = <-iter.errCh
+			if iter.lasterr == nil {
+				iter.lasterr = io.EOF
+			}
+
+			break
+		}
+
+		iter.list, iter.meta, iter.index = next.list, next.meta, 0
+	}
+
+	iter.Current = nil
+
+	return false
+}
+
+// Err returns any error encountered by the iterator.
+func (iter *RecordIterator) Err() error {
+	// If the error is EOF or nil, return nil.
+	if errors.Is(iter.lasterr, io.EOF) || iter.lasterr == nil {
+		return nil
+	}
+
+	return iter.lasterr
+}
+
+// Close closes the iterator, canceling any requests that have not yet been
+// made and waiting for the requests in flight to be discarded.
+func (iter *RecordIterator) Close() error {
+	iter.cancel()
+
+	// Wait for the decoder to stop.
+	for range iter.lists { //nolint:revive
+	}
+
+	if iter.lasterr == nil {
+		iter.lasterr = io.EOF
+	}
+
+	return nil
+}
+
+// TypedIterator will iterate over the records decoded from the responses of
+// the HTTPService's requests, converting each record into a value of type T in
+// the same way as a TypedWriter.
+type TypedIterator[T any] struct {
+	// Current is the most recent value from the iterator and Meta describes
+	// the response that it was decoded from. These values are set by the
+	// "Next" method, updating with each iteration.
+	Current T
+	Meta    *ListMeta
+
+	records *RecordIterator
+	writer  *TypedWriter[T]
+	lasterr error
+}
+
+// Iterate will start making the HTTPService's requests and return an iterator
+// over the decoded records converted into values of type T. The options are
+// the same as for "NewTypedWriter": by default, the iterator stops with the
+// *RecordError of the first invalid record. The iterator must be closed once it
+// is no longer used.
+func Iterate[T any](ctx context.Context, svc *HTTPService, opts ...TypedWriterOption[T]) *TypedIterator[T] {
+	return &TypedIterator[T]{
+		records: svc.Records(ctx),
+		writer:  NewTypedWriter(nil, opts...),
+	}
+}
+
+// Next will set the next value as the iterator's "Current" value. If there are
+// no more values or an error is encountered, the returned boolean will be
+// false.
+func (iter *TypedIterator[T]) Next() bool {
+	var zero T
+
+	for iter.lasterr == nil && iter.records.Next() {
+		rec := iter.records.Current
+
+		val, err := iter.writer.convert(rec.Value)
+		if err == nil {
+			iter.Current, iter.Meta = val, rec.Meta
+
+			return true
+		}
+
+		recordErr := &RecordError{Index: rec.Index, Value: rec.Value, Err: err}
+		if iter.writer.invalid == nil {
+			iter.lasterr = recordErr
+		} else if err := iter.writer.invalid(iter.records.ctx, recordErr); err != nil {
+			iter.lasterr = err
+		}
+	}
+
+	iter.Current, iter.Meta = zero, nil
+
+	return false
+}
+
+// Err returns any error encountered by the iterator.
+func (iter *TypedIterator[T]) Err() error {
+	if iter.lasterr != nil {
+		return iter.lasterr
+	}
+
+	return iter.records.Err()
+}
+
+// Close closes the iterator, canceling any requests that have not yet been
+// made.
+func (iter *TypedIterator[T]) Close() error {
+	return iter.records.Close()
+}
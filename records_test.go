@@ -0,0 +1,203 @@
+// Copyright 2023 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+
+package gidari
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+)
+
+// newRecordsServer will return a server with the given number of pages, each
+// wrapping two records in a "data" field.
+func newRecordsServer(t *testing.T, pageCount int, requests *int32) *httptest.Server {
+	t.Helper()
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(requests, 1)
+
+		page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+		if page < pageCount {
+			w.Header().Set("Link", fmt.Sprintf(`</items?page=%d>; rel="next"`, page+1))
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"data":[{"id":%d,"name":"a"},{"id":%d}]}`, 2*page-1, 2*page)
+	}))
+}
+
+// newRecordsService will return a service that requests the pages of the
+// server in order.
+func newRecordsService(t *testing.T, server *httptest.Server) *HTTPService {
+	t.Helper()
+
+	svc, err := NewService(context.Background())
+	if err != nil {
+		t.Fatalf("failed to create service: %v", err)
+	}
+
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodGet, server.URL+"/items?page=1", nil)
+	if err != nil {
+		t.Fatalf("failed to create request: %v", err)
+	}
+
+	writer := &mockListWriter{}
+
+	svc.HTTP.Client(server.Client()).MaxInFlight(1).Requests(NewHTTPRequest(req,
+		WithWriters(writer),
+		WithPaginator(NewLinkHeaderPaginator()),
+		WithSelector("$.data[*]")))
+
+	return svc.HTTP
+}
+
+func TestHTTPServiceRecords(t *testing.T) {
+	t.Parallel()
+
+	var requests int32
+
+	server := newRecordsServer(t, 3, &requests)
+	defer server.Close()
+
+	records := newRecordsService(t, server).Records(context.Background())
+	defer records.Close()
+
+	var count int
+
+	for records.Next() {
+		count++
+
+		rec := records.Current
+
+		id, _ := rec.Value.GetStructValue().AsMap()["id"].(float64)
+		if int(id) != count {
+			t.Fatalf("record %d: id = %v", count, id)
+		}
+
+		if rec.Meta.Page != (count+1)/2 || rec.Index != (count-1)%2 {
+			t.Fatalf("record %d: page, index = %d, %d", count, rec.Meta.Page, rec.Index)
+		}
+	}
+
+	if err := records.Err(); err != nil {
+		t.Fatalf("failed to iterate: %v", err)
+	}
+
+	if count != 6 {
+		t.Fatalf("expected 6 records, got %d", count)
+	}
+}
+
+func TestHTTPServiceRecordsClose(t *testing.T) {
+	t.Parallel()
+
+	const pageCount = 100
+
+	var requests int32
+
+	server := newRecordsServer(t, pageCount, &requests)
+	defer server.Close()
+
+	records := newRecordsService(t, server).Records(context.Background())
+
+	for records.Next() {
+		if records.Current.Meta.Page == 2 {
+			break
+		}
+	}
+
+	if err := records.Close(); err != nil {
+		t.Fatalf("failed to close: %v", err)
+	}
+
+	if err := records.Err(); err != nil {
+		t.Fatalf("unexpected error after close: %v", err)
+	}
+
+	if records.Next() {
+		t.Fatalf("expected no records after close")
+	}
+
+	if got := atomic.LoadInt32(&requests); got >= pageCount {
+		t.Fatalf("expected the remaining requests to be canceled, got %d requests", got)
+	}
+}
+
+func TestHTTPServiceRecordsBadResponse(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	records := newRecordsService(t, server).Records(context.Background())
+	defer records.Close()
+
+	if records.Next() {
+		t.Fatalf("expected no records")
+	}
+
+	if err := records.Err(); !errors.Is(err, ErrBadResponse) {
+		t.Fatalf("expected error %v, got %v", ErrBadResponse, err)
+	}
+}
+
+func TestIterate(t *testing.T) {
+	t.Parallel()
+
+	var requests int32
+
+	server := newRecordsServer(t, 2, &requests)
+	defer server.Close()
+
+	t.Run("invalid record", func(t *testing.T) {
+		iter := Iterate[testValidatedRecord](context.Background(), newRecordsService(t, server))
+		defer iter.Close()
+
+		if !iter.Next() || iter.Current.ID != 1 || iter.Meta.Page != 1 {
+			t.Fatalf("expected the first record, got %+v", iter.Current)
+		}
+
+		if iter.Next() {
+			t.Fatalf("expected the invalid record to stop the iterator")
+		}
+
+		var recordErr *RecordError
+		if err := iter.Err(); !errors.As(err, &recordErr) || recordErr.Index != 1 {
+			t.Fatalf("expected a record error for index 1, got %v", err)
+		}
+	})
+
+	t.Run("skip invalid records", func(t *testing.T) {
+		iter := Iterate(context.Background(), newRecordsService(t, server),
+			WithInvalidRecordHandler[testValidatedRecord](func(context.Context, *RecordError) error {
+				return nil
+			}))
+		defer iter.Close()
+
+		var ids []int
+		for iter.Next() {
+			ids = append(ids, iter.Current.ID)
+		}
+
+		if err := iter.Err(); err != nil {
+			t.Fatalf("failed to iterate: %v", err)
+		}
+
+		if fmt.Sprint(ids) != "[1 3]" {
+			t.Fatalf("ids = %v, want [1 3]", ids)
+		}
+	})
+}
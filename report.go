@@ -0,0 +1,257 @@
+// Copyright 2023 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+
+package gidari
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ErrRequestNotCompleted is the error of a request in a StoreReport if the
+// service stopped before all of the request's responses were stored, e.g.
+// because another request failed or the context was canceled.
+var ErrRequestNotCompleted = fmt.Errorf("request not completed")
+
+// RequestReport describes the outcome of storing the responses of a request,
+// including the responses of any follow-up requests for its pages.
+type RequestReport struct {
+	// Request is the request, as passed to the service.
+	Request *http.Request
+
+	// StatusCode is the status code of the last response received. It is
+	// zero if no response was received.
+	StatusCode int
+
+	// Responses is the number of responses received, i.e. the number of
+	// pages of a paginated request.
+	Responses int
+
+	// Bytes is the number of bytes read from the response bodies, after
+	// they are decompressed.
+	Bytes int64
+
+	// Records is the number of records written to the request's writers.
+	Records int
+
+	// DeadLetters is the number of lists and responses sent to the
+	// service's dead-letter sink. See "WithDeadLetterSink".
+	DeadLetters int
+
+	// Duration is the time from when the first request was sent until the
+	// last response was stored.
+	Duration time.Duration
+
+	// Err is the error of the request, if any. If the request failed in
+	// more than one way, e.g. a page could not be fetched after a page
+	// failed to write, then the errors are joined together.
+	Err error
+}
+
+// StoreReport is the outcome of storing the responses of the requests of an
+// HTTPService, returned by "StoreWithReport".
+type StoreReport struct {
+	// Requests are the reports of the requests, in the order that the
+	// requests were added to the service.
+	Requests []*RequestReport
+
+	// Duration is the time taken to store the responses.
+	Duration time.Duration
+}
+
+// Failed will return the reports of the requests that have an error.
+func (report *StoreReport) Failed() []*RequestReport {
+	var failed []*RequestReport
+
+	for _, req := range report.Requests {
+		if req.Err != nil {
+			failed = append(failed, req)
+		}
+	}
+
+	return failed
+}
+
+// Err will return the errors of the failed requests joined together, or nil if
+// every request succeeded. Each error is a *RequestError, or wraps one or more
+// of them if the request failed in more than one way.
+func (report *StoreReport) Err() error {
+	var errs []error
+
+	for _, req := range report.Failed() {
+		err := req.Err
+		if !hasContext(err) {
+			err = &RequestError{Method: req.Request.Method, URL: req.Request.URL, Err: err}
+		}
+
+		errs = append(errs, err)
+	}
+
+	return joinErrors(errs...)
+}
+
+// requestTracker keeps track of the outcome of a request while its responses
+// are stored. The tracker is updated both while iterating over the responses
+// and while writing their data.
+type requestTracker struct {
+	mu sync.Mutex
+
+	report *RequestReport
+	bytes  int64
+
+	// expected is the number of responses expected so far, including the
+	// follow-up requests for pages, and finished is the number of
+	// responses that have been stored or have failed.
+	expected int
+	finished int
+
+	start time.Time
+	end   time.Time
+	errs  []error
+}
+
+// newStoreTrackers will create a tracker for each of the requests.
+func newStoreTrackers(reqs []*Request) map[*Request]*requestTracker {
+	trackers := make(map[*Request]*requestTracker, len(reqs))
+
+	for _, req := range reqs {
+		tracker, ok := trackers[req]
+		if !ok {
+			tracker = &requestTracker{report: &RequestReport{Request: req.http}}
+			trackers[req] = tracker
+		}
+
+		tracker.expected++
+	}
+
+	return trackers
+}
+
+// newStoreReport will return the report of the trackers for the requests.
+func newStoreReport(reqs []*Request, trackers map[*Request]*requestTracker, duration time.Duration) *StoreReport {
+	report := &StoreReport{Duration: duration}
+
+	for _, req := range reqs {
+		report.Requests = append(report.Requests, trackers[req].result())
+	}
+
+	return report
+}
+
+// receive will track the current response of the request, or its error.
+func (tracker *requestTracker) receive(current *Current) {
+	if tracker == nil {
+		return
+	}
+
+	tracker.mu.Lock()
+	defer tracker.mu.Unlock()
+
+	if current.next {
+		tracker.expected++
+	}
+
+	if at := current.requestedAt; !at.IsZero() && (tracker.start.IsZero() || at.Before(tracker.start)) {
+		tracker.start = at
+	}
+
+	if current.err != nil {
+		tracker.errs = append(tracker.errs, current.err)
+	}
+
+	if rsp := current.Response; rsp != nil {
+		tracker.report.Responses++
+		tracker.report.StatusCode = rsp.StatusCode
+
+		if rsp.Body != nil {
+			rsp.Body = &countedBody{ReadCloser: rsp.Body, n: &tracker.bytes}
+		}
+	}
+}
+
+// addRecords will track the number of records written.
+func (tracker *requestTracker) addRecords(n int) {
+	if tracker == nil {
+		return
+	}
+
+	tracker.mu.Lock()
+	defer tracker.mu.Unlock()
+
+	tracker.report.Records += n
+}
+
+// addDeadLetter will track a list or response sent to the dead-letter sink.
+func (tracker *requestTracker) addDeadLetter() {
+	if tracker == nil {
+		return
+	}
+
+	tracker.mu.Lock()
+	defer tracker.mu.Unlock()
+
+	tracker.report.DeadLetters++
+}
+
+// finish will track that a response has been stored, or that it failed with
+// the error.
+func (tracker *requestTracker) finish(err error) {
+	if tracker == nil {
+		return
+	}
+
+	tracker.mu.Lock()
+	defer tracker.mu.Unlock()
+
+	tracker.finished++
+	tracker.end = time.Now()
+
+	if err != nil {
+		tracker.errs = append(tracker.errs, err)
+	}
+}
+
+// result will return the report of the request. It must only be called once
+// the responses are no longer being stored.
+func (tracker *requestTracker) result() *RequestReport {
+	tracker.mu.Lock()
+	defer tracker.mu.Unlock()
+
+	report := *tracker.report
+	report.Bytes = atomic.LoadInt64(&tracker.bytes)
+	report.Err = joinErrors(tracker.errs...)
+
+	if report.Err == nil && tracker.finished < tracker.expected {
+		report.Err = ErrRequestNotCompleted
+	}
+
+	if !tracker.start.IsZero() && tracker.end.After(tracker.start) {
+		report.Duration = tracker.end.Sub(tracker.start)
+	}
+
+	return &report
+}
+
+// countedBody is a response body that counts the bytes read from it.
+type countedBody struct {
+	io.ReadCloser
+
+	n *int64
+}
+
+// Read will read from the body, counting the bytes read.
+func (body *countedBody) Read(p []byte) (int, error) {
+	n, err := body.ReadCloser.Read(p)
+	atomic.AddInt64(body.n, int64(n))
+
+	return n, err //nolint:wrapcheck
+}
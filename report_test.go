@@ -0,0 +1,183 @@
+// Copyright 2023 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+
+package gidari
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHTTPServiceStoreWithReport(t *testing.T) {
+	t.Parallel()
+
+	const (
+		page        = `[{"id":1},{"id":2}]`
+		undecodable = `[{"id":1},{"id":`
+		reject      = `[{"id":1},{"reject":true},{"id":3}]`
+	)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		switch r.URL.Path {
+		case "/pages":
+			if r.URL.Query().Get("page") == "" {
+				w.Header().Set("Link", `</pages?page=2>; rel="next"`)
+			}
+
+			fmt.Fprint(w, page)
+		case "/bad":
+			w.WriteHeader(http.StatusNotFound)
+		case "/undecodable":
+			fmt.Fprint(w, undecodable)
+		case "/reject":
+			fmt.Fprint(w, reject)
+		}
+	}))
+	defer server.Close()
+
+	// Requests to the closed server can not be made.
+	closed := httptest.NewServer(http.NotFoundHandler())
+	closed.Close()
+
+	svc, err := NewService(context.Background())
+	if err != nil {
+		t.Fatalf("failed to create service: %v", err)
+	}
+
+	writer := &rejectWriter{}
+
+	var reqs []*Request
+
+	for _, url := range []string{
+		server.URL + "/pages",
+		server.URL + "/bad",
+		server.URL + "/undecodable",
+		closed.URL,
+		server.URL + "/reject",
+	} {
+		req, err := http.NewRequestWithContext(context.Background(), http.MethodGet, url, nil)
+		if err != nil {
+			t.Fatalf("failed to create request: %v", err)
+		}
+
+		reqs = append(reqs, NewHTTPRequest(req, WithWriters(writer), WithBatchSize(1),
+			WithPaginator(NewLinkHeaderPaginator())))
+	}
+
+	report, err := svc.HTTP.Client(server.Client()).ContinueOnError(true).Requests(reqs...).
+		StoreWithReport(context.Background())
+
+	for _, wantErr := range []error{ErrBadResponse, errRejected} {
+		if !errors.Is(err, wantErr) {
+			t.Fatalf("expected error %v, got %v", wantErr, err)
+		}
+	}
+
+	if len(report.Requests) != len(reqs) || len(report.Failed()) != 4 {
+		t.Fatalf("expected %d reports with 4 failed, got %d with %d failed",
+			len(reqs), len(report.Requests), len(report.Failed()))
+	}
+
+	for idx, tcase := range []struct {
+		status    int
+		responses int
+		bytes     int64
+		records   int
+		err       bool
+	}{
+		{status: http.StatusOK, responses: 2, bytes: 2 * int64(len(page)), records: 4},
+		{status: http.StatusNotFound, responses: 1, err: true},
+		{status: http.StatusOK, responses: 1, bytes: int64(len(undecodable)), records: 1, err: true},
+		{err: true},
+		{status: http.StatusOK, responses: 1, bytes: int64(len(reject)), records: 1, err: true},
+	} {
+		got := report.Requests[idx]
+
+		if got.Request != reqs[idx].http {
+			t.Fatalf("report %d: unexpected request %v", idx, got.Request.URL)
+		}
+
+		if got.StatusCode != tcase.status || got.Responses != tcase.responses || got.Records != tcase.records {
+			t.Fatalf("report %d: status, responses, records = %d, %d, %d, want %d, %d, %d", idx,
+				got.StatusCode, got.Responses, got.Records, tcase.status, tcase.responses, tcase.records)
+		}
+
+		if tcase.bytes != 0 && got.Bytes != tcase.bytes {
+			t.Fatalf("report %d: bytes = %d, want %d", idx, got.Bytes, tcase.bytes)
+		}
+
+		if (got.Err != nil) != tcase.err {
+			t.Fatalf("report %d: unexpected error %v", idx, got.Err)
+		}
+
+		if tcase.responses > 0 && got.Duration <= 0 {
+			t.Fatalf("report %d: expected a duration, got %v", idx, got.Duration)
+		}
+	}
+
+	if !errors.Is(report.Err(), ErrBadResponse) {
+		t.Fatalf("expected report error %v, got %v", ErrBadResponse, report.Err())
+	}
+}
+
+func TestHTTPServiceStoreWithReportStop(t *testing.T) {
+	t.Parallel()
+
+	blocked := make(chan struct{})
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/blocked" {
+			select {
+			case <-blocked:
+			case <-r.Context().Done():
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+	defer close(blocked)
+
+	svc, err := NewService(context.Background())
+	if err != nil {
+		t.Fatalf("failed to create service: %v", err)
+	}
+
+	var reqs []*Request
+
+	for _, path := range []string{"/bad", "/blocked"} {
+		req, err := http.NewRequestWithContext(context.Background(), http.MethodGet, server.URL+path, nil)
+		if err != nil {
+			t.Fatalf("failed to create request: %v", err)
+		}
+
+		reqs = append(reqs, NewHTTPRequest(req))
+	}
+
+	// Without continuing on errors, the service stops at the first error.
+	report, err := svc.HTTP.Client(server.Client()).MaxInFlight(1).Requests(reqs...).
+		StoreWithReport(context.Background())
+	if !errors.Is(err, ErrBadResponse) {
+		t.Fatalf("expected error %v, got %v", ErrBadResponse, err)
+	}
+
+	if got := report.Requests[0].Err; !errors.Is(got, ErrBadResponse) {
+		t.Fatalf("expected error %v, got %v", ErrBadResponse, got)
+	}
+
+	if got := report.Requests[1].Err; !errors.Is(got, ErrRequestNotCompleted) {
+		t.Fatalf("expected error %v, got %v", ErrRequestNotCompleted, got)
+	}
+}
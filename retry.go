@@ -0,0 +1,282 @@
+// Copyright 2023 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+
+package gidari
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+const (
+	defaultRetryMinBackoff = 500 * time.Millisecond
+	defaultRetryMaxBackoff = 30 * time.Second
+
+	// defaultRetryMaxRetryAfter is the longest delay requested by a server
+	// that is honored if the policy does not set one.
+	defaultRetryMaxRetryAfter = 5 * time.Minute
+
+	// unixResetThreshold is used to distinguish between rate limit reset
+	// headers that are given as a Unix timestamp and those given as a
+	// number of seconds. Any value larger than this is assumed to be a
+	// timestamp.
+	unixResetThreshold = 1_000_000_000
+)
+
+// RetryPolicy determines if and when a request should be retried. A nil
+// RetryPolicy will never retry a request.
+type RetryPolicy struct {
+	// MaxAttempts is the maximum number of times a request is made,
+	// including the first attempt.
+	MaxAttempts int
+
+	// MinBackoff is the delay before the first retry. Each subsequent
+	// retry doubles the delay, with jitter, up to MaxBackoff.
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+
+	// MaxRetryAfter is the longest delay requested by the server, through
+	// the "Retry-After" or "X-RateLimit-Reset" headers, that is honored.
+	// Longer delays are shortened to MaxRetryAfter. The default is 5
+	// minutes.
+	MaxRetryAfter time.Duration
+
+	// StatusCodes are the response status codes that will be retried.
+	StatusCodes []int
+
+	// RetryError reports whether a transport error returned by the client
+	// should be retried. If nil, then connection resets, unexpected EOFs
+	// and timeouts are retried.
+	RetryError func(error) bool
+}
+
+// NewRetryPolicy will return a retry policy that makes up to maxAttempts
+// attempts with exponential backoff, retrying on 429, 502, 503 and 504 status
+// codes as well as connection resets.
+func NewRetryPolicy(maxAttempts int) *RetryPolicy {
+	return &RetryPolicy{
+		MaxAttempts:   maxAttempts,
+		MinBackoff:    defaultRetryMinBackoff,
+		MaxBackoff:    defaultRetryMaxBackoff,
+		MaxRetryAfter: defaultRetryMaxRetryAfter,
+		StatusCodes: []int{
+			http.StatusTooManyRequests,
+			http.StatusBadGateway,
+			http.StatusServiceUnavailable,
+			http.StatusGatewayTimeout,
+		},
+	}
+}
+
+// WithRetryPolicy will set the retry policy for the request, overriding the
+// retry policy of the HTTP Service.
+func WithRetryPolicy(policy *RetryPolicy) RequestOption {
+	return func(req *Request) {
+		req.retry = policy
+	}
+}
+
+// isRetryableError will check if the error is a transient transport error.
+func isRetryableError(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+
+	if errors.Is(err, syscall.ECONNRESET) || errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, io.EOF) {
+		return true
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+
+	return false
+}
+
+func (policy *RetryPolicy) retryStatus(code int) bool {
+	for _, retryCode := range policy.StatusCodes {
+		if code == retryCode {
+			return true
+		}
+	}
+
+	return false
+}
+
+// backoff will return the exponential backoff with jitter for the given
+// attempt, starting at 1.
+func (policy *RetryPolicy) backoff(attempt int) time.Duration {
+	minBackoff := policy.MinBackoff
+	if minBackoff <= 0 {
+		minBackoff = defaultRetryMinBackoff
+	}
+
+	maxBackoff := policy.MaxBackoff
+	if maxBackoff < minBackoff {
+		maxBackoff = minBackoff
+	}
+
+	delay := minBackoff
+	for i := 1; i < attempt && delay < maxBackoff; i++ {
+		delay *= 2
+	}
+
+	if delay > maxBackoff {
+		delay = maxBackoff
+	}
+
+	// Use "equal jitter", i.e. wait at least half of the delay.
+	half := delay / 2
+
+	return half + time.Duration(rand.Int63n(int64(half)+1)) //nolint:gosec
+}
+
+// retry will determine if the request should be retried given the result of
+// the attempt. If so, the delay before the next attempt is returned.
+func (policy *RetryPolicy) retry(attempt int, req *http.Request, rsp *http.Response, err error) (time.Duration, bool) {
+	if policy == nil || attempt >= policy.MaxAttempts {
+		return 0, false
+	}
+
+	// The request can only be retried if the body can be replayed.
+	if req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+		return 0, false
+	}
+
+	if err != nil {
+		retryError := policy.RetryError
+		if retryError == nil {
+			retryError = isRetryableError
+		}
+
+		return policy.backoff(attempt), retryError(err)
+	}
+
+	if rsp == nil || !policy.retryStatus(rsp.StatusCode) {
+		return 0, false
+	}
+
+	// Honor the server's requested delay, if any, up to the maximum.
+	if delay, ok := retryAfter(rsp, time.Now()); ok {
+		maxDelay := policy.MaxRetryAfter
+		if maxDelay <= 0 {
+			maxDelay = defaultRetryMaxRetryAfter
+		}
+
+		if delay > maxDelay {
+			delay = maxDelay
+		}
+
+		return delay, true
+	}
+
+	return policy.backoff(attempt), true
+}
+
+// retryAfter will return the delay requested by the server through either the
+// "Retry-After" header or the "X-RateLimit-Reset" header. Since some servers
+// send a rate limit reset with every response, it is only used if the response
+// is a 429 (Too Many Requests) or the rate limit is exhausted.
+func retryAfter(rsp *http.Response, now time.Time) (time.Duration, bool) {
+	header := rsp.Header
+
+	if val := header.Get("Retry-After"); val != "" {
+		if seconds, err := strconv.Atoi(val); err == nil {
+			return time.Duration(seconds) * time.Second, true
+		}
+
+		if date, err := http.ParseTime(val); err == nil {
+			return nonNegative(date.Sub(now)), true
+		}
+	}
+
+	if rsp.StatusCode != http.StatusTooManyRequests && header.Get("X-RateLimit-Remaining") != "0" {
+		return 0, false
+	}
+
+	return parseResetHeader(header.Get("X-RateLimit-Reset"), now)
+}
+
+// parseResetHeader will parse a rate limit reset header value, which may be
+// either a Unix timestamp or a number of seconds, into the delay until the
+// reset.
+func parseResetHeader(val string, now time.Time) (time.Duration, bool) {
+	if val == "" {
+		return 0, false
+	}
+
+	reset, err := strconv.ParseFloat(val, 64)
+	if err != nil {
+		return 0, false
+	}
+
+	if reset > unixResetThreshold {
+		return nonNegative(time.Unix(int64(reset), 0).Sub(now)), true
+	}
+
+	return nonNegative(time.Duration(reset * float64(time.Second))), true
+}
+
+func nonNegative(d time.Duration) time.Duration {
+	if d < 0 {
+		return 0
+	}
+
+	return d
+}
+
+// rewindBody will reset the request body so that the request can be sent
+// again.
+func rewindBody(req *http.Request) error {
+	if req.GetBody == nil {
+		return nil
+	}
+
+	body, err := req.GetBody()
+	if err != nil {
+		return fmt.Errorf("failed to rewind request body: %w", err)
+	}
+
+	req.Body = body
+
+	return nil
+}
+
+// discardResponse will drain and close the response body so that the
+// underlying connection can be reused.
+func discardResponse(rsp *http.Response) {
+	if rsp == nil || rsp.Body == nil {
+		return
+	}
+
+	_, _ = io.Copy(io.Discard, rsp.Body)
+	_ = rsp.Body.Close()
+}
+
+// sleepWithContext will block for the given duration or until the context is
+// done.
+func sleepWithContext(ctx context.Context, delay time.Duration) error {
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return fmt.Errorf("context error: %w", ctx.Err())
+	case <-timer.C:
+		return nil
+	}
+}
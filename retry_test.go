@@ -0,0 +1,325 @@
+// Copyright 2023 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+
+package gidari
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	t.Parallel()
+
+	policy := &RetryPolicy{
+		MaxAttempts: 10,
+		MinBackoff:  100 * time.Millisecond,
+		MaxBackoff:  time.Second,
+	}
+
+	for _, tcase := range []struct {
+		attempt  int
+		min, max time.Duration
+	}{
+		{attempt: 1, min: 50 * time.Millisecond, max: 100 * time.Millisecond},
+		{attempt: 2, min: 100 * time.Millisecond, max: 200 * time.Millisecond},
+		{attempt: 3, min: 200 * time.Millisecond, max: 400 * time.Millisecond},
+		{attempt: 9, min: 500 * time.Millisecond, max: time.Second},
+	} {
+		tcase := tcase
+
+		t.Run(strconv.Itoa(tcase.attempt), func(t *testing.T) {
+			t.Parallel()
+
+			for i := 0; i < 100; i++ {
+				got := policy.backoff(tcase.attempt)
+				if got < tcase.min || got > tcase.max {
+					t.Fatalf("backoff(%d) = %v, want [%v, %v]", tcase.attempt, got, tcase.min, tcase.max)
+				}
+			}
+		})
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	for _, tcase := range []struct {
+		name   string
+		status int
+		header http.Header
+		want   time.Duration
+		wantOK bool
+	}{
+		{
+			name:   "no header",
+			header: http.Header{},
+		},
+		{
+			name:   "retry after seconds",
+			header: http.Header{"Retry-After": []string{"3"}},
+			want:   3 * time.Second,
+			wantOK: true,
+		},
+		{
+			name:   "retry after date",
+			header: http.Header{"Retry-After": []string{now.Add(5 * time.Second).Format(http.TimeFormat)}},
+			want:   5 * time.Second,
+			wantOK: true,
+		},
+		{
+			name:   "rate limit reset seconds",
+			status: http.StatusTooManyRequests,
+			header: http.Header{"X-Ratelimit-Reset": []string{"2"}},
+			want:   2 * time.Second,
+			wantOK: true,
+		},
+		{
+			name:   "rate limit reset timestamp",
+			status: http.StatusTooManyRequests,
+			header: http.Header{"X-Ratelimit-Reset": []string{strconv.FormatInt(now.Add(time.Minute).Unix(), 10)}},
+			want:   time.Minute,
+			wantOK: true,
+		},
+		{
+			name:   "rate limit reset in the past",
+			status: http.StatusTooManyRequests,
+			header: http.Header{"X-Ratelimit-Reset": []string{strconv.FormatInt(now.Add(-time.Minute).Unix(), 10)}},
+			wantOK: true,
+		},
+		{
+			name:   "rate limit reset with quota left",
+			status: http.StatusBadGateway,
+			header: http.Header{"X-Ratelimit-Reset": []string{"3600"}, "X-Ratelimit-Remaining": []string{"10"}},
+		},
+		{
+			name:   "rate limit reset with quota exhausted",
+			status: http.StatusForbidden,
+			header: http.Header{"X-Ratelimit-Reset": []string{"2"}, "X-Ratelimit-Remaining": []string{"0"}},
+			want:   2 * time.Second,
+			wantOK: true,
+		},
+	} {
+		tcase := tcase
+
+		t.Run(tcase.name, func(t *testing.T) {
+			t.Parallel()
+
+			got, ok := retryAfter(&http.Response{StatusCode: tcase.status, Header: tcase.header}, now)
+			if ok != tcase.wantOK || got != tcase.want {
+				t.Fatalf("retryAfter() = (%v, %v), want (%v, %v)", got, ok, tcase.want, tcase.wantOK)
+			}
+		})
+	}
+}
+
+func TestRetryPolicyRetry(t *testing.T) {
+	t.Parallel()
+
+	policy := NewRetryPolicy(3)
+
+	newReq := func(body io.Reader) *http.Request {
+		req, _ := http.NewRequestWithContext(context.Background(), http.MethodPost, "http://example", body)
+
+		return req
+	}
+
+	for _, tcase := range []struct {
+		name    string
+		policy  *RetryPolicy
+		attempt int
+		req     *http.Request
+		rsp     *http.Response
+		header  http.Header
+		err     error
+		want    bool
+
+		// maxDelay is the longest expected delay, if set.
+		maxDelay time.Duration
+	}{
+		{
+			name:    "nil policy",
+			attempt: 1,
+			req:     newReq(nil),
+			rsp:     &http.Response{StatusCode: http.StatusServiceUnavailable},
+		},
+		{
+			name:    "ok response",
+			policy:  policy,
+			attempt: 1,
+			req:     newReq(nil),
+			rsp:     &http.Response{StatusCode: http.StatusOK},
+		},
+		{
+			name:    "retryable status",
+			policy:  policy,
+			attempt: 1,
+			req:     newReq(nil),
+			rsp:     &http.Response{StatusCode: http.StatusTooManyRequests},
+			want:    true,
+		},
+		{
+			name:    "max attempts reached",
+			policy:  policy,
+			attempt: 3,
+			req:     newReq(nil),
+			rsp:     &http.Response{StatusCode: http.StatusTooManyRequests},
+		},
+		{
+			name:    "connection reset",
+			policy:  policy,
+			attempt: 1,
+			req:     newReq(nil),
+			err:     fmt.Errorf("read: %w", syscall.ECONNRESET),
+			want:    true,
+		},
+		{
+			name:    "non-retryable error",
+			policy:  policy,
+			attempt: 1,
+			req:     newReq(nil),
+			err:     errMissingURL,
+		},
+		{
+			name:    "replayable body",
+			policy:  policy,
+			attempt: 1,
+			req:     newReq(bytes.NewBufferString("{}")),
+			rsp:     &http.Response{StatusCode: http.StatusBadGateway},
+			want:    true,
+		},
+		{
+			name:     "bad gateway with rate limit reset",
+			policy:   policy,
+			attempt:  1,
+			req:      newReq(nil),
+			rsp:      &http.Response{StatusCode: http.StatusBadGateway},
+			header:   http.Header{"X-Ratelimit-Reset": []string{"3600"}, "X-Ratelimit-Remaining": []string{"10"}},
+			want:     true,
+			maxDelay: policy.MinBackoff,
+		},
+		{
+			name:     "retry after longer than the maximum",
+			policy:   policy,
+			attempt:  1,
+			req:      newReq(nil),
+			rsp:      &http.Response{StatusCode: http.StatusTooManyRequests},
+			header:   http.Header{"Retry-After": []string{"7200"}},
+			want:     true,
+			maxDelay: policy.MaxRetryAfter,
+		},
+		{
+			name:    "non-replayable body",
+			policy:  policy,
+			attempt: 1,
+			req:     newReq(io.NopCloser(bytes.NewBufferString("{}"))),
+			rsp:     &http.Response{StatusCode: http.StatusBadGateway},
+		},
+	} {
+		tcase := tcase
+
+		t.Run(tcase.name, func(t *testing.T) {
+			t.Parallel()
+
+			if tcase.rsp != nil {
+				tcase.rsp.Header = tcase.header
+				if tcase.rsp.Header == nil {
+					tcase.rsp.Header = http.Header{}
+				}
+			}
+
+			delay, got := tcase.policy.retry(tcase.attempt, tcase.req, tcase.rsp, tcase.err)
+			if got != tcase.want {
+				t.Fatalf("retry() = %v, want %v", got, tcase.want)
+			}
+
+			if tcase.maxDelay > 0 && delay > tcase.maxDelay {
+				t.Fatalf("retry() delay = %v, want at most %v", delay, tcase.maxDelay)
+			}
+		})
+	}
+}
+
+func TestHTTPServiceStoreRetry(t *testing.T) {
+	t.Parallel()
+
+	const failures = 2
+
+	var attempts int32
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if string(body) != `{"q":1}` {
+			w.WriteHeader(http.StatusBadRequest)
+
+			return
+		}
+
+		if atomic.AddInt32(&attempts, 1) <= failures {
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusServiceUnavailable)
+
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `[{"x":1}]`)
+	}))
+	defer server.Close()
+
+	for _, tcase := range []struct {
+		name        string
+		maxAttempts int
+		wantErr     error
+	}{
+		{
+			name:        "succeeds after retries",
+			maxAttempts: failures + 1,
+		},
+		{
+			name:        "too few attempts",
+			maxAttempts: failures,
+			wantErr:     ErrBadResponse,
+		},
+	} {
+		atomic.StoreInt32(&attempts, 0)
+
+		svc, err := NewService(context.Background())
+		if err != nil {
+			t.Fatalf("failed to create service: %v", err)
+		}
+
+		req, err := http.NewRequestWithContext(context.Background(), http.MethodPost, server.URL,
+			bytes.NewBufferString(`{"q":1}`))
+		if err != nil {
+			t.Fatalf("failed to create request: %v", err)
+		}
+
+		policy := NewRetryPolicy(tcase.maxAttempts)
+		policy.MinBackoff = time.Millisecond
+
+		svc.HTTP.Client(server.Client()).RetryPolicy(policy).Requests(NewHTTPRequest(req))
+
+		err = svc.HTTP.Store(context.Background())
+		if !errors.Is(err, tcase.wantErr) {
+			t.Fatalf("%s: expected error %v, got %v", tcase.name, tcase.wantErr, err)
+		}
+	}
+}
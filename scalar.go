@@ -0,0 +1,138 @@
+// Copyright 2023 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+
+package gidari
+
+import (
+	"fmt"
+
+	structpb "google.golang.org/protobuf/types/known/structpb"
+)
+
+// ScalarMode is an enum that represents how values that are not objects are
+// handled when they are decoded, e.g. the numbers in "[1,2,3]" or a top-level
+// "42".
+type ScalarMode int32
+
+const (
+	// ScalarModeFail will return an error that wraps
+	// ErrUnsupportedProtobufType for any value that is not an object.
+	ScalarModeFail ScalarMode = iota
+
+	// ScalarModeWrap will wrap any value that is not an object into an
+	// object under the policy's key.
+	ScalarModeWrap
+
+	// ScalarModeSkip will discard any value that is not an object.
+	ScalarModeSkip
+)
+
+// defaultScalarKey is the key that scalars are wrapped under if the policy does
+// not set one.
+const defaultScalarKey = "value"
+
+// ScalarPolicy defines how the values that are not objects are handled before
+// they are passed to the list writers. Values that are not objects are
+// numbers, strings, booleans, nulls and nested arrays. The values of a
+// top-level array are checked individually. A nil policy only fails on
+// top-level values that are not objects or arrays, and passes the values of a
+// top-level array to the writers as they are.
+type ScalarPolicy struct {
+	// Mode is the way values that are not objects are handled.
+	Mode ScalarMode
+
+	// Key is the key that values are wrapped under in "ScalarModeWrap". The
+	// default key is "value".
+	Key string
+}
+
+// WithScalarPolicy will set the scalar policy for the request, overriding the
+// policy of the HTTP Service.
+func WithScalarPolicy(policy *ScalarPolicy) RequestOption {
+	return func(req *Request) {
+		req.scalars = policy
+	}
+}
+
+// WithSocketScalarPolicy will set the scalar policy for the values read from
+// the socket.
+func WithSocketScalarPolicy(policy *ScalarPolicy) SocketOption {
+	return func(soc *Socket) {
+		soc.scalars = policy
+	}
+}
+
+// apply will return a flush function that checks each value against the
+// policy before passing them to the given flush function. Lists are the
+// elements of a top-level array, see "addValue".
+func (policy *ScalarPolicy) apply(flush func(list *structpb.ListValue) error) func(list *structpb.ListValue) error {
+	return func(list *structpb.ListValue) error {
+		checked := &structpb.ListValue{Values: make([]*structpb.Value, 0, len(list.Values))}
+
+		for _, val := range list.Values {
+			elems := val.GetListValue()
+			if elems == nil {
+				if err := policy.check(checked, val); err != nil {
+					return err
+				}
+
+				continue
+			}
+
+			// Without a policy, the elements of an array are not
+			// checked.
+			if policy == nil {
+				checked.Values = append(checked.Values, elems.Values...)
+
+				continue
+			}
+
+			for _, elem := range elems.Values {
+				if err := policy.check(checked, elem); err != nil {
+					return err
+				}
+			}
+		}
+
+		return flush(checked)
+	}
+}
+
+// check will add the value to the list if it is an object, and otherwise
+// handle it according to the policy's mode.
+func (policy *ScalarPolicy) check(list *structpb.ListValue, val *structpb.Value) error {
+	if val.GetStructValue() != nil {
+		list.Values = append(list.Values, val)
+
+		return nil
+	}
+
+	mode := ScalarModeFail
+	if policy != nil {
+		mode = policy.Mode
+	}
+
+	switch mode {
+	case ScalarModeWrap:
+		key := policy.Key
+		if key == "" {
+			key = defaultScalarKey
+		}
+
+		list.Values = append(list.Values, structpb.NewStructValue(&structpb.Struct{
+			Fields: map[string]*structpb.Value{key: val},
+		}))
+	case ScalarModeSkip:
+	case ScalarModeFail:
+		fallthrough
+	default:
+		return fmt.Errorf("%w: %T", ErrUnsupportedProtobufType, val.Kind)
+	}
+
+	return nil
+}
@@ -0,0 +1,256 @@
+// Copyright 2023 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+
+package gidari
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"google.golang.org/protobuf/proto"
+	structpb "google.golang.org/protobuf/types/known/structpb"
+)
+
+func TestScalarPolicyApply(t *testing.T) {
+	t.Parallel()
+
+	for _, tcase := range []struct {
+		name            string
+		policy          *ScalarPolicy
+		data            string
+		expectedResults []interface{}
+		err             error
+	}{
+		{
+			name:            "objects",
+			data:            `[{"id":1},{"id":2}]`,
+			expectedResults: []interface{}{map[string]interface{}{"id": 1}, map[string]interface{}{"id": 2}},
+		},
+		{
+			name:            "nil policy",
+			data:            `[{"id":1},2,[3]]`,
+			expectedResults: []interface{}{map[string]interface{}{"id": 1}, 2, []interface{}{3}},
+		},
+		{
+			name: "nil policy with top-level scalar",
+			data: `42`,
+			err:  ErrUnsupportedProtobufType,
+		},
+		{
+			name:   "fail",
+			policy: &ScalarPolicy{Mode: ScalarModeFail},
+			data:   `42`,
+			err:    ErrUnsupportedProtobufType,
+		},
+		{
+			name:   "wrap with default key",
+			policy: &ScalarPolicy{Mode: ScalarModeWrap},
+			data:   `[1,"a",true,null,[2],{"id":3}]`,
+			expectedResults: []interface{}{
+				map[string]interface{}{"value": 1},
+				map[string]interface{}{"value": "a"},
+				map[string]interface{}{"value": true},
+				map[string]interface{}{"value": nil},
+				map[string]interface{}{"value": []interface{}{2}},
+				map[string]interface{}{"id": 3},
+			},
+		},
+		{
+			name:            "wrap with key",
+			policy:          &ScalarPolicy{Mode: ScalarModeWrap, Key: "count"},
+			data:            `42`,
+			expectedResults: []interface{}{map[string]interface{}{"count": 42}},
+		},
+		{
+			name:            "skip",
+			policy:          &ScalarPolicy{Mode: ScalarModeSkip},
+			data:            `[1,{"id":2},"a"]`,
+			expectedResults: []interface{}{map[string]interface{}{"id": 2}},
+		},
+	} {
+		tcase := tcase
+
+		t.Run(tcase.name, func(t *testing.T) {
+			t.Parallel()
+
+			list := &structpb.ListValue{}
+			if err := decodeFuncJSON(strings.NewReader(tcase.data))(list); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			got := &structpb.ListValue{}
+
+			err := tcase.policy.apply(func(checked *structpb.ListValue) error {
+				got.Values = append(got.Values, checked.Values...)
+
+				return nil
+			})(list)
+			if !errors.Is(err, tcase.err) {
+				t.Fatalf("expected error %v, got %v", tcase.err, err)
+			}
+
+			if tcase.err != nil {
+				return
+			}
+
+			expectedList, err := structpb.NewList(tcase.expectedResults)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if !proto.Equal(expectedList, got) {
+				t.Fatalf("unexpected list: %v", got)
+			}
+		})
+	}
+}
+
+func TestHTTPServiceStoreScalarPolicy(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		switch r.URL.Path {
+		case "/nested":
+			fmt.Fprint(w, `[[1,2]]`)
+		case "/scalar":
+			fmt.Fprint(w, `42`)
+		default:
+			fmt.Fprint(w, `[1,2,3]`)
+		}
+	}))
+	defer server.Close()
+
+	for _, tcase := range []struct {
+		name      string
+		path      string
+		svcPolicy *ScalarPolicy
+		reqPolicy *ScalarPolicy
+		want      []byte
+		err       error
+	}{
+		// Without a policy, the elements of a top-level array are
+		// written as they are.
+		{
+			name: "no policy",
+			want: []byte(`[1,2,3]`),
+		},
+		{
+			name: "no policy with nested arrays",
+			path: "/nested",
+			want: []byte(`[[1,2]]`),
+		},
+		{
+			name: "no policy with top-level scalar",
+			path: "/scalar",
+			err:  ErrUnsupportedProtobufType,
+		},
+		{
+			name:      "service policy",
+			svcPolicy: &ScalarPolicy{Mode: ScalarModeWrap, Key: "id"},
+			want:      []byte(`[{"id":1},{"id":2},{"id":3}]`),
+		},
+		{
+			name:      "request policy overrides service",
+			svcPolicy: &ScalarPolicy{Mode: ScalarModeFail},
+			reqPolicy: &ScalarPolicy{Mode: ScalarModeSkip},
+			want:      []byte(`[]`),
+		},
+	} {
+		svc, err := NewService(context.Background())
+		if err != nil {
+			t.Fatalf("failed to create service: %v", err)
+		}
+
+		req, err := http.NewRequestWithContext(context.Background(), http.MethodGet, server.URL+tcase.path, nil)
+		if err != nil {
+			t.Fatalf("failed to create request: %v", err)
+		}
+
+		writer := &mockListWriter{}
+
+		svc.HTTP.
+			Client(server.Client()).
+			ScalarPolicy(tcase.svcPolicy).
+			Requests(NewHTTPRequest(req, WithWriters(writer), WithScalarPolicy(tcase.reqPolicy)))
+
+		err = svc.HTTP.Store(context.Background())
+		if !errors.Is(err, tcase.err) {
+			t.Fatalf("%s: expected error %v, got %v", tcase.name, tcase.err, err)
+		}
+
+		if tcase.err != nil {
+			continue
+		}
+
+		assertSocketWrites(t, []ListWriter{writer}, [][]byte{tcase.want})
+	}
+}
+
+func TestSocketStoreScalarPolicy(t *testing.T) {
+	t.Parallel()
+
+	for _, tcase := range []struct {
+		name   string
+		data   string
+		policy *ScalarPolicy
+		want   []byte
+		err    error
+	}{
+		{
+			name: "no policy",
+			data: `[1,2]`,
+			want: []byte(`[1,2]`),
+		},
+		{
+			name: "no policy with nested arrays",
+			data: `[[1,2]]`,
+			want: []byte(`[[1,2]]`),
+		},
+		{
+			name: "no policy with top-level scalar",
+			data: `42`,
+			err:  ErrUnsupportedProtobufType,
+		},
+		{
+			name:   "wrap",
+			data:   `[1,2]`,
+			policy: &ScalarPolicy{Mode: ScalarModeWrap},
+			want:   []byte(`[{"value":1},{"value":2}]`),
+		},
+	} {
+		tcase := tcase
+
+		t.Run(tcase.name, func(t *testing.T) {
+			t.Parallel()
+
+			writer := &mockListWriter{}
+
+			socket := NewSocket(&mockConn{readData: [][]byte{[]byte(tcase.data)}},
+				WithSocketWriters(writer),
+				WithSocketScalarPolicy(tcase.policy))
+
+			err := NewSocketService(nil).Connections(socket).Store(context.Background())
+			if !errors.Is(err, tcase.err) {
+				t.Fatalf("expected error %v, got %v", tcase.err, err)
+			}
+
+			if tcase.err != nil {
+				return
+			}
+
+			assertSocketWrites(t, []ListWriter{writer}, [][]byte{tcase.want})
+		})
+	}
+}
@@ -0,0 +1,298 @@
+// Copyright 2023 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+
+package gidari
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"google.golang.org/protobuf/proto"
+	structpb "google.golang.org/protobuf/types/known/structpb"
+)
+
+// ErrInvalidSelector is returned when a selector expression can not be parsed.
+var ErrInvalidSelector = fmt.Errorf("invalid selector")
+
+type selectorStepKind int
+
+const (
+	selectorField selectorStepKind = iota
+	selectorIndex
+	selectorWildcard
+)
+
+type selectorStep struct {
+	kind  selectorStepKind
+	name  string
+	index int
+}
+
+type envelopeField struct {
+	steps []selectorStep
+	key   string
+}
+
+// selector picks the records out of the values decoded from a response.
+type selector struct {
+	steps  []selectorStep
+	fields []envelopeField
+
+	// err is the error from parsing the expressions, which is returned when
+	// the selector is used.
+	err error
+}
+
+// SelectorOption is a function for configuring a selector.
+type SelectorOption func(*selector)
+
+// WithEnvelopeField will merge the value at the path in the envelope into each
+// selected record under the key. If the key is empty, then the last name in the
+// path is used. The path uses the same syntax as the selector, e.g.
+// "$.meta.page" or "meta.page". Fields of the record take precedence over
+// envelope fields and records that are not objects are left as they are.
+func WithEnvelopeField(path, key string) SelectorOption {
+	return func(sel *selector) {
+		steps, err := parseSelector(path)
+		if err != nil {
+			sel.err = err
+
+			return
+		}
+
+		if key == "" {
+			for idx := len(steps) - 1; idx >= 0; idx-- {
+				if steps[idx].kind == selectorField {
+					key = steps[idx].name
+
+					break
+				}
+			}
+		}
+
+		if key == "" {
+			sel.err = fmt.Errorf("%w: no key for envelope field %q", ErrInvalidSelector, path)
+
+			return
+		}
+
+		sel.fields = append(sel.fields, envelopeField{steps: steps, key: key})
+	}
+}
+
+// WithSelector will select the records to write from each value decoded from
+// the response, e.g. the top-level JSON object. The selector is a JSONPath or a
+// dot-separated path, such as "$.data.items[*]" or "data.items", and supports:
+//
+//   - object members by name, e.g. ".items" or "['items']"
+//   - array elements by index, e.g. "[0]", where negative indexes count from
+//     the end of the array
+//   - all array elements or object members with a wildcard, e.g. "[*]" or ".*"
+//
+// A selected array is flattened into its elements. Missing and null nodes are
+// skipped. An invalid selector is reported when the request's response is
+// decoded, wrapping ErrInvalidSelector.
+func WithSelector(expr string, opts ...SelectorOption) RequestOption {
+	return func(req *Request) {
+		sel := &selector{}
+
+		sel.steps, sel.err = parseSelector(expr)
+
+		for _, opt := range opts {
+			opt(sel)
+		}
+
+		req.selector = sel
+	}
+}
+
+// parseSelector will parse the selector expression into steps.
+func parseSelector(expr string) ([]selectorStep, error) {
+	rest := strings.TrimPrefix(strings.TrimSpace(expr), "$")
+
+	var steps []selectorStep
+
+	for first := true; rest != ""; first = false {
+		switch {
+		case rest[0] == '[':
+			end := strings.IndexByte(rest, ']')
+			if end < 0 {
+				return nil, fmt.Errorf("%w: unclosed bracket in %q", ErrInvalidSelector, expr)
+			}
+
+			step, err := parseSelectorBracket(strings.TrimSpace(rest[1:end]))
+			if err != nil {
+				return nil, fmt.Errorf("%w in %q", err, expr)
+			}
+
+			steps = append(steps, step)
+			rest = rest[end+1:]
+
+			continue
+		case rest[0] == '.':
+			rest = rest[1:]
+		case !first:
+			return nil, fmt.Errorf("%w: unexpected %q in %q", ErrInvalidSelector, rest[0], expr)
+		}
+
+		end := strings.IndexAny(rest, ".[")
+		if end < 0 {
+			end = len(rest)
+		}
+
+		name := rest[:end]
+		rest = rest[end:]
+
+		switch name {
+		case "":
+			return nil, fmt.Errorf("%w: empty name in %q", ErrInvalidSelector, expr)
+		case "*":
+			steps = append(steps, selectorStep{kind: selectorWildcard})
+		default:
+			steps = append(steps, selectorStep{kind: selectorField, name: name})
+		}
+	}
+
+	return steps, nil
+}
+
+// parseSelectorBracket will parse the contents of a bracket in a selector,
+// which is a wildcard, an index or a quoted name.
+func parseSelectorBracket(inner string) (selectorStep, error) {
+	if inner == "*" {
+		return selectorStep{kind: selectorWildcard}, nil
+	}
+
+	if len(inner) >= 2 && (inner[0] == '\'' || inner[0] == '"') && inner[len(inner)-1] == inner[0] {
+		return selectorStep{kind: selectorField, name: inner[1 : len(inner)-1]}, nil
+	}
+
+	index, err := strconv.Atoi(inner)
+	if err != nil {
+		return selectorStep{}, fmt.Errorf("%w: invalid bracket %q", ErrInvalidSelector, inner)
+	}
+
+	return selectorStep{kind: selectorIndex, index: index}, nil
+}
+
+// selectNodes will return the nodes in the value that match the steps.
+func selectNodes(val *structpb.Value, steps []selectorStep) []*structpb.Value {
+	nodes := []*structpb.Value{val}
+
+	for _, step := range steps {
+		var next []*structpb.Value
+
+		for _, node := range nodes {
+			switch step.kind {
+			case selectorField:
+				if field, ok := node.GetStructValue().GetFields()[step.name]; ok {
+					next = append(next, field)
+				}
+			case selectorIndex:
+				values := node.GetListValue().GetValues()
+
+				index := step.index
+				if index < 0 {
+					index += len(values)
+				}
+
+				if index >= 0 && index < len(values) {
+					next = append(next, values[index])
+				}
+			case selectorWildcard:
+				if list := node.GetListValue(); list != nil {
+					next = append(next, list.Values...)
+				}
+
+				// Select the members of an object in a deterministic
+				// order.
+				fields := node.GetStructValue().GetFields()
+
+				keys := make([]string, 0, len(fields))
+				for key := range fields {
+					keys = append(keys, key)
+				}
+
+				sort.Strings(keys)
+
+				for _, key := range keys {
+					next = append(next, fields[key])
+				}
+			}
+		}
+
+		nodes = next
+	}
+
+	return nodes
+}
+
+// apply will return a flush function that passes the records selected from
+// each value to the given flush function.
+func (sel *selector) apply(flush func(list *structpb.ListValue) error) func(list *structpb.ListValue) error {
+	return func(list *structpb.ListValue) error {
+		selected := &structpb.ListValue{}
+
+		// Select from the elements of a top-level array, see
+		// "addValue".
+		var envelopes []*structpb.Value
+
+		for _, val := range list.Values {
+			if elems := val.GetListValue(); elems != nil {
+				envelopes = append(envelopes, elems.Values...)
+			} else {
+				envelopes = append(envelopes, val)
+			}
+		}
+
+		for _, val := range envelopes {
+			records := &structpb.ListValue{}
+
+			for _, node := range selectNodes(val, sel.steps) {
+				if _, ok := node.Kind.(*structpb.Value_NullValue); ok {
+					continue
+				}
+
+				addValue(records, node)
+			}
+
+			sel.merge(val, records)
+
+			selected.Values = append(selected.Values, records.Values...)
+		}
+
+		return flush(selected)
+	}
+}
+
+// merge will merge the envelope fields into each record.
+func (sel *selector) merge(envelope *structpb.Value, records *structpb.ListValue) {
+	for _, field := range sel.fields {
+		nodes := selectNodes(envelope, field.steps)
+		if len(nodes) == 0 {
+			continue
+		}
+
+		for _, record := range records.Values {
+			obj := record.GetStructValue()
+			if obj == nil {
+				continue
+			}
+
+			if obj.Fields == nil {
+				obj.Fields = make(map[string]*structpb.Value)
+			}
+
+			if _, ok := obj.Fields[field.key]; !ok {
+				obj.Fields[field.key], _ = proto.Clone(nodes[0]).(*structpb.Value)
+			}
+		}
+	}
+}
@@ -0,0 +1,280 @@
+// Copyright 2023 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+
+package gidari
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"google.golang.org/protobuf/proto"
+	structpb "google.golang.org/protobuf/types/known/structpb"
+)
+
+func TestParseSelector(t *testing.T) {
+	t.Parallel()
+
+	for _, tcase := range []struct {
+		expr string
+		want []selectorStep
+		err  bool
+	}{
+		{expr: ""},
+		{expr: "$"},
+		{
+			expr: "data.items",
+			want: []selectorStep{{name: "data"}, {name: "items"}},
+		},
+		{
+			expr: "$.data.items[*]",
+			want: []selectorStep{{name: "data"}, {name: "items"}, {kind: selectorWildcard}},
+		},
+		{
+			expr: "$['data'][\"the.items\"][-1].*",
+			want: []selectorStep{
+				{name: "data"},
+				{name: "the.items"},
+				{kind: selectorIndex, index: -1},
+				{kind: selectorWildcard},
+			},
+		},
+		{
+			expr: "$[0].id",
+			want: []selectorStep{{kind: selectorIndex}, {name: "id"}},
+		},
+		{expr: "$..items", err: true},
+		{expr: "data.", err: true},
+		{expr: "data[", err: true},
+		{expr: "data[x]", err: true},
+		{expr: "data[0]items", err: true},
+	} {
+		tcase := tcase
+
+		t.Run(tcase.expr, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := parseSelector(tcase.expr)
+			if tcase.err {
+				if !errors.Is(err, ErrInvalidSelector) {
+					t.Fatalf("expected error %v, got %v", ErrInvalidSelector, err)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if fmt.Sprint(got) != fmt.Sprint(tcase.want) {
+				t.Fatalf("parseSelector(%q) = %v, want %v", tcase.expr, got, tcase.want)
+			}
+		})
+	}
+}
+
+func TestSelectorApply(t *testing.T) {
+	t.Parallel()
+
+	const envelope = `{
+		"data": {"items": [{"id": 1}, {"id": 2, "page": 9}]},
+		"meta": {"page": 3, "next": null},
+		"groups": {"b": [{"id": 4}], "a": [{"id": 3}]}
+	}`
+
+	for _, tcase := range []struct {
+		name            string
+		data            string
+		expr            string
+		opts            []SelectorOption
+		expectedResults []interface{}
+	}{
+		{
+			name: "object",
+			data: envelope,
+			expr: "$.meta",
+			expectedResults: []interface{}{
+				map[string]interface{}{"page": 3, "next": nil},
+			},
+		},
+		{
+			name: "items",
+			data: envelope,
+			expr: "$.data.items[*]",
+			expectedResults: []interface{}{
+				map[string]interface{}{"id": 1},
+				map[string]interface{}{"id": 2, "page": 9},
+			},
+		},
+		{
+			name: "flattened array",
+			data: envelope,
+			expr: "data.items",
+			expectedResults: []interface{}{
+				map[string]interface{}{"id": 1},
+				map[string]interface{}{"id": 2, "page": 9},
+			},
+		},
+		{
+			name: "index",
+			data: envelope,
+			expr: "data.items[-1]",
+			expectedResults: []interface{}{
+				map[string]interface{}{"id": 2, "page": 9},
+			},
+		},
+		{
+			name: "object wildcard",
+			data: envelope,
+			expr: "groups.*[*]",
+			expectedResults: []interface{}{
+				map[string]interface{}{"id": 3},
+				map[string]interface{}{"id": 4},
+			},
+		},
+		{
+			name: "missing and null nodes",
+			data: envelope,
+			expr: "meta.next",
+		},
+		{
+			name: "each value",
+			data: `[{"items": [{"id": 1}]}, {"items": [{"id": 2}]}]`,
+			expr: "items[*]",
+			expectedResults: []interface{}{
+				map[string]interface{}{"id": 1},
+				map[string]interface{}{"id": 2},
+			},
+		},
+		{
+			name: "envelope fields",
+			data: envelope,
+			expr: "$.data.items[*]",
+			opts: []SelectorOption{
+				WithEnvelopeField("$.meta.page", ""),
+				WithEnvelopeField("meta", "envelope"),
+				WithEnvelopeField("missing", ""),
+			},
+			expectedResults: []interface{}{
+				map[string]interface{}{
+					"id":       1,
+					"page":     3,
+					"envelope": map[string]interface{}{"page": 3, "next": nil},
+				},
+				map[string]interface{}{
+					"id":       2,
+					"page":     9,
+					"envelope": map[string]interface{}{"page": 3, "next": nil},
+				},
+			},
+		},
+		{
+			name:            "scalar",
+			data:            envelope,
+			expr:            "meta.page",
+			expectedResults: []interface{}{3},
+		},
+	} {
+		tcase := tcase
+
+		t.Run(tcase.name, func(t *testing.T) {
+			t.Parallel()
+
+			req := NewHTTPRequest(nil, WithSelector(tcase.expr, tcase.opts...))
+			if req.selector.err != nil {
+				t.Fatalf("unexpected error: %v", req.selector.err)
+			}
+
+			list := &structpb.ListValue{}
+			if err := decodeFuncJSON(strings.NewReader(tcase.data))(list); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			got := &structpb.ListValue{}
+
+			err := req.selector.apply(func(selected *structpb.ListValue) error {
+				got.Values = append(got.Values, selected.Values...)
+
+				return nil
+			})(list)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			expectedList, err := structpb.NewList(tcase.expectedResults)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if !proto.Equal(expectedList, got) {
+				t.Fatalf("unexpected list: %v", got)
+			}
+		})
+	}
+}
+
+func TestHTTPServiceStoreSelector(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"data":{"items":[{"id":1},{"id":2}]},"meta":{"page":1}}`)
+	}))
+	defer server.Close()
+
+	for _, tcase := range []struct {
+		name string
+		expr string
+		err  error
+	}{
+		{
+			name: "valid selector",
+			expr: "$.data.items[*]",
+		},
+		{
+			name: "invalid selector",
+			expr: "$..items",
+			err:  ErrInvalidSelector,
+		},
+	} {
+		svc, err := NewService(context.Background())
+		if err != nil {
+			t.Fatalf("failed to create service: %v", err)
+		}
+
+		req, err := http.NewRequestWithContext(context.Background(), http.MethodGet, server.URL, nil)
+		if err != nil {
+			t.Fatalf("failed to create request: %v", err)
+		}
+
+		writer := &mockListWriter{}
+
+		svc.HTTP.Client(server.Client()).BatchSize(1).Requests(NewHTTPRequest(req,
+			WithWriters(writer),
+			WithSelector(tcase.expr, WithEnvelopeField("meta.page", ""))))
+
+		err = svc.HTTP.Store(context.Background())
+		if !errors.Is(err, tcase.err) {
+			t.Fatalf("%s: expected error %v, got %v", tcase.name, tcase.err, err)
+		}
+
+		if tcase.err != nil {
+			continue
+		}
+
+		assertSocketWrites(t, []ListWriter{writer}, [][]byte{
+			[]byte(`[{"id":1,"page":1}]`),
+			[]byte(`[{"id":2,"page":1}]`),
+		})
+	}
+}
@@ -9,8 +9,15 @@
 package gidari
 
 import (
+	"bytes"
 	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
 	"sync"
+	"time"
 
 	structpb "google.golang.org/protobuf/types/known/structpb"
 )
@@ -25,6 +32,10 @@ type Service struct {
 	// Socket is used for transporting and processing data over a socket
 	// connection.
 	Socket *SocketService
+
+	// deadLetters receives the data that can not be stored, if set. See
+	// "WithDeadLetterSink".
+	deadLetters DeadLetterSink
 }
 
 // ServiceOption is a function for configuring a Service.
@@ -49,101 +60,370 @@ type ListWriter interface {
 	Write(cxt context.Context, list *structpb.ListValue) error
 }
 
+// ListMeta describes the source of the data in a list.
+type ListMeta struct {
+	// Request is the HTTP request that produced the data. It is nil for
+	// data read from a socket.
+	Request *http.Request
+
+	// StatusCode and Header are the status code and headers of the HTTP
+	// response.
+	StatusCode int
+	Header     http.Header
+
+	// RequestedAt is the time that the HTTP request was sent, i.e. the time
+	// of the final attempt if the request was retried.
+	RequestedAt time.Time
+
+	// ReceivedAt is the time that the HTTP response headers or the socket
+	// message were received.
+	ReceivedAt time.Time
+
+	// Page is the one-based number of the HTTP response in a sequence of
+	// paginated requests.
+	Page int
+
+	// Batch is the zero-based index of the list among the lists written for
+	// the same HTTP response or socket message. See "WithBatchSize".
+	Batch int
+
+	// SocketID is the identity of the socket, set with the "WithSocketID"
+	// option, and Message is the one-based number of the socket message.
+	SocketID string
+	Message  int
+}
+
+// MetaListWriter is a ListWriter that also accepts the metadata describing the
+// source of the data, e.g. for lineage or idempotent upserts. If a writer
+// implements MetaListWriter, then "WriteWithMeta" is called instead of
+// "Write".
+type MetaListWriter interface {
+	ListWriter
+
+	WriteWithMeta(ctx context.Context, list *structpb.ListValue, meta *ListMeta) error
+}
+
+// Flusher is a ListWriter that buffers data. The services will call "Flush"
+// once for every distinct writer when they finish storing data, including when
+// they fail or the context is canceled.
+type Flusher interface {
+	Flush() error
+}
+
+// Closer is a ListWriter that holds resources that must be released. The
+// services will call "Close" once for every distinct writer when they finish
+// storing data, after any call to "Flush".
+type Closer interface {
+	Close() error
+}
+
+// distinctWriters will return the writers with duplicates removed, in the order
+// that they are first seen. Writers that can not be compared are assumed to be
+// distinct.
+func distinctWriters(groups ...[]ListWriter) []ListWriter {
+	seen := make(map[ListWriter]bool)
+
+	var writers []ListWriter
+
+	for _, group := range groups {
+		for _, writer := range group {
+			if writer == nil {
+				continue
+			}
+
+			if reflect.TypeOf(writer).Comparable() {
+				if seen[writer] {
+					continue
+				}
+
+				seen[writer] = true
+			}
+
+			writers = append(writers, writer)
+		}
+	}
+
+	return writers
+}
+
+// withoutWriter will return the writers other than the writer.
+func withoutWriter(writers []ListWriter, writer ListWriter) []ListWriter {
+	if writer == nil || !reflect.TypeOf(writer).Comparable() {
+		return writers
+	}
+
+	var others []ListWriter
+
+	for _, other := range writers {
+		if other != writer {
+			others = append(others, other)
+		}
+	}
+
+	return others
+}
+
+// finishWriters will flush and then close each of the writers and the
+// dead-letter sink, if any, returning the errors encountered joined together.
+// The sink is finished last, since it may be written to until then.
+func finishWriters(writers []ListWriter, sink DeadLetterSink) error {
+	var errs []error
+
+	// A writer that is also the sink's writer is finished with the sink,
+	// so that it is finished once.
+	if deadLetters, ok := sink.(*deadLetterWriter); ok {
+		writers = withoutWriter(writers, deadLetters.writer)
+	}
+
+	finish := func(writer any) {
+		if flusher, ok := writer.(Flusher); ok {
+			if err := flusher.Flush(); err != nil {
+				errs = append(errs, fmt.Errorf("failed to flush writer: %w", err))
+			}
+		}
+
+		if closer, ok := writer.(Closer); ok {
+			if err := closer.Close(); err != nil {
+				errs = append(errs, fmt.Errorf("failed to close writer: %w", err))
+			}
+		}
+	}
+
+	for _, writer := range writers {
+		finish(writer)
+	}
+
+	if sink != nil {
+		finish(sink)
+	}
+
+	return joinErrors(errs...)
+}
+
+// joinedError is an error that wraps multiple errors. It is equivalent to the
+// errors returned by "errors.Join" in Go 1.20, but also supports "errors.Is"
+// and "errors.As" in earlier versions.
+type joinedError struct {
+	errs []error
+}
+
+// joinErrors will return an error that wraps the non-nil errors. If there are
+// no non-nil errors, then nil is returned, and if there is only one, then it
+// is returned as is.
+func joinErrors(errs ...error) error {
+	var nonNil []error
+
+	for _, err := range errs {
+		if err != nil {
+			nonNil = append(nonNil, err)
+		}
+	}
+
+	switch len(nonNil) {
+	case 0:
+		return nil
+	case 1:
+		return nonNil[0]
+	default:
+		return &joinedError{errs: nonNil}
+	}
+}
+
+func (err *joinedError) Error() string {
+	msgs := make([]string, len(err.errs))
+	for idx, err := range err.errs {
+		msgs[idx] = err.Error()
+	}
+
+	return strings.Join(msgs, "\n")
+}
+
+// Unwrap will return the joined errors.
+func (err *joinedError) Unwrap() []error {
+	return err.errs
+}
+
+// Is will report whether any of the joined errors matches the target.
+func (err *joinedError) Is(target error) bool {
+	for _, err := range err.errs {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// As will find the first of the joined errors that matches the target.
+func (err *joinedError) As(target any) bool {
+	for _, err := range err.errs {
+		if errors.As(err, target) {
+			return true
+		}
+	}
+
+	return false
+}
+
 type listWriterJob struct {
-	decFunc DecodeFunc
+	decFunc StreamDecodeFunc
 	writers []ListWriter
+	meta    ListMeta
+
+	// deadLetters receives the data that the job fails to store, if set,
+	// and body is the recorded data that the job decodes.
+	deadLetters DeadLetterSink
+	body        *bytes.Buffer
+
+	// tracker keeps track of the outcome of the job's request, if any.
+	tracker *requestTracker
+
+	// req is the request that produced the data and attempt is the number
+	// of times it was made. The request is nil for socket messages.
+	req     *Request
+	attempt int
+}
+
+// wrapError will wrap the error with the context of the job's request or
+// socket.
+func (job *listWriterJob) wrapError(err error) error {
+	if job.req == nil {
+		return newSocketError(job.meta.SocketID, job.meta.Message, err)
+	}
+
+	return newRequestError(job.req, job.attempt, job.meta.StatusCode, err)
+}
+
+// writeChunk will write the list to all of the writers concurrently, returning
+// the first error encountered, which identifies the writer that failed. Each
+// MetaListWriter receives its own copy of the metadata.
+func writeChunk(ctx context.Context, writers []ListWriter, list *structpb.ListValue, meta ListMeta) error {
+	errs := make(chan error, len(writers))
+
+	wg := &sync.WaitGroup{}
+	wg.Add(len(writers))
+
+	for _, writer := range writers {
+		go func(writer ListWriter) {
+			defer wg.Done()
+
+			var err error
+			if metaWriter, ok := writer.(MetaListWriter); ok {
+				meta := meta
+				err = metaWriter.WriteWithMeta(ctx, list, &meta)
+			} else {
+				err = writer.Write(ctx, list)
+			}
+
+			if err != nil {
+				errs <- &writerError{writer: writer, err: err}
+			}
+		}(writer)
+	}
+
+	wg.Wait()
+	close(errs)
+
+	return <-errs
 }
 
+// writeList will decode the job's data and write each decoded chunk to the
+// job's writers.
+//
+// If the job has a dead-letter sink, then the chunks that fail to write are
+// sent to the sink and the job continues, and if the data fails to decode, then
+// the recorded body is sent to the sink. In that case, the job only fails if
+// the sink fails or the context is done.
 func writeList(ctx context.Context, job *listWriterJob) <-chan error {
 	errs := make(chan error, 1)
 
 	go func() {
 		defer close(errs)
 
-		list := &structpb.ListValue{}
-		if err := job.decFunc(list); err != nil {
-			errs <- err
+		meta := job.meta
 
-			return
-		}
+		// sinkErr is the error from the sink, which must not be sent
+		// to the sink itself.
+		var sinkErr error
 
-		wg := &sync.WaitGroup{}
-		wg.Add(len(job.writers))
+		err := job.decFunc(func(list *structpb.ListValue) error {
+			defer func() { meta.Batch++ }()
 
-		for _, writer := range job.writers {
-			writer := writer
+			err := job.wrapError(writeChunk(ctx, job.writers, list, meta))
+			if err == nil {
+				job.tracker.addRecords(len(list.GetValues()))
 
-			go func(writer ListWriter) {
-				defer wg.Done()
+				return nil
+			}
 
-				if err := writer.Write(ctx, list); err != nil {
-					errs <- err
-				}
-			}(writer)
+			if job.deadLetters == nil || ctx.Err() != nil {
+				return err
+			}
+
+			sinkErr = job.writeDeadLetter(ctx, &DeadLetter{Err: err, Meta: meta, List: list})
+
+			return sinkErr
+		})
+		err = job.wrapError(err)
+
+		if err != nil && sinkErr == nil && job.deadLetters != nil && ctx.Err() == nil {
+			var body []byte
+			if job.body != nil {
+				body = job.body.Bytes()
+			}
+
+			err = job.writeDeadLetter(ctx, &DeadLetter{Err: err, Meta: meta, Body: body})
 		}
 
-		wg.Wait()
+		job.tracker.finish(err)
+
+		if err != nil {
+			errs <- err
+		}
 	}()
 
 	return errs
 }
 
-// upsertWorkerJobs := make(chan listWriterJob)
-// go startListWriter(ctx, listWriterConfig{
-//	id:    1,
-//	jobs:  upsertWorkerJobs,
-//	errCh: errs,
-// })
-
 type listWriterChan struct {
-	done <-chan struct{}
 	err  <-chan error
 	jobs chan<- listWriterJob
 }
 
 // startListWriter will start a worker to upsert data from HTTP responses into
-// a database.
-func startListWriter(ctx context.Context, numJobs int) listWriterChan {
-	if numJobs == 0 {
-		numJobs = 1
+// a database. The worker will process jobs until the jobs channel is closed,
+// at which point the first error encountered, if any, is sent to the error
+// channel.
+func startListWriter(ctx context.Context, bufSize int) listWriterChan {
+	if bufSize <= 0 {
+		bufSize = 1
 	}
 
-	var (
-		jobs  chan listWriterJob
-		done  chan struct{}
-		errCh chan error
-	)
-
-	if numJobs > 0 {
-		done = make(chan struct{}, numJobs)
-		jobs = make(chan listWriterJob, numJobs)
-	} else {
-		jobs = make(chan listWriterJob)
-	}
-
-	errCh = make(chan error, 1)
+	jobs := make(chan listWriterJob, bufSize)
+	errCh := make(chan error, 1)
 
 	go func() {
 		defer close(errCh)
 
-		if done != nil {
-			defer close(done)
-		}
+		var firstErr error
 
+		// Drain the jobs channel regardless of errors so that the
+		// producer is never blocked.
 		for job := range jobs {
+			job := job
+
 			errs := writeList(ctx, &job)
-			if err := <-errs; err != nil {
-				errCh <- err
+			if err := <-errs; err != nil && firstErr == nil {
+				firstErr = err
 			}
+		}
 
-			if done != nil {
-				done <- struct{}{}
-			}
+		if firstErr != nil {
+			errCh <- firstErr
 		}
 	}()
 
 	return listWriterChan{
-		done: done,
 		err:  errCh,
 		jobs: jobs,
 	}
@@ -0,0 +1,211 @@
+// Copyright 2023 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+
+package gidari
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+)
+
+func TestHTTPServiceStoreMeta(t *testing.T) {
+	t.Parallel()
+
+	const pageCount = 2
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+		if page < pageCount {
+			w.Header().Set("Link", fmt.Sprintf(`</items?page=%d>; rel="next"`, page+1))
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("X-Page", strconv.Itoa(page))
+		fmt.Fprintf(w, `[{"page":%d},{"page":%d}]`, page, page)
+	}))
+	defer server.Close()
+
+	svc, err := NewService(context.Background())
+	if err != nil {
+		t.Fatalf("failed to create service: %v", err)
+	}
+
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodGet, server.URL+"/items?page=1", nil)
+	if err != nil {
+		t.Fatalf("failed to create request: %v", err)
+	}
+
+	metaWriter := &mockMetaListWriter{}
+	writer := &mockListWriter{}
+
+	// Use a single worker so that the pages are written in order.
+	svc.HTTP.Client(server.Client()).MaxInFlight(1).Requests(NewHTTPRequest(req,
+		WithWriters(metaWriter, writer),
+		WithPaginator(NewLinkHeaderPaginator()),
+		WithBatchSize(1)))
+
+	if err := svc.HTTP.Store(context.Background()); err != nil {
+		t.Fatalf("failed to store: %v", err)
+	}
+
+	// Plain list writers must still be written to.
+	if writer.count != 2*pageCount {
+		t.Fatalf("expected %d writes, got %d", 2*pageCount, writer.count)
+	}
+
+	if metaWriter.count != 2*pageCount || len(metaWriter.metas) != 2*pageCount {
+		t.Fatalf("expected %d writes with metadata, got %d", 2*pageCount, len(metaWriter.metas))
+	}
+
+	for idx, meta := range metaWriter.metas {
+		page, batch := idx/2+1, idx%2
+
+		if meta.Page != page || meta.Batch != batch {
+			t.Fatalf("write %d: page, batch = %d, %d, want %d, %d", idx, meta.Page, meta.Batch, page, batch)
+		}
+
+		if got := meta.Request.URL.Query().Get("page"); got != strconv.Itoa(page) {
+			t.Fatalf("write %d: request page = %q, want %d", idx, got, page)
+		}
+
+		if meta.StatusCode != http.StatusOK || meta.Header.Get("X-Page") != strconv.Itoa(page) {
+			t.Fatalf("write %d: unexpected response metadata: %d %v", idx, meta.StatusCode, meta.Header)
+		}
+
+		if meta.RequestedAt.IsZero() || meta.ReceivedAt.Before(meta.RequestedAt) {
+			t.Fatalf("write %d: unexpected timestamps: %v, %v", idx, meta.RequestedAt, meta.ReceivedAt)
+		}
+	}
+}
+
+func TestSocketStoreMeta(t *testing.T) {
+	t.Parallel()
+
+	writer := &mockMetaListWriter{}
+
+	socket := NewSocket(&mockConn{readData: [][]byte{[]byte(`[{"x":1}]`), []byte(`[{"x":2}]`)}},
+		WithSocketWriters(writer),
+		WithSocketID("ticker"))
+
+	if err := NewSocketService(nil).Connections(socket).Store(context.Background()); err != nil {
+		t.Fatalf("failed to store: %v", err)
+	}
+
+	if len(writer.metas) != 2 {
+		t.Fatalf("expected 2 writes with metadata, got %d", len(writer.metas))
+	}
+
+	for idx, meta := range writer.metas {
+		if meta.SocketID != "ticker" || meta.Message != idx+1 || meta.Request != nil || meta.ReceivedAt.IsZero() {
+			t.Fatalf("write %d: unexpected metadata: %+v", idx, meta)
+		}
+	}
+}
+
+func TestHTTPServiceStoreFinishWriters(t *testing.T) {
+	t.Parallel()
+
+	errFlush := fmt.Errorf("flush error")
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("fail") != "" {
+			w.WriteHeader(http.StatusInternalServerError)
+
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `[{"x":1}]`)
+	}))
+	defer server.Close()
+
+	for _, tcase := range []struct {
+		name     string
+		query    string
+		flushErr error
+		wantErr  []error
+	}{
+		{name: "success"},
+		{name: "bad response", query: "?fail=1", wantErr: []error{ErrBadResponse}},
+		{name: "flush error", flushErr: errFlush, wantErr: []error{errFlush}},
+		{
+			name:     "bad response and flush error",
+			query:    "?fail=1",
+			flushErr: errFlush,
+			wantErr:  []error{ErrBadResponse, errFlush},
+		},
+	} {
+		svc, err := NewService(context.Background())
+		if err != nil {
+			t.Fatalf("failed to create service: %v", err)
+		}
+
+		shared := &mockFlushCloseWriter{flushErr: tcase.flushErr}
+		other := &mockFlushCloseWriter{}
+
+		var reqs []*Request
+
+		for _, writers := range [][]ListWriter{{shared}, {shared, other}, {shared}} {
+			req, err := http.NewRequestWithContext(context.Background(), http.MethodGet, server.URL+tcase.query, nil)
+			if err != nil {
+				t.Fatalf("failed to create request: %v", err)
+			}
+
+			reqs = append(reqs, NewHTTPRequest(req, WithWriters(writers...)))
+		}
+
+		err = svc.HTTP.Client(server.Client()).Requests(reqs...).Store(context.Background())
+
+		for _, wantErr := range tcase.wantErr {
+			if !errors.Is(err, wantErr) {
+				t.Fatalf("%s: expected error %v, got %v", tcase.name, wantErr, err)
+			}
+		}
+
+		if len(tcase.wantErr) == 0 && err != nil {
+			t.Fatalf("%s: failed to store: %v", tcase.name, err)
+		}
+
+		for _, writer := range []*mockFlushCloseWriter{shared, other} {
+			if writer.flushes != 1 || writer.closes != 1 {
+				t.Fatalf("%s: flushes, closes = %d, %d, want 1, 1", tcase.name, writer.flushes, writer.closes)
+			}
+
+			if writer.written != writer.count {
+				t.Fatalf("%s: flushed after %d of %d writes", tcase.name, writer.written, writer.count)
+			}
+		}
+	}
+}
+
+func TestSocketStoreFinishWriters(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	shared := &mockFlushCloseWriter{}
+
+	sockets := []*Socket{
+		NewSocket(&mockConn{readData: [][]byte{[]byte(`[{"x":1}]`)}}, WithSocketWriters(shared)),
+		NewSocket(&mockConnBlocker{}, WithSocketWriters(shared)),
+	}
+
+	if err := NewSocketService(nil).Connections(sockets...).Store(ctx); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected error %v, got %v", context.Canceled, err)
+	}
+
+	if shared.flushes != 1 || shared.closes != 1 {
+		t.Fatalf("flushes, closes = %d, %d, want 1, 1", shared.flushes, shared.closes)
+	}
+}
@@ -9,10 +9,14 @@
 package gidari
 
 import (
+	"bytes"
 	"context"
 	"errors"
 	"fmt"
 	"io"
+	"time"
+
+	structpb "google.golang.org/protobuf/types/known/structpb"
 )
 
 // Socket is a wrapper around a connection that will read from the connection
@@ -22,6 +26,17 @@ type Socket struct {
 	conn    io.ReadWriter
 	done    chan struct{}
 	writers []ListWriter
+	scalars *ScalarPolicy
+
+	// encoding is the content encoding of the messages.
+	encoding string
+
+	// id is the identity of the socket in the metadata of its lists.
+	id string
+
+	// deadLetters receives the data that the socket fails to store, if
+	// set by the service.
+	deadLetters DeadLetterSink
 }
 
 // SocketOption is a function that will configure the socket.
@@ -45,6 +60,14 @@ func WithSocketWriters(writers ...ListWriter) SocketOption {
 	}
 }
 
+// WithSocketID will set the identity of the socket, which is passed to the
+// "WriteWithMeta" method of any MetaListWriter.
+func WithSocketID(id string) SocketOption {
+	return func(sockets *Socket) {
+		sockets.id = id
+	}
+}
+
 // close will signal the socket to stop reading from the connection. This will
 // not close the underlying connection. That is the responsibility of the
 // caller.
@@ -90,10 +113,13 @@ func (soc *Socket) start(ctx context.Context) <-chan error {
 
 		var buffer []byte
 
+		// messages is the number of messages read from the socket.
+		var messages int
+
 		for {
 			select {
 			case <-ctx.Done():
-				errs <- ctx.Err()
+				errs <- newSocketError(soc.id, messages+1, ctx.Err())
 
 				return
 			case <-soc.done:
@@ -107,7 +133,7 @@ func (soc *Socket) start(ctx context.Context) <-chan error {
 					break
 				}
 
-				errs <- err
+				errs <- newSocketError(soc.id, messages+1, err)
 			}
 
 			// Append incoming message to buffer
@@ -115,16 +141,48 @@ func (soc *Socket) start(ctx context.Context) <-chan error {
 
 			// Process incoming messages
 			for {
+				data := buffer
+
+				// Decompress the buffer, if the message is
+				// truncated then wait for more data.
+				if soc.encoding != "" && len(buffer) > 0 {
+					data, err = decompressBytes(buffer, soc.encoding)
+					if errors.Is(err, io.ErrUnexpectedEOF) {
+						break
+					}
+
+					if err != nil {
+						errs <- newSocketError(soc.id, messages+1, err)
+
+						return
+					}
+				}
+
 				// Look for a complete message in the buffer
-				if isPartialJSON(buffer) {
+				if isPartialJSON(data) {
 					// Incomplete message, wait for more
 					// data
 					break
 				}
 
-				job := &listWriterJob{writers: soc.writers}
-				job.decFunc = decodeFuncJSONFromBytes(buffer)
+				messages++
+
+				job := &listWriterJob{
+					writers: soc.writers,
+					meta: ListMeta{
+						ReceivedAt: time.Now(),
+						SocketID:   soc.id,
+						Message:    messages,
+					},
+					deadLetters: soc.deadLetters,
+					body:        bytes.NewBuffer(data),
+				}
+				decFunc := streamDecodeFunc(decodeFuncJSON(bytes.NewReader(data)))
+				job.decFunc = func(flush func(list *structpb.ListValue) error) error {
+					return decFunc(soc.scalars.apply(flush))
+				}
 
+				// The error has the context of the message.
 				if err := <-writeList(ctx, job); err != nil {
 					errs <- err
 
@@ -178,12 +236,26 @@ func (svc *SocketService) Connections(socs ...*Socket) *SocketService {
 // to their respective list writers for socket-to-storage operations. This
 // method will block until all sockets are closed, an error occurs, the context
 // is canceled, or the service is closed.
+//
+// Once the sockets are finished, whether or not they succeed, every distinct
+// writer and the dead-letter sink are flushed and closed if they implement
+// Flusher or Closer.
 func (svc *SocketService) Store(ctx context.Context) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
 	svc.done = make(chan struct{}, 1)
 	socketErrors := make(chan error, len(svc.sockets))
 
+	var sink DeadLetterSink
+	if svc.svc != nil {
+		sink = svc.svc.deadLetters
+	}
+
 	// Start the socket workers.
 	for _, socket := range svc.sockets {
+		socket.deadLetters = sink
+
 		go func(socket *Socket) {
 			if err := <-socket.start(ctx); err != nil {
 				socketErrors <- err
@@ -195,12 +267,23 @@ func (svc *SocketService) Store(ctx context.Context) error {
 		}(socket)
 	}
 
+	var firstErr error
+
 	for i := 0; i < len(svc.sockets); i++ {
 		err := <-socketErrors
-		if err != nil {
-			return err
+		if err != nil && firstErr == nil {
+			firstErr = err
+
+			// Stop the remaining sockets, so that the writers are
+			// not finished while they are still being written to.
+			cancel()
 		}
 	}
 
-	return nil
+	writers := make([][]ListWriter, len(svc.sockets))
+	for idx, socket := range svc.sockets {
+		writers[idx] = socket.writers
+	}
+
+	return joinErrors(firstErr, finishWriters(distinctWriters(writers...), sink))
 }
@@ -0,0 +1,183 @@
+// Copyright 2023 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+
+package gidari
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// defaultMaxErrorBody is the maximum number of bytes of a response body that is
+// kept in a StatusError if the policy does not set one.
+const defaultMaxErrorBody = 4 << 10
+
+// StatusClass is an enum that represents how a response is handled given its
+// status code.
+type StatusClass int32
+
+const (
+	// StatusFatal will fail the request with a *StatusError.
+	StatusFatal StatusClass = iota
+
+	// StatusSuccess will decode the response and write its data.
+	StatusSuccess
+
+	// StatusSkip will discard the response, as if it had no data. For
+	// example, a 204 (No Content) or a 404 (Not Found) for a resource that
+	// is allowed to be missing.
+	StatusSkip
+
+	// StatusRetry will retry the request according to its retry policy. A
+	// response that can not be retried, because there is no retry policy
+	// or the attempts are exhausted, is fatal.
+	StatusRetry
+)
+
+// StatusPolicy defines how responses are handled given their status codes.
+// Status codes that are not in any of the classes are fatal. A nil policy
+// treats 200 (OK) as success and any other status code as fatal.
+type StatusPolicy struct {
+	// Success, Skip and Retry are the status codes of each class.
+	Success []int
+	Skip    []int
+	Retry   []int
+
+	// MaxErrorBody is the maximum number of bytes of the body of a fatal
+	// response that are kept in the StatusError. The default is 4 KiB.
+	MaxErrorBody int
+}
+
+// NewStatusPolicy will return a status policy that treats 200, 201, 202, 203
+// and 206 as success, 204 as skip, and 429, 502, 503 and 504 as retry.
+func NewStatusPolicy() *StatusPolicy {
+	return &StatusPolicy{
+		Success: []int{
+			http.StatusOK,
+			http.StatusCreated,
+			http.StatusAccepted,
+			http.StatusNonAuthoritativeInfo,
+			http.StatusPartialContent,
+		},
+		Skip: []int{http.StatusNoContent},
+		Retry: []int{
+			http.StatusTooManyRequests,
+			http.StatusBadGateway,
+			http.StatusServiceUnavailable,
+			http.StatusGatewayTimeout,
+		},
+	}
+}
+
+// WithStatusPolicy will set the status policy for the request, overriding the
+// policy of the HTTP Service.
+func WithStatusPolicy(policy *StatusPolicy) RequestOption {
+	return func(req *Request) {
+		req.statuses = policy
+	}
+}
+
+// class will return the class of the status code.
+func (policy *StatusPolicy) class(code int) StatusClass {
+	if policy == nil {
+		if code == http.StatusOK {
+			return StatusSuccess
+		}
+
+		return StatusFatal
+	}
+
+	for _, class := range []struct {
+		codes []int
+		class StatusClass
+	}{
+		{codes: policy.Success, class: StatusSuccess},
+		{codes: policy.Skip, class: StatusSkip},
+		{codes: policy.Retry, class: StatusRetry},
+	} {
+		for _, classCode := range class.codes {
+			if code == classCode {
+				return class.class
+			}
+		}
+	}
+
+	return StatusFatal
+}
+
+// retryPolicy will return the retry policy with the policy's retry status codes
+// added to its status codes.
+func (policy *StatusPolicy) retryPolicy(retry *RetryPolicy) *RetryPolicy {
+	if policy == nil || retry == nil || len(policy.Retry) == 0 {
+		return retry
+	}
+
+	merged := *retry
+	merged.StatusCodes = append(append([]int{}, retry.StatusCodes...), policy.Retry...)
+
+	return &merged
+}
+
+// maxErrorBody will return the maximum number of bytes of an error body.
+func (policy *StatusPolicy) maxErrorBody() int {
+	if policy == nil || policy.MaxErrorBody <= 0 {
+		return defaultMaxErrorBody
+	}
+
+	return policy.MaxErrorBody
+}
+
+// StatusError is returned for a response whose status code is fatal according
+// to the status policy. It wraps ErrBadResponse.
+type StatusError struct {
+	// StatusCode and Header are the status code and headers of the
+	// response.
+	StatusCode int
+	Header     http.Header
+
+	// Body is the start of the response body, up to the policy's
+	// "MaxErrorBody" bytes. Truncated is true if the body was longer.
+	Body      []byte
+	Truncated bool
+}
+
+// newStatusError will read up to limit bytes of the response body into a
+// StatusError, and then discard the rest of the response.
+func newStatusError(rsp *http.Response, limit int) *StatusError {
+	statusErr := &StatusError{
+		StatusCode: rsp.StatusCode,
+		Header:     rsp.Header,
+	}
+
+	if rsp.Body != nil {
+		// Read one more byte than the limit to know if the body is
+		// truncated. The body is only informational, so a failure to
+		// read it is not reported.
+		body, _ := io.ReadAll(io.LimitReader(rsp.Body, int64(limit)+1))
+		if len(body) > limit {
+			body = body[:limit]
+			statusErr.Truncated = true
+		}
+
+		statusErr.Body = body
+	}
+
+	discardResponse(rsp)
+
+	return statusErr
+}
+
+func (err *StatusError) Error() string {
+	return fmt.Sprintf("%v: %d", ErrBadResponse, err.StatusCode)
+}
+
+// Unwrap will return ErrBadResponse.
+func (err *StatusError) Unwrap() error {
+	return ErrBadResponse
+}
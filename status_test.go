@@ -0,0 +1,145 @@
+// Copyright 2023 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+
+package gidari
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestStatusPolicyClass(t *testing.T) {
+	t.Parallel()
+
+	for _, tcase := range []struct {
+		name   string
+		policy *StatusPolicy
+		code   int
+		want   StatusClass
+	}{
+		{name: "nil ok", code: http.StatusOK, want: StatusSuccess},
+		{name: "nil created", code: http.StatusCreated, want: StatusFatal},
+		{name: "default created", policy: NewStatusPolicy(), code: http.StatusCreated, want: StatusSuccess},
+		{name: "default no content", policy: NewStatusPolicy(), code: http.StatusNoContent, want: StatusSkip},
+		{name: "default unavailable", policy: NewStatusPolicy(), code: http.StatusServiceUnavailable, want: StatusRetry},
+		{name: "default not found", policy: NewStatusPolicy(), code: http.StatusNotFound, want: StatusFatal},
+		{name: "custom", policy: &StatusPolicy{Skip: []int{http.StatusNotFound}}, code: http.StatusNotFound, want: StatusSkip},
+		{name: "custom ok", policy: &StatusPolicy{Skip: []int{http.StatusNotFound}}, code: http.StatusOK, want: StatusFatal},
+	} {
+		tcase := tcase
+
+		t.Run(tcase.name, func(t *testing.T) {
+			t.Parallel()
+
+			if got := tcase.policy.class(tcase.code); got != tcase.want {
+				t.Fatalf("class = %d, want %d", got, tcase.want)
+			}
+		})
+	}
+}
+
+func TestHTTPServiceStoreStatusPolicy(t *testing.T) {
+	t.Parallel()
+
+	var flaky int32
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		switch r.URL.Path {
+		case "/created":
+			w.WriteHeader(http.StatusCreated)
+			fmt.Fprint(w, `[{"id":1},{"id":2}]`)
+		case "/empty":
+			w.WriteHeader(http.StatusNoContent)
+		case "/missing":
+			w.WriteHeader(http.StatusNotFound)
+		case "/flaky":
+			if atomic.AddInt32(&flaky, 1) == 1 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+
+				return
+			}
+
+			fmt.Fprint(w, `[{"id":3}]`)
+		case "/gone":
+			w.Header().Set("X-Request-Id", "abc")
+			w.WriteHeader(http.StatusGone)
+			fmt.Fprint(w, `{"error":"this resource is gone"}`)
+		}
+	}))
+	defer server.Close()
+
+	svc, err := NewService(context.Background())
+	if err != nil {
+		t.Fatalf("failed to create service: %v", err)
+	}
+
+	policy := NewStatusPolicy()
+	policy.MaxErrorBody = 8
+
+	// The status codes to retry are set by the status policy.
+	retry := &RetryPolicy{MaxAttempts: 2, MinBackoff: time.Millisecond, MaxBackoff: time.Millisecond}
+
+	writer := &mockListWriter{}
+
+	var reqs []*Request
+
+	for _, path := range []string{"/created", "/empty", "/missing", "/flaky", "/gone"} {
+		req, err := http.NewRequestWithContext(context.Background(), http.MethodGet, server.URL+path, nil)
+		if err != nil {
+			t.Fatalf("failed to create request: %v", err)
+		}
+
+		var opts []RequestOption
+		if path == "/missing" {
+			opts = append(opts, WithStatusPolicy(&StatusPolicy{
+				Success: []int{http.StatusOK},
+				Skip:    []int{http.StatusNotFound},
+			}))
+		}
+
+		reqs = append(reqs, NewHTTPRequest(req, append(opts, WithWriters(writer))...))
+	}
+
+	report, err := svc.HTTP.Client(server.Client()).StatusPolicy(policy).RetryPolicy(retry).
+		ContinueOnError(true).Requests(reqs...).StoreWithReport(context.Background())
+
+	var statusErr *StatusError
+	if !errors.As(err, &statusErr) || !errors.Is(err, ErrBadResponse) {
+		t.Fatalf("expected a status error, got %v", err)
+	}
+
+	if statusErr.StatusCode != http.StatusGone || statusErr.Header.Get("X-Request-Id") != "abc" {
+		t.Fatalf("status, header = %d, %v", statusErr.StatusCode, statusErr.Header)
+	}
+
+	if string(statusErr.Body) != `{"error"` || !statusErr.Truncated {
+		t.Fatalf("body, truncated = %q, %v", statusErr.Body, statusErr.Truncated)
+	}
+
+	if failed := report.Failed(); len(failed) != 1 || !strings.HasSuffix(failed[0].Request.URL.Path, "/gone") {
+		t.Fatalf("expected only /gone to fail, got %d failed", len(failed))
+	}
+
+	records := 0
+	for _, req := range report.Requests {
+		records += req.Records
+	}
+
+	if records != 3 || writer.count != 2 {
+		t.Fatalf("records, writes = %d, %d, want 3, 2", records, writer.count)
+	}
+}
@@ -0,0 +1,162 @@
+// Copyright 2023 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+
+package gidari
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+
+	structpb "google.golang.org/protobuf/types/known/structpb"
+)
+
+// ErrInvalidRecord is wrapped by the errors returned when a record can not be
+// converted into a Go value or fails validation.
+var ErrInvalidRecord = fmt.Errorf("invalid record")
+
+// RecordError is the error for a single record that can not be converted into
+// a Go value or that fails validation.
+type RecordError struct {
+	// Index is the index of the record in the list.
+	Index int
+
+	// Value is the record that could not be converted.
+	Value *structpb.Value
+
+	// Err is the conversion or validation error.
+	Err error
+}
+
+func (err *RecordError) Error() string {
+	return fmt.Sprintf("%v: record %d: %v", ErrInvalidRecord, err.Index, err.Err)
+}
+
+// Is will report whether the target is ErrInvalidRecord.
+func (err *RecordError) Is(target error) bool {
+	return target == ErrInvalidRecord //nolint:errorlint,goerr113
+}
+
+// Unwrap will return the conversion or validation error.
+func (err *RecordError) Unwrap() error {
+	return err.Err
+}
+
+// Validator is implemented by the types of a TypedWriter that validate
+// themselves after they are converted.
+type Validator interface {
+	Validate() error
+}
+
+// TypedWriter is a ListWriter that converts each record into a value of type T
+// before writing the values, so that writers can work with domain types rather
+// than structpb values. Records are converted using the "encoding/json"
+// package, i.e. according to the json tags of T. If T or *T implements
+// Validator, then each value is validated after it is converted.
+type TypedWriter[T any] struct {
+	write func(ctx context.Context, records []T) error
+
+	// invalid handles the records that can not be converted. If it is nil,
+	// the write fails on the first invalid record.
+	invalid func(ctx context.Context, err *RecordError) error
+
+	strict bool
+}
+
+// TypedWriterOption is a function for configuring a TypedWriter.
+type TypedWriterOption[T any] func(*TypedWriter[T])
+
+// WithInvalidRecordHandler will call the handler for each record that can not
+// be converted or fails validation. If the handler returns nil, then the record
+// is skipped. Otherwise, the write fails with the handler's error. By default,
+// the write fails with the *RecordError of the first invalid record.
+func WithInvalidRecordHandler[T any](handler func(ctx context.Context, err *RecordError) error) TypedWriterOption[T] {
+	return func(writer *TypedWriter[T]) {
+		writer.invalid = handler
+	}
+}
+
+// WithStrictFields will treat records with fields that are not in T as
+// invalid.
+func WithStrictFields[T any]() TypedWriterOption[T] {
+	return func(writer *TypedWriter[T]) {
+		writer.strict = true
+	}
+}
+
+// NewTypedWriter will create a TypedWriter that passes the converted records to
+// the write function.
+func NewTypedWriter[T any](write func(ctx context.Context, records []T) error,
+	opts ...TypedWriterOption[T],
+) *TypedWriter[T] {
+	writer := &TypedWriter[T]{write: write}
+	for _, opt := range opts {
+		opt(writer)
+	}
+
+	return writer
+}
+
+// convert will convert the value into T and validate it.
+func (writer *TypedWriter[T]) convert(val *structpb.Value) (T, error) {
+	var record T
+
+	data, err := val.MarshalJSON()
+	if err != nil {
+		return record, fmt.Errorf("failed to marshal value: %w", err)
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	if writer.strict {
+		dec.DisallowUnknownFields()
+	}
+
+	if err := dec.Decode(&record); err != nil {
+		return record, fmt.Errorf("failed to unmarshal value: %w", err)
+	}
+
+	validator, ok := any(record).(Validator)
+	if !ok {
+		validator, ok = any(&record).(Validator)
+	}
+
+	if ok {
+		if err := validator.Validate(); err != nil {
+			return record, fmt.Errorf("failed validation: %w", err)
+		}
+	}
+
+	return record, nil
+}
+
+// Write will convert the records in the list and pass them to the write
+// function.
+func (writer *TypedWriter[T]) Write(ctx context.Context, list *structpb.ListValue) error {
+	records := make([]T, 0, len(list.GetValues()))
+
+	for idx, val := range list.GetValues() {
+		record, err := writer.convert(val)
+		if err == nil {
+			records = append(records, record)
+
+			continue
+		}
+
+		recordErr := &RecordError{Index: idx, Value: val, Err: err}
+		if writer.invalid == nil {
+			return recordErr
+		}
+
+		if err := writer.invalid(ctx, recordErr); err != nil {
+			return err
+		}
+	}
+
+	return writer.write(ctx, records)
+}
@@ -0,0 +1,169 @@
+// Copyright 2023 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+
+package gidari
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	structpb "google.golang.org/protobuf/types/known/structpb"
+)
+
+type testTypedRecord struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+var errMissingName = fmt.Errorf("missing name")
+
+type testValidatedRecord struct {
+	testTypedRecord
+}
+
+func (rec *testValidatedRecord) Validate() error {
+	if rec.Name == "" {
+		return errMissingName
+	}
+
+	return nil
+}
+
+func TestTypedWriter(t *testing.T) {
+	t.Parallel()
+
+	errHandler := fmt.Errorf("handler error")
+
+	for _, tcase := range []struct {
+		name    string
+		data    string
+		write   func(data string) ([]int, error)
+		want    []int
+		index   int
+		wantErr error
+	}{
+		{
+			name: "records",
+			data: `[{"id":1,"name":"a"},{"id":2,"name":"b","extra":true}]`,
+			write: func(data string) ([]int, error) {
+				return writeTyped[testTypedRecord](data)
+			},
+			want: []int{1, 2},
+		},
+		{
+			name: "conversion error",
+			data: `[{"id":1},{"id":"two"}]`,
+			write: func(data string) ([]int, error) {
+				return writeTyped[testTypedRecord](data)
+			},
+			index:   1,
+			wantErr: ErrInvalidRecord,
+		},
+		{
+			name: "strict fields",
+			data: `[{"id":1,"name":"a","extra":true}]`,
+			write: func(data string) ([]int, error) {
+				return writeTyped(data, WithStrictFields[testTypedRecord]())
+			},
+			wantErr: ErrInvalidRecord,
+		},
+		{
+			name: "validation error",
+			data: `[{"id":1,"name":"a"},{"id":2}]`,
+			write: func(data string) ([]int, error) {
+				return writeTyped[testValidatedRecord](data)
+			},
+			index:   1,
+			wantErr: errMissingName,
+		},
+		{
+			name: "skip invalid records",
+			data: `[{"id":1,"name":"a"},{"id":2},{"id":3,"name":"c"}]`,
+			write: func(data string) ([]int, error) {
+				return writeTyped(data, WithInvalidRecordHandler[testValidatedRecord](
+					func(_ context.Context, err *RecordError) error {
+						if err.Index != 1 || !errors.Is(err, errMissingName) {
+							return fmt.Errorf("unexpected record error: %w", err)
+						}
+
+						return nil
+					}))
+			},
+			want: []int{1, 3},
+		},
+		{
+			name: "handler error",
+			data: `[{"id":1}]`,
+			write: func(data string) ([]int, error) {
+				return writeTyped(data, WithInvalidRecordHandler[testValidatedRecord](
+					func(context.Context, *RecordError) error {
+						return errHandler
+					}))
+			},
+			wantErr: errHandler,
+		},
+	} {
+		tcase := tcase
+
+		t.Run(tcase.name, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := tcase.write(tcase.data)
+			if !errors.Is(err, tcase.wantErr) {
+				t.Fatalf("expected error %v, got %v", tcase.wantErr, err)
+			}
+
+			var recordErr *RecordError
+			if errors.As(err, &recordErr) && recordErr.Index != tcase.index {
+				t.Fatalf("record error index = %d, want %d", recordErr.Index, tcase.index)
+			}
+
+			if tcase.wantErr != nil {
+				return
+			}
+
+			if fmt.Sprint(got) != fmt.Sprint(tcase.want) {
+				t.Fatalf("written records = %v, want %v", got, tcase.want)
+			}
+		})
+	}
+}
+
+// writeTyped will write the JSON array with a TypedWriter, returning the IDs of
+// the written records.
+func writeTyped[T interface {
+	testTypedRecord | testValidatedRecord
+}](data string, opts ...TypedWriterOption[T],
+) ([]int, error) {
+	list := &structpb.ListValue{}
+	if err := decodeFuncJSON(strings.NewReader(data))(list); err != nil {
+		return nil, err
+	}
+
+	var ids []int
+
+	writer := NewTypedWriter(func(_ context.Context, records []T) error {
+		for _, record := range records {
+			switch record := any(record).(type) {
+			case testTypedRecord:
+				ids = append(ids, record.ID)
+			case testValidatedRecord:
+				ids = append(ids, record.ID)
+			}
+		}
+
+		return nil
+	}, opts...)
+
+	err := writer.Write(context.Background(), list)
+
+	return ids, err
+}
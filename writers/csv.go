@@ -0,0 +1,213 @@
+// Copyright 2023 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+
+package writers
+
+import (
+	"bufio"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+
+	structpb "google.golang.org/protobuf/types/known/structpb"
+)
+
+// ErrUnsupportedRecord is returned when a record can not be written as a CSV
+// row, i.e. when it is not an object.
+var ErrUnsupportedRecord = fmt.Errorf("unsupported record")
+
+// countingWriter counts the bytes written to the writer.
+type countingWriter struct {
+	w io.Writer
+	n int
+}
+
+func (cw *countingWriter) Write(b []byte) (int, error) {
+	n, err := cw.w.Write(b)
+	cw.n += n
+
+	return n, err //nolint:wrapcheck
+}
+
+// csvEncoder writes the rows to a temporary file, since the header is the union
+// of the fields of all records in the file and is only known once the file is
+// finished. Columns are added in the order that they are first seen, so the
+// rows that were written before a column was added are padded when they are
+// copied to the file.
+type csvEncoder struct {
+	w io.Writer
+
+	columns []string
+	index   map[string]int
+
+	rows    *os.File
+	rowsBuf *bufio.Writer
+	counter *countingWriter
+	csv     *csv.Writer
+}
+
+func newCSVEncoder(w io.Writer, path string) (encoder, error) {
+	rows, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.rows")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temporary file: %w", err)
+	}
+
+	enc := &csvEncoder{
+		w:       w,
+		index:   make(map[string]int),
+		rows:    rows,
+		rowsBuf: bufio.NewWriter(rows),
+	}
+
+	enc.counter = &countingWriter{w: enc.rowsBuf}
+	enc.csv = csv.NewWriter(enc.counter)
+
+	return enc, nil
+}
+
+// formatCell will format the value as a CSV field. Objects and lists are
+// formatted as JSON.
+func formatCell(val *structpb.Value) (string, error) {
+	switch kind := val.GetKind().(type) {
+	case *structpb.Value_StringValue:
+		return kind.StringValue, nil
+	case *structpb.Value_NumberValue:
+		return strconv.FormatFloat(kind.NumberValue, 'f', -1, 64), nil
+	case *structpb.Value_BoolValue:
+		return strconv.FormatBool(kind.BoolValue), nil
+	case *structpb.Value_NullValue, nil:
+		return "", nil
+	default:
+		data, err := marshalValue(val)
+
+		return string(data), err
+	}
+}
+
+func (enc *csvEncoder) write(val *structpb.Value) (int, error) {
+	record := val.GetStructValue()
+	if record == nil {
+		return 0, fmt.Errorf("%w: csv records must be objects", ErrUnsupportedRecord)
+	}
+
+	// Add the new columns in a stable order.
+	keys := make([]string, 0, len(record.GetFields()))
+	for key := range record.GetFields() {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		if _, ok := enc.index[key]; !ok {
+			enc.index[key] = len(enc.columns)
+			enc.columns = append(enc.columns, key)
+		}
+	}
+
+	row := make([]string, len(enc.columns))
+
+	for key, field := range record.GetFields() {
+		cell, err := formatCell(field)
+		if err != nil {
+			return 0, err
+		}
+
+		row[enc.index[key]] = cell
+	}
+
+	before := enc.counter.n
+
+	if err := enc.csv.Write(row); err != nil {
+		return 0, fmt.Errorf("failed to write row: %w", err)
+	}
+
+	enc.csv.Flush()
+
+	return enc.counter.n - before, nil
+}
+
+// copyRows will write the header and the padded rows to the file.
+func (enc *csvEncoder) copyRows() error {
+	enc.csv.Flush()
+
+	if err := enc.csv.Error(); err != nil {
+		return fmt.Errorf("failed to write rows: %w", err)
+	}
+
+	if err := enc.rowsBuf.Flush(); err != nil {
+		return fmt.Errorf("failed to write rows: %w", err)
+	}
+
+	if _, err := enc.rows.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("failed to read rows: %w", err)
+	}
+
+	reader := csv.NewReader(bufio.NewReader(enc.rows))
+	reader.FieldsPerRecord = -1
+
+	writer := csv.NewWriter(enc.w)
+	if err := writer.Write(enc.columns); err != nil {
+		return fmt.Errorf("failed to write header: %w", err)
+	}
+
+	for {
+		row, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+
+		if err != nil {
+			return fmt.Errorf("failed to read rows: %w", err)
+		}
+
+		for len(row) < len(enc.columns) {
+			row = append(row, "")
+		}
+
+		if err := writer.Write(row); err != nil {
+			return fmt.Errorf("failed to write row: %w", err)
+		}
+	}
+
+	writer.Flush()
+
+	if err := writer.Error(); err != nil {
+		return fmt.Errorf("failed to write rows: %w", err)
+	}
+
+	return nil
+}
+
+func (enc *csvEncoder) close() error {
+	err := enc.copyRows()
+
+	if closeErr := enc.rows.Close(); closeErr != nil && err == nil {
+		err = fmt.Errorf("failed to close rows: %w", closeErr)
+	}
+
+	if removeErr := os.Remove(enc.rows.Name()); removeErr != nil && err == nil {
+		err = fmt.Errorf("failed to remove rows: %w", removeErr)
+	}
+
+	return err
+}
+
+// NewCSVWriter will create a FileWriter that writes the records as CSV rows.
+// The header of each file is the union of the fields of the records in the
+// file, in the order that they are first seen. Objects and lists are written as
+// JSON, and null or missing fields as empty fields. See "FileWriter" for the
+// path template.
+func NewCSVWriter(template string, opts ...Option) (*FileWriter, error) {
+	return newFileWriter(template, newCSVEncoder, opts...)
+}
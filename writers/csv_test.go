@@ -0,0 +1,66 @@
+// Copyright 2023 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+
+package writers
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCSVWriter(t *testing.T) {
+	t.Parallel()
+
+	got := writeFile(t, NewCSVWriter,
+		`[{"b":1,"a":"x,y"},{"a":"z","c":true}]`,
+		`[{"d":{"e":[1,2]},"b":null}]`)
+
+	want := "a,b,c,d\n" +
+		"\"x,y\",1,,\n" +
+		"z,,true,\n" +
+		",,,\"{\"\"e\"\":[1,2]}\"\n"
+
+	if got != want {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+}
+
+func TestCSVWriterUnsupportedRecord(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+
+	writer, err := NewCSVWriter(filepath.Join(dir, "out.csv"))
+	if err != nil {
+		t.Fatalf("failed to create writer: %v", err)
+	}
+
+	err = writer.Write(context.Background(), newList(t, `[1]`))
+	if !errors.Is(err, ErrUnsupportedRecord) {
+		t.Fatalf("expected error %v, got %v", ErrUnsupportedRecord, err)
+	}
+
+	if err := writer.Close(); err != nil {
+		t.Fatalf("failed to close: %v", err)
+	}
+
+	// The temporary files must be removed.
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("failed to read directory: %v", err)
+	}
+
+	for _, entry := range entries {
+		if entry.Name() != "out.csv" {
+			t.Fatalf("unexpected file %q", entry.Name())
+		}
+	}
+}
@@ -0,0 +1,74 @@
+// Copyright 2023 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+
+package writers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	structpb "google.golang.org/protobuf/types/known/structpb"
+)
+
+const jsonIndent = "  "
+
+type jsonEncoder struct {
+	w       io.Writer
+	records int
+}
+
+func (enc *jsonEncoder) write(val *structpb.Value) (int, error) {
+	data, err := marshalValue(val)
+	if err != nil {
+		return 0, err
+	}
+
+	buf := &bytes.Buffer{}
+
+	if enc.records == 0 {
+		buf.WriteString("[\n" + jsonIndent)
+	} else {
+		buf.WriteString(",\n" + jsonIndent)
+	}
+
+	if err := json.Indent(buf, data, jsonIndent, jsonIndent); err != nil {
+		return 0, fmt.Errorf("failed to indent record: %w", err)
+	}
+
+	n, err := enc.w.Write(buf.Bytes())
+	if err != nil {
+		return n, fmt.Errorf("failed to write record: %w", err)
+	}
+
+	enc.records++
+
+	return n, nil
+}
+
+func (enc *jsonEncoder) close() error {
+	end := "\n]\n"
+	if enc.records == 0 {
+		end = "[]\n"
+	}
+
+	if _, err := io.WriteString(enc.w, end); err != nil {
+		return fmt.Errorf("failed to write end of array: %w", err)
+	}
+
+	return nil
+}
+
+// NewJSONWriter will create a FileWriter that writes the records as an indented
+// JSON array. See "FileWriter" for the path template.
+func NewJSONWriter(template string, opts ...Option) (*FileWriter, error) {
+	return newFileWriter(template, func(w io.Writer, _ string) (encoder, error) {
+		return &jsonEncoder{w: w}, nil
+	}, opts...)
+}
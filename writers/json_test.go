@@ -0,0 +1,22 @@
+// Copyright 2023 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+
+package writers
+
+import "testing"
+
+func TestJSONWriter(t *testing.T) {
+	t.Parallel()
+
+	got := writeFile(t, NewJSONWriter, `[{"a":{"b":[1]}}]`, `[2]`)
+
+	want := "[\n  {\n    \"a\": {\n      \"b\": [\n        1\n      ]\n    }\n  },\n  2\n]\n"
+	if got != want {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,58 @@
+// Copyright 2023 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+
+package writers
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	structpb "google.golang.org/protobuf/types/known/structpb"
+)
+
+// marshalValue will encode the value as JSON. Unlike "protojson", the output
+// is stable, with the fields of objects sorted by key.
+func marshalValue(val *structpb.Value) ([]byte, error) {
+	data, err := json.Marshal(val.AsInterface())
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal record: %w", err)
+	}
+
+	return data, nil
+}
+
+type ndjsonEncoder struct {
+	w io.Writer
+}
+
+func (enc *ndjsonEncoder) write(val *structpb.Value) (int, error) {
+	data, err := marshalValue(val)
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := enc.w.Write(append(data, '\n'))
+	if err != nil {
+		return n, fmt.Errorf("failed to write record: %w", err)
+	}
+
+	return n, nil
+}
+
+func (enc *ndjsonEncoder) close() error {
+	return nil
+}
+
+// NewNDJSONWriter will create a FileWriter that writes each record as a line of
+// JSON. See "FileWriter" for the path template.
+func NewNDJSONWriter(template string, opts ...Option) (*FileWriter, error) {
+	return newFileWriter(template, func(w io.Writer, _ string) (encoder, error) {
+		return &ndjsonEncoder{w: w}, nil
+	}, opts...)
+}
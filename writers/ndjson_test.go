@@ -0,0 +1,57 @@
+// Copyright 2023 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+
+package writers
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeFile will write the lists with a writer for the "out" file in a
+// temporary directory, returning the contents of the file.
+func writeFile(t *testing.T, newWriter func(string, ...Option) (*FileWriter, error), lists ...string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "out")
+
+	writer, err := newWriter(path)
+	if err != nil {
+		t.Fatalf("failed to create writer: %v", err)
+	}
+
+	for _, list := range lists {
+		if err := writer.Write(context.Background(), newList(t, list)); err != nil {
+			t.Fatalf("failed to write: %v", err)
+		}
+	}
+
+	if err := writer.Close(); err != nil {
+		t.Fatalf("failed to close: %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read file: %v", err)
+	}
+
+	return string(data)
+}
+
+func TestNDJSONWriter(t *testing.T) {
+	t.Parallel()
+
+	got := writeFile(t, NewNDJSONWriter, `[{"b":1,"a":"x"},[1,2]]`, `["y",null]`)
+
+	want := "{\"a\":\"x\",\"b\":1}\n[1,2]\n\"y\"\nnull\n"
+	if got != want {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,22 @@
+module github.com/alpstable/gidari/writers/postgres
+
+go 1.19
+
+replace github.com/alpstable/gidari => ../../
+
+require (
+	github.com/alpstable/gidari v0.0.0-00010101000000-000000000000
+	github.com/jackc/pgx/v5 v5.4.3
+	google.golang.org/protobuf v1.30.0
+)
+
+require (
+	github.com/andybalholm/brotli v1.0.5 // indirect
+	github.com/jackc/pgpassfile v1.0.0 // indirect
+	github.com/jackc/pgservicefile v0.0.0-20221227161230-091c0ba34f0a // indirect
+	github.com/klauspost/compress v1.16.7 // indirect
+	golang.org/x/crypto v0.9.0 // indirect
+	golang.org/x/net v0.10.0 // indirect
+	golang.org/x/text v0.9.0 // indirect
+	golang.org/x/time v0.3.0 // indirect
+)
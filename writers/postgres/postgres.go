@@ -0,0 +1,531 @@
+// Copyright 2023 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+
+// Package postgres contains a list writer that bulk-loads the data stored by a
+// gidari service into a PostgreSQL table using the COPY protocol of the
+// "github.com/jackc/pgx/v5" package. Records are either mapped to the columns
+// of the table by field name or written whole to a single JSONB column, and
+// can be upserted on a conflict key.
+package postgres
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	structpb "google.golang.org/protobuf/types/known/structpb"
+)
+
+var (
+	// ErrUnsupportedRecord is returned when a record is not an object.
+	ErrUnsupportedRecord = fmt.Errorf("unsupported record")
+
+	// ErrMissingConflictKey is returned when a record does not have one of
+	// the fields of the conflict key, or the field is null.
+	ErrMissingConflictKey = fmt.Errorf("missing conflict key")
+
+	// ErrTableNotFound is returned when the table does not exist, or does
+	// not have the columns that the writer is configured with.
+	ErrTableNotFound = fmt.Errorf("table not found")
+
+	// ErrInvalidValue is returned when a field can not be converted into
+	// the type of its column.
+	ErrInvalidValue = fmt.Errorf("invalid value")
+)
+
+// Conn is a connection to the database, e.g. a *pgx.Conn or a *pgxpool.Pool.
+type Conn interface {
+	Begin(ctx context.Context) (pgx.Tx, error)
+}
+
+// column is a column of the table.
+type column struct {
+	name string
+
+	// udt is the name of the column's type, e.g. "int8" or "jsonb".
+	udt string
+}
+
+// ListWriter is a gidari.ListWriter that writes the records to a PostgreSQL
+// table. The table must exist. Each list is written in a single transaction
+// with the COPY protocol.
+//
+// By default, each field of a record is written to the column of the same
+// name, and fields without a column are ignored. Only the columns of the fields
+// of each record are copied, so the other columns take their default values,
+// or keep their values when the record is upserted. Use "WithJSONBColumn" to
+// write the records whole instead.
+type ListWriter struct {
+	conn  Conn
+	table pgx.Identifier
+
+	jsonColumn  string
+	conflictKey []string
+
+	mu sync.Mutex
+
+	// columns are the columns of the table, nil until they are loaded.
+	columns []column
+}
+
+// Option is a function for configuring a ListWriter.
+type Option func(*ListWriter)
+
+// WithJSONBColumn will write each record whole to the column, which should be
+// of type "jsonb" or "json". The fields of the conflict key, if any, are also
+// written to the columns of the same name.
+func WithJSONBColumn(name string) Option {
+	return func(w *ListWriter) {
+		w.jsonColumn = name
+	}
+}
+
+// WithConflictKey will upsert the records on the columns, which must have a
+// unique index or constraint. The records are copied into a temporary table
+// and then inserted with "ON CONFLICT (key) DO UPDATE", replacing the other
+// copied columns of the existing rows. If a list has multiple records with the
+// same key, then the last one is written.
+func WithConflictKey(columns ...string) Option {
+	return func(w *ListWriter) {
+		w.conflictKey = columns
+	}
+}
+
+// NewListWriter will create a ListWriter for the table, which may be qualified
+// by its schema, e.g. "public.characters". The connection is not closed by the
+// writer.
+//
+//	pool, err := pgxpool.New(ctx, "postgres://localhost:5432/gidari")
+//	if err != nil {
+//		return err
+//	}
+//
+//	writer := postgres.NewListWriter(pool, "characters", postgres.WithConflictKey("url"))
+func NewListWriter(conn Conn, table string, opts ...Option) *ListWriter {
+	writer := &ListWriter{conn: conn, table: pgx.Identifier(strings.Split(table, "."))}
+	for _, opt := range opts {
+		opt(writer)
+	}
+
+	return writer
+}
+
+// loadColumns will load the columns of the table.
+func (w *ListWriter) loadColumns(ctx context.Context, tx pgx.Tx) error {
+	schema, name := "", w.table[len(w.table)-1]
+	if len(w.table) > 1 {
+		schema = w.table[len(w.table)-2]
+	}
+
+	const query = `SELECT column_name, udt_name FROM information_schema.columns
+		WHERE table_schema = COALESCE(NULLIF($1, ''), current_schema()) AND table_name = $2
+		ORDER BY ordinal_position`
+
+	rows, err := tx.Query(ctx, query, schema, name)
+	if err != nil {
+		return fmt.Errorf("failed to query columns: %w", err)
+	}
+
+	defer rows.Close()
+
+	var columns []column
+
+	for rows.Next() {
+		var col column
+		if err := rows.Scan(&col.name, &col.udt); err != nil {
+			return fmt.Errorf("failed to scan column: %w", err)
+		}
+
+		columns = append(columns, col)
+	}
+
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to query columns: %w", err)
+	}
+
+	if len(columns) == 0 {
+		return fmt.Errorf("%w: %s", ErrTableNotFound, w.table.Sanitize())
+	}
+
+	required := append([]string{}, w.conflictKey...)
+	if w.jsonColumn != "" {
+		required = append(required, w.jsonColumn)
+	}
+
+	for _, name := range required {
+		if findColumn(columns, name) == nil {
+			return fmt.Errorf("%w: %s has no column %q", ErrTableNotFound, w.table.Sanitize(), name)
+		}
+	}
+
+	w.columns = columns
+
+	return nil
+}
+
+// findColumn will return the column with the name, or nil if there is none.
+func findColumn(columns []column, name string) *column {
+	for idx := range columns {
+		if columns[idx].name == name {
+			return &columns[idx]
+		}
+	}
+
+	return nil
+}
+
+// parseTime will parse the string as an RFC 3339 timestamp or a date.
+func parseTime(str string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339Nano, str); err == nil {
+		return t, nil
+	}
+
+	t, err := time.Parse("2006-01-02", str)
+	if err != nil {
+		return t, fmt.Errorf("%w: %q is not a timestamp", ErrInvalidValue, str)
+	}
+
+	return t, nil
+}
+
+// isNull will report whether the value is null or unset.
+func isNull(val *structpb.Value) bool {
+	_, ok := val.GetKind().(*structpb.Value_NullValue)
+
+	return ok || val.GetKind() == nil
+}
+
+// columnValue will convert the value into a value that can be copied into the
+// column.
+func columnValue(col *column, val *structpb.Value) (any, error) {
+	if isNull(val) {
+		return nil, nil
+	}
+
+	switch col.udt {
+	case "json", "jsonb":
+		return val.AsInterface(), nil
+	case "int2", "int4", "int8":
+		switch kind := val.GetKind().(type) {
+		case *structpb.Value_NumberValue:
+			if kind.NumberValue != math.Trunc(kind.NumberValue) {
+				return nil, fmt.Errorf("%w: %v is not an integer", ErrInvalidValue, kind.NumberValue)
+			}
+
+			return int64(kind.NumberValue), nil
+		case *structpb.Value_StringValue:
+			num, err := strconv.ParseInt(kind.StringValue, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("%w: %q is not an integer", ErrInvalidValue, kind.StringValue)
+			}
+
+			return num, nil
+		}
+	case "float4", "float8", "numeric":
+		switch kind := val.GetKind().(type) {
+		case *structpb.Value_NumberValue:
+			return kind.NumberValue, nil
+		case *structpb.Value_StringValue:
+			num, err := strconv.ParseFloat(kind.StringValue, 64)
+			if err != nil {
+				return nil, fmt.Errorf("%w: %q is not a number", ErrInvalidValue, kind.StringValue)
+			}
+
+			return num, nil
+		}
+	case "timestamp", "timestamptz", "date":
+		if str, ok := val.GetKind().(*structpb.Value_StringValue); ok {
+			return parseTime(str.StringValue)
+		}
+	case "text", "varchar", "bpchar", "name", "citext":
+		if str, ok := val.GetKind().(*structpb.Value_StringValue); ok {
+			return str.StringValue, nil
+		}
+
+		// Other values are written as JSON text.
+		data, err := json.Marshal(val.AsInterface())
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidValue, err)
+		}
+
+		return string(data), nil
+	}
+
+	return val.AsInterface(), nil
+}
+
+// copyGroup is a group of rows that are copied with the same columns.
+type copyGroup struct {
+	names []string
+	rows  [][]any
+}
+
+// recordColumns will return the columns of the table to copy for the record,
+// in table order.
+func (w *ListWriter) recordColumns(record *structpb.Struct) []*column {
+	var columns []*column
+
+	for idx := range w.columns {
+		col := &w.columns[idx]
+
+		if w.jsonColumn != "" {
+			if col.name == w.jsonColumn || w.isKey(col.name) {
+				columns = append(columns, col)
+			}
+
+			continue
+		}
+
+		if _, ok := record.GetFields()[col.name]; ok {
+			columns = append(columns, col)
+		}
+	}
+
+	return columns
+}
+
+// groups will convert the records into the rows to copy. The rows are grouped
+// by the columns of the fields of their records, so that the columns of the
+// fields that a record does not have are not copied for it.
+func (w *ListWriter) groups(list *structpb.ListValue) ([]*copyGroup, error) {
+	var (
+		records []*structpb.Struct
+		indices []int
+	)
+
+	// keys is the index in records for each conflict key.
+	keys := make(map[string]int)
+
+	for idx, val := range list.GetValues() {
+		record := val.GetStructValue()
+		if record == nil {
+			return nil, fmt.Errorf("%w: record %d is not an object", ErrUnsupportedRecord, idx)
+		}
+
+		// A null key never conflicts, so the record would be inserted
+		// again on every write instead of upserted.
+		for _, key := range w.conflictKey {
+			if val, ok := record.GetFields()[key]; !ok || isNull(val) {
+				return nil, fmt.Errorf("%w: record %d has no %q field", ErrMissingConflictKey, idx, key)
+			}
+		}
+
+		if len(w.conflictKey) > 0 {
+			key := w.conflictKeyOf(record)
+			if recordIdx, ok := keys[key]; ok {
+				records[recordIdx], indices[recordIdx] = record, idx
+
+				continue
+			}
+
+			keys[key] = len(records)
+		}
+
+		records = append(records, record)
+		indices = append(indices, idx)
+	}
+
+	var groups []*copyGroup
+
+	byNames := make(map[string]*copyGroup)
+
+	for recordIdx, record := range records {
+		columns := w.recordColumns(record)
+
+		// A record without any fields of the table is not copied.
+		if len(columns) == 0 {
+			continue
+		}
+
+		row := make([]any, len(columns))
+		names := make([]string, len(columns))
+
+		for colIdx, col := range columns {
+			names[colIdx] = col.name
+
+			val := record.GetFields()[col.name]
+			if col.name == w.jsonColumn {
+				val = structpb.NewStructValue(record)
+			}
+
+			if val == nil {
+				continue
+			}
+
+			var err error
+			if row[colIdx], err = columnValue(col, val); err != nil {
+				return nil, fmt.Errorf("record %d: column %q: %w", indices[recordIdx], col.name, err)
+			}
+		}
+
+		key := strings.Join(names, "\x00")
+
+		group, ok := byNames[key]
+		if !ok {
+			group = &copyGroup{names: names}
+			byNames[key] = group
+			groups = append(groups, group)
+		}
+
+		group.rows = append(group.rows, row)
+	}
+
+	return groups, nil
+}
+
+// isKey will report whether the column is part of the conflict key.
+func (w *ListWriter) isKey(name string) bool {
+	for _, key := range w.conflictKey {
+		if key == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// conflictKeyOf will return a string that identifies the conflict key of the
+// record.
+func (w *ListWriter) conflictKeyOf(record *structpb.Struct) string {
+	values := make([]any, len(w.conflictKey))
+	for idx, key := range w.conflictKey {
+		values[idx] = record.GetFields()[key].AsInterface()
+	}
+
+	data, _ := json.Marshal(values)
+
+	return string(data)
+}
+
+// upsertQuery will return the query that inserts the rows of the temporary
+// table into the table.
+func (w *ListWriter) upsertQuery(tmp pgx.Identifier, names []string) string {
+	columns := make([]string, len(names))
+	updates := make([]string, 0, len(names))
+
+	for idx, name := range names {
+		ident := pgx.Identifier{name}.Sanitize()
+		columns[idx] = ident
+
+		if !w.isKey(name) {
+			updates = append(updates, fmt.Sprintf("%s = EXCLUDED.%s", ident, ident))
+		}
+	}
+
+	keys := make([]string, len(w.conflictKey))
+	for idx, name := range w.conflictKey {
+		keys[idx] = pgx.Identifier{name}.Sanitize()
+	}
+
+	query := fmt.Sprintf("INSERT INTO %s (%s) SELECT %s FROM %s ON CONFLICT (%s)",
+		w.table.Sanitize(), strings.Join(columns, ", "), strings.Join(columns, ", "),
+		tmp.Sanitize(), strings.Join(keys, ", "))
+
+	if len(updates) == 0 {
+		return query + " DO NOTHING"
+	}
+
+	return query + " DO UPDATE SET " + strings.Join(updates, ", ")
+}
+
+// write will copy the records of the list in the transaction.
+func (w *ListWriter) write(ctx context.Context, tx pgx.Tx, list *structpb.ListValue) error {
+	if w.columns == nil {
+		if err := w.loadColumns(ctx, tx); err != nil {
+			return err
+		}
+	}
+
+	groups, err := w.groups(list)
+	if err != nil {
+		return err
+	}
+
+	for _, group := range groups {
+		if len(w.conflictKey) == 0 {
+			if _, err := tx.CopyFrom(ctx, w.table, group.names, pgx.CopyFromRows(group.rows)); err != nil {
+				return fmt.Errorf("failed to copy records: %w", err)
+			}
+
+			continue
+		}
+
+		if err := w.upsert(ctx, tx, group); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// upsert will copy the rows of the group into a temporary table and then
+// insert them into the table on the conflict key.
+func (w *ListWriter) upsert(ctx context.Context, tx pgx.Tx, group *copyGroup) error {
+	tmp := pgx.Identifier{"gidari_copy_" + w.table[len(w.table)-1]}
+
+	// The temporary table only has the copied columns, without constraints
+	// or defaults, so that identity and serial columns that are not copied
+	// are neither required nor take values from the table's sequences.
+	columns := make([]string, len(group.names))
+	for idx, name := range group.names {
+		columns[idx] = pgx.Identifier{name}.Sanitize()
+	}
+
+	create := fmt.Sprintf("CREATE TEMPORARY TABLE %s ON COMMIT DROP AS SELECT %s FROM %s WITH NO DATA",
+		tmp.Sanitize(), strings.Join(columns, ", "), w.table.Sanitize())
+	if _, err := tx.Exec(ctx, create); err != nil {
+		return fmt.Errorf("failed to create temporary table: %w", err)
+	}
+
+	if _, err := tx.CopyFrom(ctx, tmp, group.names, pgx.CopyFromRows(group.rows)); err != nil {
+		return fmt.Errorf("failed to copy records: %w", err)
+	}
+
+	if _, err := tx.Exec(ctx, w.upsertQuery(tmp, group.names)); err != nil {
+		return fmt.Errorf("failed to upsert records: %w", err)
+	}
+
+	// Drop the temporary table so that the next group can create it with
+	// its own columns.
+	if _, err := tx.Exec(ctx, "DROP TABLE "+tmp.Sanitize()); err != nil {
+		return fmt.Errorf("failed to drop temporary table: %w", err)
+	}
+
+	return nil
+}
+
+// Write will write the records in the list to the table in a single
+// transaction.
+func (w *ListWriter) Write(ctx context.Context, list *structpb.ListValue) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	tx, err := w.conn.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+
+	// Rollback is a no-op once the transaction is committed.
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	if err := w.write(ctx, tx, list); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
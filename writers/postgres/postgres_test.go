@@ -0,0 +1,416 @@
+// Copyright 2023 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/alpstable/gidari"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	structpb "google.golang.org/protobuf/types/known/structpb"
+)
+
+var _ gidari.ListWriter = (*ListWriter)(nil)
+
+type mockCopy struct {
+	table   pgx.Identifier
+	columns []string
+	rows    [][]any
+}
+
+// mockTx records the statements of a transaction. The methods that are not
+// used by the writer are not implemented.
+type mockTx struct {
+	pgx.Tx
+
+	columns   [][2]string
+	execs     []string
+	copies    []mockCopy
+	committed bool
+}
+
+func (tx *mockTx) Query(context.Context, string, ...any) (pgx.Rows, error) {
+	return &mockRows{columns: tx.columns, idx: -1}, nil
+}
+
+func (tx *mockTx) Exec(_ context.Context, sql string, _ ...any) (pgconn.CommandTag, error) {
+	tx.execs = append(tx.execs, sql)
+
+	return pgconn.CommandTag{}, nil
+}
+
+func (tx *mockTx) CopyFrom(_ context.Context, table pgx.Identifier, columns []string,
+	src pgx.CopyFromSource,
+) (int64, error) {
+	cpy := mockCopy{table: table, columns: columns}
+
+	for src.Next() {
+		row, err := src.Values()
+		if err != nil {
+			return 0, err
+		}
+
+		cpy.rows = append(cpy.rows, row)
+	}
+
+	tx.copies = append(tx.copies, cpy)
+
+	return int64(len(cpy.rows)), nil
+}
+
+func (tx *mockTx) Commit(context.Context) error {
+	tx.committed = true
+
+	return nil
+}
+
+func (tx *mockTx) Rollback(context.Context) error {
+	return nil
+}
+
+type mockRows struct {
+	pgx.Rows
+
+	columns [][2]string
+	idx     int
+}
+
+func (rows *mockRows) Next() bool {
+	rows.idx++
+
+	return rows.idx < len(rows.columns)
+}
+
+func (rows *mockRows) Scan(dest ...any) error {
+	*dest[0].(*string) = rows.columns[rows.idx][0]
+	*dest[1].(*string) = rows.columns[rows.idx][1]
+
+	return nil
+}
+
+func (rows *mockRows) Err() error { return nil }
+func (rows *mockRows) Close()     {}
+
+type mockConn struct {
+	columns [][2]string
+	txs     []*mockTx
+}
+
+func (conn *mockConn) Begin(context.Context) (pgx.Tx, error) {
+	tx := &mockTx{columns: conn.columns}
+	conn.txs = append(conn.txs, tx)
+
+	return tx, nil
+}
+
+// newList will decode the JSON array into a list.
+func newList(t *testing.T, data string) *structpb.ListValue {
+	t.Helper()
+
+	list := &structpb.ListValue{}
+	if err := list.UnmarshalJSON([]byte(data)); err != nil {
+		t.Fatalf("failed to decode list: %v", err)
+	}
+
+	return list
+}
+
+var itemColumns = [][2]string{
+	{"id", "int8"},
+	{"name", "text"},
+	{"tags", "jsonb"},
+	{"created", "timestamptz"},
+	{"updated", "timestamptz"},
+}
+
+func TestListWriter(t *testing.T) {
+	t.Parallel()
+
+	created := time.Date(2023, 1, 31, 9, 0, 0, 0, time.UTC)
+
+	for _, tcase := range []struct {
+		name   string
+		opts   []Option
+		list   string
+		execs  []string
+		copies []mockCopy
+		err    error
+	}{
+		{
+			name: "columns",
+			list: `[{"id":1,"name":"a","tags":["x"],"extra":true},{"id":"2","name":3,"created":"2023-01-31T09:00:00Z"}]`,
+			copies: []mockCopy{
+				{
+					table:   pgx.Identifier{"items"},
+					columns: []string{"id", "name", "tags"},
+					rows:    [][]any{{int64(1), "a", []any{"x"}}},
+				},
+				{
+					table:   pgx.Identifier{"items"},
+					columns: []string{"id", "name", "created"},
+					rows:    [][]any{{int64(2), "3", created}},
+				},
+			},
+		},
+		{
+			name: "upsert",
+			opts: []Option{WithConflictKey("id")},
+			list: `[{"id":1,"name":"a"},{"id":2,"name":"b"},{"id":1,"name":"c"}]`,
+			execs: []string{
+				`CREATE TEMPORARY TABLE "gidari_copy_items" ON COMMIT DROP AS SELECT "id", "name" FROM "items" ` +
+					`WITH NO DATA`,
+				`INSERT INTO "items" ("id", "name") SELECT "id", "name" FROM "gidari_copy_items" ` +
+					`ON CONFLICT ("id") DO UPDATE SET "name" = EXCLUDED."name"`,
+				`DROP TABLE "gidari_copy_items"`,
+			},
+			copies: []mockCopy{{
+				table:   pgx.Identifier{"gidari_copy_items"},
+				columns: []string{"id", "name"},
+				rows:    [][]any{{int64(1), "c"}, {int64(2), "b"}},
+			}},
+		},
+		{
+			name: "upsert mixed fields",
+			opts: []Option{WithConflictKey("id")},
+			list: `[{"id":1,"name":"a"},{"id":2},{"id":3,"name":null},{"id":2,"tags":[]}]`,
+			execs: []string{
+				`CREATE TEMPORARY TABLE "gidari_copy_items" ON COMMIT DROP AS SELECT "id", "name" FROM "items" ` +
+					`WITH NO DATA`,
+				`INSERT INTO "items" ("id", "name") SELECT "id", "name" FROM "gidari_copy_items" ` +
+					`ON CONFLICT ("id") DO UPDATE SET "name" = EXCLUDED."name"`,
+				`DROP TABLE "gidari_copy_items"`,
+				`CREATE TEMPORARY TABLE "gidari_copy_items" ON COMMIT DROP AS SELECT "id", "tags" FROM "items" ` +
+					`WITH NO DATA`,
+				`INSERT INTO "items" ("id", "tags") SELECT "id", "tags" FROM "gidari_copy_items" ` +
+					`ON CONFLICT ("id") DO UPDATE SET "tags" = EXCLUDED."tags"`,
+				`DROP TABLE "gidari_copy_items"`,
+			},
+			copies: []mockCopy{
+				{
+					table:   pgx.Identifier{"gidari_copy_items"},
+					columns: []string{"id", "name"},
+					rows:    [][]any{{int64(1), "a"}, {int64(3), nil}},
+				},
+				{
+					table:   pgx.Identifier{"gidari_copy_items"},
+					columns: []string{"id", "tags"},
+					rows:    [][]any{{int64(2), []any{}}},
+				},
+			},
+		},
+		{
+			name: "jsonb column",
+			opts: []Option{WithJSONBColumn("tags"), WithConflictKey("id")},
+			list: `[{"id":1,"x":{"y":2}}]`,
+			execs: []string{
+				`CREATE TEMPORARY TABLE "gidari_copy_items" ON COMMIT DROP AS SELECT "id", "tags" FROM "items" ` +
+					`WITH NO DATA`,
+				`INSERT INTO "items" ("id", "tags") SELECT "id", "tags" FROM "gidari_copy_items" ` +
+					`ON CONFLICT ("id") DO UPDATE SET "tags" = EXCLUDED."tags"`,
+				`DROP TABLE "gidari_copy_items"`,
+			},
+			copies: []mockCopy{{
+				table:   pgx.Identifier{"gidari_copy_items"},
+				columns: []string{"id", "tags"},
+				rows:    [][]any{{int64(1), map[string]any{"id": float64(1), "x": map[string]any{"y": float64(2)}}}},
+			}},
+		},
+		{
+			name: "missing conflict key",
+			opts: []Option{WithConflictKey("id")},
+			list: `[{"id":1},{"name":"a"}]`,
+			err:  ErrMissingConflictKey,
+		},
+		{
+			name: "null conflict key",
+			opts: []Option{WithConflictKey("id")},
+			list: `[{"id":null,"name":"a"}]`,
+			err:  ErrMissingConflictKey,
+		},
+		{
+			name: "unknown conflict key column",
+			opts: []Option{WithConflictKey("url")},
+			list: `[{"url":"a"}]`,
+			err:  ErrTableNotFound,
+		},
+		{
+			name: "invalid value",
+			list: `[{"id":1.5}]`,
+			err:  ErrInvalidValue,
+		},
+		{
+			name: "unsupported record",
+			list: `[1]`,
+			err:  ErrUnsupportedRecord,
+		},
+	} {
+		tcase := tcase
+
+		t.Run(tcase.name, func(t *testing.T) {
+			t.Parallel()
+
+			conn := &mockConn{columns: itemColumns}
+
+			err := NewListWriter(conn, "items", tcase.opts...).Write(context.Background(), newList(t, tcase.list))
+			if !errors.Is(err, tcase.err) {
+				t.Fatalf("expected error %v, got %v", tcase.err, err)
+			}
+
+			tx := conn.txs[0]
+			if tx.committed != (tcase.err == nil) {
+				t.Fatalf("committed = %v, want %v", tx.committed, tcase.err == nil)
+			}
+
+			if tcase.err != nil {
+				return
+			}
+
+			if fmt.Sprintf("%q", tx.execs) != fmt.Sprintf("%q", tcase.execs) {
+				t.Fatalf("execs = %q, want %q", tx.execs, tcase.execs)
+			}
+
+			if fmt.Sprintf("%#v", tx.copies) != fmt.Sprintf("%#v", tcase.copies) {
+				t.Fatalf("copies = %#v, want %#v", tx.copies, tcase.copies)
+			}
+		})
+	}
+}
+
+func TestListWriterTableNotFound(t *testing.T) {
+	t.Parallel()
+
+	err := NewListWriter(&mockConn{}, "public.items").Write(context.Background(), newList(t, `[{"id":1}]`))
+	if !errors.Is(err, ErrTableNotFound) {
+		t.Fatalf("expected error %v, got %v", ErrTableNotFound, err)
+	}
+}
+
+// TestListWriterPostgres runs against the database of the GIDARI_POSTGRES_URL
+// environment variable, e.g. "postgres://postgres@localhost:5432/postgres".
+func TestListWriterPostgres(t *testing.T) {
+	t.Parallel()
+
+	url := os.Getenv("GIDARI_POSTGRES_URL")
+	if url == "" {
+		t.Skip("GIDARI_POSTGRES_URL is not set")
+	}
+
+	ctx := context.Background()
+
+	conn, err := pgx.Connect(ctx, url)
+	if err != nil {
+		t.Fatalf("failed to connect: %v", err)
+	}
+
+	defer conn.Close(ctx)
+
+	// The second response of each case is upserted on the rows of the
+	// first, so each case has 2 rows and the name of row "a" is "/second".
+	// The cases share the connection, which must not be used concurrently,
+	// so they do not run in parallel.
+	for _, tcase := range []struct {
+		name  string
+		table string
+	}{
+		{
+			name: "natural key",
+			table: `CREATE TABLE gidari_characters (url text PRIMARY KEY, name text, born int8,
+				data jsonb, stored timestamptz DEFAULT now())`,
+		},
+		{
+			name: "identity key",
+			table: `CREATE TABLE gidari_characters (id int8 GENERATED ALWAYS AS IDENTITY PRIMARY KEY,
+				url text NOT NULL UNIQUE, name text, born int8, data jsonb, stored timestamptz DEFAULT now())`,
+		},
+		{
+			name: "serial key",
+			table: `CREATE TABLE gidari_characters (id bigserial PRIMARY KEY, url text NOT NULL UNIQUE,
+				name text, born int8, data jsonb, stored timestamptz DEFAULT now())`,
+		},
+	} {
+		for _, query := range []string{`DROP TABLE IF EXISTS gidari_characters`, tcase.table} {
+			if _, err := conn.Exec(ctx, query); err != nil {
+				t.Fatalf("%s: failed to create table: %v", tcase.name, err)
+			}
+		}
+
+		storeCharacters(t, conn)
+
+		var count int
+
+		var name string
+
+		err = conn.QueryRow(ctx, `SELECT count(*), max(name) FILTER (WHERE url = 'a')
+			FROM gidari_characters WHERE stored IS NOT NULL`).Scan(&count, &name)
+		if err != nil {
+			t.Fatalf("%s: failed to query: %v", tcase.name, err)
+		}
+
+		if count != 2 || name != "/second" {
+			t.Fatalf("%s: count, name = %d, %q, want 2, %q", tcase.name, count, name, "/second")
+		}
+	}
+
+	// The table of the last case has a serial key. The staged rows do not
+	// take values from its sequence, so the ids of the 2 rows are 1 and 2.
+	var maxID int64
+	if err := conn.QueryRow(ctx, `SELECT max(id) FROM gidari_characters`).Scan(&maxID); err != nil {
+		t.Fatalf("failed to query: %v", err)
+	}
+
+	if maxID != 2 {
+		t.Fatalf("max id = %d, want 2", maxID)
+	}
+}
+
+// storeCharacters will store 2 responses of characters in the
+// "gidari_characters" table, upserting on the "url" column.
+func storeCharacters(t *testing.T, conn *pgx.Conn) {
+	t.Helper()
+
+	ctx := context.Background()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `[{"url":"a","name":%q,"born":283,"data":{"x":1}},{"url":"b","name":"y"}]`, r.URL.Path)
+	}))
+	defer server.Close()
+
+	svc, err := gidari.NewService(ctx)
+	if err != nil {
+		t.Fatalf("failed to create service: %v", err)
+	}
+
+	// A pgx.Conn must not be used concurrently, so the requests share a
+	// writer, which writes one list at a time.
+	writer := NewListWriter(conn, "gidari_characters", WithConflictKey("url"))
+
+	var reqs []*gidari.Request
+
+	for _, path := range []string{"/first", "/second"} {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, server.URL+path, nil)
+		if err != nil {
+			t.Fatalf("failed to create request: %v", err)
+		}
+
+		reqs = append(reqs, gidari.NewHTTPRequest(req, gidari.WithWriters(writer)))
+	}
+
+	if err := svc.HTTP.Client(server.Client()).MaxInFlight(1).Requests(reqs...).Store(ctx); err != nil {
+		t.Fatalf("failed to store: %v", err)
+	}
+}
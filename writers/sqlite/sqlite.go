@@ -0,0 +1,425 @@
+// Copyright 2023 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+
+// Package sqlite contains a list writer that writes the data stored by a gidari
+// service to a SQLite table. The table and its columns are created from the
+// fields of the records as they are written. Importing the package registers
+// the "sqlite" driver of the "modernc.org/sqlite" package, which does not
+// require cgo.
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+
+	structpb "google.golang.org/protobuf/types/known/structpb"
+
+	// Register the "sqlite" driver.
+	_ "modernc.org/sqlite"
+)
+
+// DriverName is the name of the registered SQLite driver, for use with
+// "sql.Open".
+const DriverName = "sqlite"
+
+var (
+	// ErrUnsupportedRecord is returned when a record is not an object, or
+	// when it has fields whose names only differ in case.
+	ErrUnsupportedRecord = fmt.Errorf("unsupported record")
+
+	// ErrMissingPrimaryKey is returned when a record does not have the
+	// primary key field, or the field is null.
+	ErrMissingPrimaryKey = fmt.Errorf("missing primary key")
+)
+
+// Column types for the kinds of values. Numbers use the NUMERIC affinity, so
+// that integers are stored as integers, and objects and lists are stored as
+// JSON text that can be queried with the SQLite JSON functions.
+const (
+	numericType = "NUMERIC"
+	textType    = "TEXT"
+	booleanType = "BOOLEAN"
+	jsonType    = "JSON"
+)
+
+// ListWriter is a gidari.ListWriter that writes the records to a SQLite table.
+// Each field of a record is written to the column of the same name. Since
+// SQLite column names are case-insensitive, fields whose names only differ in
+// case, e.g. "id" and "ID", are written to the same column, and a record must
+// not have both. The table is created when the first record is written, and
+// columns are added for the fields that are not yet in the table. Each list is
+// written in a single transaction, so either all or none of its records are
+// written.
+type ListWriter struct {
+	db         *sql.DB
+	table      string
+	primaryKey string
+
+	mu sync.Mutex
+
+	// columns are the columns of the table by their folded names, see
+	// "foldName", nil until they are loaded.
+	columns map[string]bool
+}
+
+// Option is a function for configuring a ListWriter.
+type Option func(*ListWriter)
+
+// WithPrimaryKey will upsert the records on the field, i.e. a record replaces
+// the fields of the row with the same value for the field. A unique index is
+// created on the column, and records without the field are rejected.
+func WithPrimaryKey(field string) Option {
+	return func(w *ListWriter) {
+		w.primaryKey = field
+	}
+}
+
+// NewListWriter will create a ListWriter for the table. The database is not
+// closed by the writer.
+//
+//	db, err := sql.Open(sqlite.DriverName, "data.db")
+//	if err != nil {
+//		return err
+//	}
+//
+//	writer := sqlite.NewListWriter(db, "characters", sqlite.WithPrimaryKey("url"))
+func NewListWriter(db *sql.DB, table string, opts ...Option) *ListWriter {
+	writer := &ListWriter{db: db, table: table}
+	for _, opt := range opts {
+		opt(writer)
+	}
+
+	return writer
+}
+
+// foldName will return the name of the column in lower case. SQLite only folds
+// the case of ASCII letters when comparing column names.
+func foldName(name string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= 'A' && r <= 'Z' {
+			return r + ('a' - 'A')
+		}
+
+		return r
+	}, name)
+}
+
+// quote will quote the SQL identifier.
+func quote(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+// isNull will report whether the value is null or unset.
+func isNull(val *structpb.Value) bool {
+	_, ok := val.GetKind().(*structpb.Value_NullValue)
+
+	return ok || val.GetKind() == nil
+}
+
+// columnType will return the column type for the kind of the value.
+func columnType(val *structpb.Value) string {
+	switch val.GetKind().(type) {
+	case *structpb.Value_NumberValue:
+		return numericType
+	case *structpb.Value_StringValue:
+		return textType
+	case *structpb.Value_BoolValue:
+		return booleanType
+	case *structpb.Value_StructValue, *structpb.Value_ListValue:
+		return jsonType
+	default:
+		// Columns that are only null so far have no type, i.e. the
+		// BLOB affinity, which stores values as they are.
+		return ""
+	}
+}
+
+// columnValue will convert the value into the value to store in its column.
+func columnValue(val *structpb.Value) (any, error) {
+	switch kind := val.GetKind().(type) {
+	case *structpb.Value_NumberValue:
+		num := kind.NumberValue
+		if num == math.Trunc(num) && math.Abs(num) < 1<<53 {
+			return int64(num), nil
+		}
+
+		return num, nil
+	case *structpb.Value_StringValue:
+		return kind.StringValue, nil
+	case *structpb.Value_BoolValue:
+		return kind.BoolValue, nil
+	case *structpb.Value_StructValue, *structpb.Value_ListValue:
+		data, err := json.Marshal(val.AsInterface())
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal value: %w", err)
+		}
+
+		return string(data), nil
+	default:
+		return nil, nil
+	}
+}
+
+// loadColumns will load the columns of the table, if it exists.
+func (w *ListWriter) loadColumns(ctx context.Context, tx *sql.Tx) error {
+	rows, err := tx.QueryContext(ctx, "SELECT name FROM pragma_table_info(?)", w.table)
+	if err != nil {
+		return fmt.Errorf("failed to query columns: %w", err)
+	}
+
+	defer rows.Close()
+
+	columns := make(map[string]bool)
+
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return fmt.Errorf("failed to scan column: %w", err)
+		}
+
+		columns[foldName(name)] = true
+	}
+
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to query columns: %w", err)
+	}
+
+	w.columns = columns
+
+	// The table may have been created without the index.
+	if w.primaryKey != "" && columns[foldName(w.primaryKey)] {
+		return w.createIndex(ctx, tx)
+	}
+
+	return nil
+}
+
+// createIndex will create the unique index on the primary key column, which is
+// required to upsert the records.
+func (w *ListWriter) createIndex(ctx context.Context, tx *sql.Tx) error {
+	index := quote(w.table + "_" + w.primaryKey + "_key")
+
+	query := fmt.Sprintf("CREATE UNIQUE INDEX IF NOT EXISTS %s ON %s (%s)",
+		index, quote(w.table), quote(w.primaryKey))
+	if _, err := tx.ExecContext(ctx, query); err != nil {
+		return fmt.Errorf("failed to create primary key index: %w", err)
+	}
+
+	return nil
+}
+
+// addColumns will create the table or add the columns for the fields that are
+// not yet in the table. The added columns are returned so that they can be
+// forgotten if the transaction is rolled back.
+func (w *ListWriter) addColumns(ctx context.Context, tx *sql.Tx, record *structpb.Struct) ([]string, error) {
+	var added []string
+
+	for _, name := range sortedKeys(record) {
+		if w.columns[foldName(name)] {
+			continue
+		}
+
+		definition := strings.TrimSpace(quote(name) + " " + columnType(record.GetFields()[name]))
+
+		query := fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s", quote(w.table), definition)
+		if len(w.columns) == 0 && len(added) == 0 {
+			query = fmt.Sprintf("CREATE TABLE %s (%s)", quote(w.table), definition)
+		}
+
+		if _, err := tx.ExecContext(ctx, query); err != nil {
+			return added, fmt.Errorf("failed to add column %q: %w", name, err)
+		}
+
+		w.columns[foldName(name)] = true
+		added = append(added, foldName(name))
+
+		if foldName(name) == foldName(w.primaryKey) {
+			if err := w.createIndex(ctx, tx); err != nil {
+				return added, err
+			}
+		}
+	}
+
+	return added, nil
+}
+
+// foldFields will return the fields of the record by their folded names, see
+// "foldName". Fields whose names only differ in case are rejected, since they
+// would be written to the same column.
+func foldFields(idx int, record *structpb.Struct) (map[string]*structpb.Value, error) {
+	folded := make(map[string]*structpb.Value, len(record.GetFields()))
+	names := make(map[string]string, len(record.GetFields()))
+
+	for _, name := range sortedKeys(record) {
+		key := foldName(name)
+		if other, ok := names[key]; ok {
+			return nil, fmt.Errorf("%w: record %d has fields %q and %q that only differ in case",
+				ErrUnsupportedRecord, idx, other, name)
+		}
+
+		folded[key] = record.GetFields()[name]
+		names[key] = name
+	}
+
+	return folded, nil
+}
+
+// sortedKeys will return the field names of the record in a stable order.
+func sortedKeys(record *structpb.Struct) []string {
+	keys := make([]string, 0, len(record.GetFields()))
+	for key := range record.GetFields() {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	return keys
+}
+
+// insertQuery will return the query that inserts or upserts a record with the
+// fields.
+func (w *ListWriter) insertQuery(keys []string) string {
+	columns := make([]string, len(keys))
+	params := make([]string, len(keys))
+	updates := make([]string, 0, len(keys))
+
+	for idx, key := range keys {
+		columns[idx] = quote(key)
+		params[idx] = "?"
+
+		if foldName(key) != foldName(w.primaryKey) {
+			updates = append(updates, fmt.Sprintf("%s = excluded.%s", quote(key), quote(key)))
+		}
+	}
+
+	query := fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)",
+		quote(w.table), strings.Join(columns, ", "), strings.Join(params, ", "))
+
+	if w.primaryKey == "" {
+		return query
+	}
+
+	if len(updates) == 0 {
+		return query + fmt.Sprintf(" ON CONFLICT (%s) DO NOTHING", quote(w.primaryKey))
+	}
+
+	return query + fmt.Sprintf(" ON CONFLICT (%s) DO UPDATE SET %s",
+		quote(w.primaryKey), strings.Join(updates, ", "))
+}
+
+// write will write the records of the list in the transaction.
+func (w *ListWriter) write(ctx context.Context, tx *sql.Tx, list *structpb.ListValue) ([]string, error) {
+	if w.columns == nil {
+		if err := w.loadColumns(ctx, tx); err != nil {
+			return nil, err
+		}
+	}
+
+	var added []string
+
+	// Prepared statements are cached by the fields of the records.
+	stmts := make(map[string]*sql.Stmt)
+
+	defer func() {
+		for _, stmt := range stmts {
+			stmt.Close()
+		}
+	}()
+
+	for idx, val := range list.GetValues() {
+		record := val.GetStructValue()
+		if record == nil {
+			return added, fmt.Errorf("%w: record %d is not an object", ErrUnsupportedRecord, idx)
+		}
+
+		folded, err := foldFields(idx, record)
+		if err != nil {
+			return added, err
+		}
+
+		// The unique index allows any number of null keys, so a record
+		// with a null key would be inserted again instead of upserted.
+		if key, ok := folded[foldName(w.primaryKey)]; w.primaryKey != "" && (!ok || isNull(key)) {
+			return added, fmt.Errorf("%w: record %d has no %q field", ErrMissingPrimaryKey, idx, w.primaryKey)
+		}
+
+		if len(record.GetFields()) == 0 {
+			continue
+		}
+
+		newColumns, err := w.addColumns(ctx, tx, record)
+		added = append(added, newColumns...)
+
+		if err != nil {
+			return added, err
+		}
+
+		keys := sortedKeys(record)
+
+		args := make([]any, len(keys))
+		for idx, key := range keys {
+			if args[idx], err = columnValue(record.GetFields()[key]); err != nil {
+				return added, err
+			}
+		}
+
+		stmtKey := strings.Join(keys, "\x00")
+
+		stmt, ok := stmts[stmtKey]
+		if !ok {
+			if stmt, err = tx.PrepareContext(ctx, w.insertQuery(keys)); err != nil {
+				return added, fmt.Errorf("failed to prepare insert: %w", err)
+			}
+
+			stmts[stmtKey] = stmt
+		}
+
+		if _, err := stmt.ExecContext(ctx, args...); err != nil {
+			return added, fmt.Errorf("failed to insert record %d: %w", idx, err)
+		}
+	}
+
+	return added, nil
+}
+
+// Write will write the records in the list to the table in a single
+// transaction.
+func (w *ListWriter) Write(ctx context.Context, list *structpb.ListValue) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	tx, err := w.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+
+	added, err := w.write(ctx, tx, list)
+	if err == nil {
+		if err = tx.Commit(); err != nil {
+			err = fmt.Errorf("failed to commit transaction: %w", err)
+		}
+	} else {
+		_ = tx.Rollback()
+	}
+
+	if err != nil {
+		// The schema changes of a failed transaction are rolled back
+		// as well.
+		for _, name := range added {
+			delete(w.columns, name)
+		}
+	}
+
+	return err
+}
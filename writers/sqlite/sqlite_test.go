@@ -0,0 +1,251 @@
+// Copyright 2023 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/alpstable/gidari"
+	structpb "google.golang.org/protobuf/types/known/structpb"
+)
+
+// openDB will open a database in a temporary directory.
+func openDB(t *testing.T) *sql.DB {
+	t.Helper()
+
+	db, err := sql.Open(DriverName, filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+
+	t.Cleanup(func() { db.Close() })
+
+	return db
+}
+
+// newList will decode the JSON array into a list.
+func newList(t *testing.T, data string) *structpb.ListValue {
+	t.Helper()
+
+	list := &structpb.ListValue{}
+	if err := list.UnmarshalJSON([]byte(data)); err != nil {
+		t.Fatalf("failed to decode list: %v", err)
+	}
+
+	return list
+}
+
+// queryRows will return the rows of the query, formatted as strings.
+func queryRows(t *testing.T, db *sql.DB, query string) []string {
+	t.Helper()
+
+	rows, err := db.Query(query)
+	if err != nil {
+		t.Fatalf("failed to query: %v", err)
+	}
+
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		t.Fatalf("failed to get columns: %v", err)
+	}
+
+	var got []string
+
+	for rows.Next() {
+		vals := make([]any, len(columns))
+		ptrs := make([]any, len(columns))
+
+		for idx := range vals {
+			ptrs[idx] = &vals[idx]
+		}
+
+		if err := rows.Scan(ptrs...); err != nil {
+			t.Fatalf("failed to scan: %v", err)
+		}
+
+		fields := make([]string, len(vals))
+		for idx, val := range vals {
+			fields[idx] = fmt.Sprint(val)
+		}
+
+		got = append(got, strings.Join(fields, "|"))
+	}
+
+	if err := rows.Err(); err != nil {
+		t.Fatalf("failed to query: %v", err)
+	}
+
+	return got
+}
+
+func TestListWriter(t *testing.T) {
+	t.Parallel()
+
+	db := openDB(t)
+	writer := NewListWriter(db, "items")
+
+	for _, list := range []string{
+		`[{"id":1,"name":"a"},{"id":2.5,"name":"b","tags":["x"]}]`,
+		`[{"id":3,"meta":{"ok":true},"name":null}]`,
+	} {
+		if err := writer.Write(context.Background(), newList(t, list)); err != nil {
+			t.Fatalf("failed to write: %v", err)
+		}
+	}
+
+	got := queryRows(t, db, `SELECT id, name, tags, meta, typeof(id) FROM items ORDER BY id`)
+	want := []string{
+		"1|a|<nil>|<nil>|integer",
+		`2.5|b|["x"]|<nil>|real`,
+		`3|<nil>|<nil>|{"ok":true}|integer`,
+	}
+
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Fatalf("rows = %v, want %v", got, want)
+	}
+
+	// A new writer must use the existing columns.
+	writer = NewListWriter(db, "items")
+	if err := writer.Write(context.Background(), newList(t, `[{"id":4,"extra":"e"}]`)); err != nil {
+		t.Fatalf("failed to write: %v", err)
+	}
+
+	if got := queryRows(t, db, `SELECT count(*), count(extra) FROM items`); got[0] != "4|1" {
+		t.Fatalf("count = %v, want 4|1", got)
+	}
+}
+
+func TestListWriterUpsert(t *testing.T) {
+	t.Parallel()
+
+	db := openDB(t)
+	writer := NewListWriter(db, "items", WithPrimaryKey("id"))
+
+	for _, list := range []string{
+		`[{"id":1,"name":"a","size":1},{"id":2,"name":"b"}]`,
+		`[{"id":1,"name":"c"},{"id":3}]`,
+	} {
+		if err := writer.Write(context.Background(), newList(t, list)); err != nil {
+			t.Fatalf("failed to write: %v", err)
+		}
+	}
+
+	got := queryRows(t, db, `SELECT id, name, size FROM items ORDER BY id`)
+	want := []string{"1|c|1", "2|b|<nil>", "3|<nil>|<nil>"}
+
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Fatalf("rows = %v, want %v", got, want)
+	}
+
+	for _, list := range []string{`[{"name":"d"}]`, `[{"id":null,"name":"d"}]`} {
+		err := writer.Write(context.Background(), newList(t, list))
+		if !errors.Is(err, ErrMissingPrimaryKey) {
+			t.Fatalf("%s: expected error %v, got %v", list, ErrMissingPrimaryKey, err)
+		}
+	}
+}
+
+func TestListWriterRollback(t *testing.T) {
+	t.Parallel()
+
+	db := openDB(t)
+	writer := NewListWriter(db, "items")
+
+	err := writer.Write(context.Background(), newList(t, `[{"id":1,"new":true},2]`))
+	if !errors.Is(err, ErrUnsupportedRecord) {
+		t.Fatalf("expected error %v, got %v", ErrUnsupportedRecord, err)
+	}
+
+	// The table created by the failed transaction must be created again.
+	if err := writer.Write(context.Background(), newList(t, `[{"id":1}]`)); err != nil {
+		t.Fatalf("failed to write: %v", err)
+	}
+
+	if got := queryRows(t, db, `SELECT name FROM pragma_table_info('items')`); fmt.Sprint(got) != "[id]" {
+		t.Fatalf("columns = %v, want [id]", got)
+	}
+}
+
+func TestListWriterCase(t *testing.T) {
+	t.Parallel()
+
+	db := openDB(t)
+	writer := NewListWriter(db, "items", WithPrimaryKey("id"))
+
+	// Fields that only differ in case are written to the same column.
+	for _, list := range []string{
+		`[{"id":1,"name":"a"},{"ID":2,"Name":"b"}]`,
+		`[{"Id":1,"NAME":"c"}]`,
+	} {
+		if err := writer.Write(context.Background(), newList(t, list)); err != nil {
+			t.Fatalf("failed to write: %v", err)
+		}
+	}
+
+	got := queryRows(t, db, `SELECT id, name FROM items ORDER BY id`)
+	want := []string{"1|c", "2|b"}
+
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Fatalf("rows = %v, want %v", got, want)
+	}
+
+	err := writer.Write(context.Background(), newList(t, `[{"id":3,"name":"d","NAME":"e"}]`))
+	if !errors.Is(err, ErrUnsupportedRecord) {
+		t.Fatalf("expected error %v, got %v", ErrUnsupportedRecord, err)
+	}
+}
+
+func TestListWriterStore(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `[{"url":"a","name":"x"},{"url":"b","name":"y"}]`)
+	}))
+	defer server.Close()
+
+	db := openDB(t)
+
+	svc, err := gidari.NewService(context.Background())
+	if err != nil {
+		t.Fatalf("failed to create service: %v", err)
+	}
+
+	var reqs []*gidari.Request
+
+	// Both responses are upserted on the same rows.
+	for i := 0; i < 2; i++ {
+		req, err := http.NewRequestWithContext(context.Background(), http.MethodGet, server.URL, nil)
+		if err != nil {
+			t.Fatalf("failed to create request: %v", err)
+		}
+
+		reqs = append(reqs, gidari.NewHTTPRequest(req,
+			gidari.WithWriters(NewListWriter(db, "characters", WithPrimaryKey("url")))))
+	}
+
+	if err := svc.HTTP.Client(server.Client()).Requests(reqs...).Store(context.Background()); err != nil {
+		t.Fatalf("failed to store: %v", err)
+	}
+
+	got := queryRows(t, db, `SELECT url, name FROM characters ORDER BY url`)
+	if fmt.Sprint(got) != "[a|x b|y]" {
+		t.Fatalf("rows = %v, want [a|x b|y]", got)
+	}
+}
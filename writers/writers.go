@@ -0,0 +1,482 @@
+// Copyright 2023 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+
+// Package writers contains list writers that write the data stored by a gidari
+// service to files, e.g. newline-delimited JSON, JSON arrays or CSV. The files
+// are partitioned by a path template, rotated by size or age, optionally
+// compressed with gzip, and written to a temporary file that is renamed into
+// place when the file is finished, so that readers never see partial files.
+package writers
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/alpstable/gidari"
+	structpb "google.golang.org/protobuf/types/known/structpb"
+)
+
+var (
+	// ErrInvalidTemplate is returned when a path template can not be used.
+	ErrInvalidTemplate = fmt.Errorf("invalid path template")
+
+	// ErrFileExists is returned when the file of a path template without
+	// the {n} placeholder already exists, e.g. from a previous run.
+	ErrFileExists = fmt.Errorf("file exists")
+)
+
+// unknownField is the value of a template field that is not known for the
+// data, e.g. the host of data read from a socket.
+const unknownField = "unknown"
+
+// placeholderRE matches the placeholders of a path template.
+var placeholderRE = regexp.MustCompile(`\{([a-z]+)\}`)
+
+// placeholders are the supported placeholders of a path template.
+var placeholders = map[string]bool{
+	"host":   true, // host of the HTTP request
+	"socket": true, // socket ID, see "gidari.WithSocketID"
+	"date":   true, // UTC date of the write, e.g. 2023-01-31
+	"hour":   true, // UTC hour of the write, e.g. 09
+	"n":      true, // zero-based part number of the file in its partition
+}
+
+// fields are the values of the placeholders that are not the part number.
+type fields struct {
+	host   string
+	socket string
+}
+
+// newFields will return the fields for data with the metadata.
+func newFields(meta *gidari.ListMeta) fields {
+	flds := fields{host: unknownField, socket: unknownField}
+	if meta == nil {
+		return flds
+	}
+
+	if meta.Request != nil && meta.Request.URL != nil && meta.Request.URL.Hostname() != "" {
+		flds.host = meta.Request.URL.Hostname()
+	}
+
+	if meta.SocketID != "" {
+		flds.socket = meta.SocketID
+	}
+
+	return flds
+}
+
+// render will render the template with the fields at the time. The part
+// number placeholder is left as is.
+func render(template string, flds fields, now time.Time) string {
+	now = now.UTC()
+
+	// Field values must not add directories to the path.
+	clean := strings.NewReplacer("/", "_", `\`, "_")
+
+	return placeholderRE.ReplaceAllStringFunc(template, func(placeholder string) string {
+		switch placeholder {
+		case "{host}":
+			return clean.Replace(flds.host)
+		case "{socket}":
+			return clean.Replace(flds.socket)
+		case "{date}":
+			return now.Format("2006-01-02")
+		case "{hour}":
+			return now.Format("15")
+		default:
+			return placeholder
+		}
+	})
+}
+
+// encoder encodes the records of a single file.
+type encoder interface {
+	// write will encode the record, returning the number of bytes
+	// written.
+	write(val *structpb.Value) (int, error)
+
+	// close will finish encoding the file.
+	close() error
+}
+
+// newEncoder will create an encoder that writes to w. The path is the path of
+// the temporary file, which can be used to create other temporary files.
+type newEncoder func(w io.Writer, path string) (encoder, error)
+
+// FileWriter is a gidari.ListWriter that writes the records to files. Use
+// "NewNDJSONWriter", "NewJSONWriter" or "NewCSVWriter" to create a FileWriter.
+//
+// The files are named by a path template, e.g. "{host}/{date}/part-{n}.ndjson",
+// with the placeholders:
+//
+//	{host}   the host of the HTTP request
+//	{socket} the socket ID, see "gidari.WithSocketID"
+//	{date}   the UTC date of the write, e.g. 2023-01-31
+//	{hour}   the UTC hour of the write, e.g. 09
+//	{n}      the zero-based part number of the file in its partition
+//
+// Data with different values for the placeholders other than {n} are written
+// to different files, i.e. partitions. A file is finished when it is rotated,
+// when the date or hour of its partition has passed, or when the writer is
+// closed. Part numbers that belong to existing files are skipped, so that
+// files are never overwritten if the template has a {n} placeholder. Without
+// it, writing to a partition whose file already exists, e.g. after the writer
+// is closed at the end of a previous "Store", fails with ErrFileExists.
+type FileWriter struct {
+	template   string
+	newEncoder newEncoder
+	maxBytes   int64
+	maxAge     time.Duration
+	gzip       bool
+	perm       os.FileMode
+	now        func() time.Time
+
+	mu    sync.Mutex
+	files map[string]*file
+	parts map[string]int
+}
+
+// Option is a function for configuring a FileWriter.
+type Option func(*FileWriter)
+
+// WithMaxBytes will rotate the files once at least n bytes are written to
+// them, measured before compression.
+func WithMaxBytes(n int64) Option {
+	return func(fw *FileWriter) {
+		fw.maxBytes = n
+	}
+}
+
+// WithMaxAge will rotate the files once they have been open for at least d.
+// Files are only rotated when they are written to.
+func WithMaxAge(d time.Duration) Option {
+	return func(fw *FileWriter) {
+		fw.maxAge = d
+	}
+}
+
+// WithGzip will compress the files with gzip, adding a ".gz" extension to the
+// file names if the template does not have one.
+func WithGzip() Option {
+	return func(fw *FileWriter) {
+		fw.gzip = true
+	}
+}
+
+// WithFileMode will set the permissions of the files. The default is 0644.
+func WithFileMode(perm os.FileMode) Option {
+	return func(fw *FileWriter) {
+		fw.perm = perm
+	}
+}
+
+// newFileWriter will create a FileWriter for the template, validating that
+// the template can be used with the options.
+func newFileWriter(template string, enc newEncoder, opts ...Option) (*FileWriter, error) {
+	const defaultPerm = 0o644
+
+	fw := &FileWriter{
+		template:   template,
+		newEncoder: enc,
+		perm:       defaultPerm,
+		now:        time.Now,
+		files:      make(map[string]*file),
+		parts:      make(map[string]int),
+	}
+
+	for _, opt := range opts {
+		opt(fw)
+	}
+
+	if template == "" {
+		return nil, fmt.Errorf("%w: empty template", ErrInvalidTemplate)
+	}
+
+	if fw.gzip && !strings.HasSuffix(fw.template, ".gz") {
+		fw.template += ".gz"
+	}
+
+	for _, match := range placeholderRE.FindAllStringSubmatch(fw.template, -1) {
+		if !placeholders[match[1]] {
+			return nil, fmt.Errorf("%w: unknown placeholder %q", ErrInvalidTemplate, match[0])
+		}
+	}
+
+	rotates := fw.maxBytes > 0 || fw.maxAge > 0
+	if rotates && !strings.Contains(fw.template, "{n}") {
+		return nil, fmt.Errorf("%w: rotation requires the {n} placeholder", ErrInvalidTemplate)
+	}
+
+	return fw, nil
+}
+
+// file is an open file of a partition.
+type file struct {
+	partition string
+	fields    fields
+	path      string
+	opened    time.Time
+	size      int64
+
+	tmp *os.File
+	buf *bufio.Writer
+	gz  *gzip.Writer
+	enc encoder
+}
+
+// open will create the temporary file for the next part of the partition.
+func (fw *FileWriter) open(partition string, flds fields, now time.Time) (*file, error) {
+	part := fw.parts[partition]
+
+	path := strings.ReplaceAll(partition, "{n}", strconv.Itoa(part))
+
+	// Skip the part numbers of existing files.
+	for strings.Contains(partition, "{n}") {
+		if _, err := os.Stat(path); os.IsNotExist(err) {
+			break
+		}
+
+		part++
+		path = strings.ReplaceAll(partition, "{n}", strconv.Itoa(part))
+	}
+
+	// The file of a partition without part numbers is not overwritten.
+	if !strings.Contains(partition, "{n}") {
+		if _, err := os.Stat(path); err == nil {
+			return nil, fmt.Errorf("%w: %s", ErrFileExists, path)
+		}
+	}
+
+	fw.parts[partition] = part + 1
+
+	const dirPerm = 0o755
+
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, dirPerm); err != nil {
+		return nil, fmt.Errorf("failed to create directory: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create file: %w", err)
+	}
+
+	// Temporary files are created readable only by the owner, so set the
+	// mode of the finished file.
+	if err := tmp.Chmod(fw.perm); err != nil {
+		_ = tmp.Close()
+		_ = os.Remove(tmp.Name())
+
+		return nil, fmt.Errorf("failed to set file mode: %w", err)
+	}
+
+	fil := &file{
+		partition: partition,
+		fields:    flds,
+		path:      path,
+		opened:    now,
+		tmp:       tmp,
+		buf:       bufio.NewWriter(tmp),
+	}
+
+	var out io.Writer = fil.buf
+	if fw.gzip {
+		fil.gz = gzip.NewWriter(fil.buf)
+		out = fil.gz
+	}
+
+	if fil.enc, err = fw.newEncoder(out, tmp.Name()); err != nil {
+		_ = tmp.Close()
+		_ = os.Remove(tmp.Name())
+
+		return nil, err
+	}
+
+	return fil, nil
+}
+
+// flush will write the buffered data of the file to the temporary file.
+func (fil *file) flush() error {
+	if fil.gz != nil {
+		if err := fil.gz.Flush(); err != nil {
+			return fmt.Errorf("failed to flush gzip writer: %w", err)
+		}
+	}
+
+	if err := fil.buf.Flush(); err != nil {
+		return fmt.Errorf("failed to flush file: %w", err)
+	}
+
+	return nil
+}
+
+// finish will finish writing the file and rename it into place. If the file
+// can not be finished, the temporary file is removed.
+func (fil *file) finish() error {
+	err := fil.enc.close()
+
+	if fil.gz != nil && err == nil {
+		if err = fil.gz.Close(); err != nil {
+			err = fmt.Errorf("failed to close gzip writer: %w", err)
+		}
+	}
+
+	if err == nil {
+		err = fil.flush()
+	}
+
+	if err == nil {
+		if err = fil.tmp.Sync(); err != nil {
+			err = fmt.Errorf("failed to sync file: %w", err)
+		}
+	}
+
+	if closeErr := fil.tmp.Close(); closeErr != nil && err == nil {
+		err = fmt.Errorf("failed to close file: %w", closeErr)
+	}
+
+	if err == nil {
+		if err = os.Rename(fil.tmp.Name(), fil.path); err != nil {
+			err = fmt.Errorf("failed to rename file: %w", err)
+		}
+	}
+
+	if err != nil {
+		_ = os.Remove(fil.tmp.Name())
+	}
+
+	return err
+}
+
+// full will report whether the file must be rotated before the next write.
+func (fw *FileWriter) full(fil *file, now time.Time) bool {
+	if fw.maxBytes > 0 && fil.size >= fw.maxBytes {
+		return true
+	}
+
+	return fw.maxAge > 0 && now.Sub(fil.opened) >= fw.maxAge
+}
+
+// finishStale will finish the files of the partitions that have passed, i.e.
+// whose date or hour is no longer current.
+func (fw *FileWriter) finishStale(now time.Time) error {
+	var firstErr error
+
+	for partition, fil := range fw.files {
+		if render(fw.template, fil.fields, now) == partition {
+			continue
+		}
+
+		delete(fw.files, partition)
+
+		if err := fil.finish(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	return firstErr
+}
+
+// Write will write the records in the list to the files of their partitions.
+func (fw *FileWriter) Write(ctx context.Context, list *structpb.ListValue) error {
+	return fw.WriteWithMeta(ctx, list, nil)
+}
+
+// WriteWithMeta will write the records in the list to the files of their
+// partitions, which are determined by the metadata.
+func (fw *FileWriter) WriteWithMeta(_ context.Context, list *structpb.ListValue, meta *gidari.ListMeta) error {
+	fw.mu.Lock()
+	defer fw.mu.Unlock()
+
+	now := fw.now()
+
+	if err := fw.finishStale(now); err != nil {
+		return err
+	}
+
+	flds := newFields(meta)
+	partition := render(fw.template, flds, now)
+
+	for _, val := range list.GetValues() {
+		fil := fw.files[partition]
+
+		if fil != nil && fw.full(fil, now) {
+			delete(fw.files, partition)
+
+			if err := fil.finish(); err != nil {
+				return err
+			}
+
+			fil = nil
+		}
+
+		if fil == nil {
+			var err error
+			if fil, err = fw.open(partition, flds, now); err != nil {
+				return err
+			}
+
+			fw.files[partition] = fil
+		}
+
+		n, err := fil.enc.write(val)
+		if err != nil {
+			return err
+		}
+
+		fil.size += int64(n)
+	}
+
+	return nil
+}
+
+// Flush will write the buffered data of the open files to their temporary
+// files. The files are not renamed into place until they are finished.
+func (fw *FileWriter) Flush() error {
+	fw.mu.Lock()
+	defer fw.mu.Unlock()
+
+	var firstErr error
+
+	for _, fil := range fw.files {
+		if err := fil.flush(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	return firstErr
+}
+
+// Close will finish the open files, renaming them into place. The writer can
+// still be written to after it is closed, creating new parts.
+func (fw *FileWriter) Close() error {
+	fw.mu.Lock()
+	defer fw.mu.Unlock()
+
+	var firstErr error
+
+	for partition, fil := range fw.files {
+		delete(fw.files, partition)
+
+		if err := fil.finish(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	return firstErr
+}
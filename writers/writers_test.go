@@ -0,0 +1,278 @@
+// Copyright 2023 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+
+package writers
+
+import (
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alpstable/gidari"
+	structpb "google.golang.org/protobuf/types/known/structpb"
+)
+
+// newList will decode the JSON array into a list.
+func newList(t *testing.T, data string) *structpb.ListValue {
+	t.Helper()
+
+	list := &structpb.ListValue{}
+	if err := list.UnmarshalJSON([]byte(data)); err != nil {
+		t.Fatalf("failed to decode list: %v", err)
+	}
+
+	return list
+}
+
+// readFiles will return the contents of the files in the directory, keyed by
+// their paths relative to the directory.
+func readFiles(t *testing.T, dir string) map[string]string {
+	t.Helper()
+
+	files := make(map[string]string)
+
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+
+		if strings.HasSuffix(path, ".gz") && len(data) > 0 {
+			reader, err := gzip.NewReader(strings.NewReader(string(data)))
+			if err != nil {
+				return err
+			}
+
+			if data, err = io.ReadAll(reader); err != nil {
+				return err
+			}
+		}
+
+		rel, _ := filepath.Rel(dir, path)
+		files[filepath.ToSlash(rel)] = string(data)
+
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("failed to read files: %v", err)
+	}
+
+	return files
+}
+
+// fileNames will return the sorted keys of the files.
+func fileNames(files map[string]string) []string {
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	return names
+}
+
+func TestNewFileWriterTemplate(t *testing.T) {
+	t.Parallel()
+
+	for _, tcase := range []struct {
+		template string
+		opts     []Option
+		err      error
+	}{
+		{template: "{host}/{socket}/{date}/{hour}/part-{n}.ndjson"},
+		{template: "", err: ErrInvalidTemplate},
+		{template: "{hostname}.ndjson", err: ErrInvalidTemplate},
+		{template: "data.ndjson", opts: []Option{WithMaxBytes(1)}, err: ErrInvalidTemplate},
+		{template: "data-{n}.ndjson", opts: []Option{WithMaxAge(time.Hour)}},
+	} {
+		if _, err := NewNDJSONWriter(tcase.template, tcase.opts...); !errors.Is(err, tcase.err) {
+			t.Fatalf("%q: expected error %v, got %v", tcase.template, tcase.err, err)
+		}
+	}
+}
+
+func TestFileWriterPartitions(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+
+	writer, err := NewNDJSONWriter(filepath.Join(dir, "{host}/{date}/part-{n}.ndjson"))
+	if err != nil {
+		t.Fatalf("failed to create writer: %v", err)
+	}
+
+	now := time.Date(2023, 1, 31, 23, 0, 0, 0, time.UTC)
+	writer.now = func() time.Time { return now }
+
+	meta := func(host string) *gidari.ListMeta {
+		req, _ := http.NewRequestWithContext(context.Background(), http.MethodGet, "http://"+host+":8080/x", nil)
+
+		return &gidari.ListMeta{Request: req}
+	}
+
+	ctx := context.Background()
+
+	for _, write := range []func() error{
+		func() error { return writer.WriteWithMeta(ctx, newList(t, `[{"x":1}]`), meta("a.com")) },
+		func() error { return writer.WriteWithMeta(ctx, newList(t, `[{"x":2}]`), meta("b.com")) },
+		func() error { return writer.Write(ctx, newList(t, `[{"x":3}]`)) },
+		func() error {
+			// The files of the previous date are finished.
+			now = now.Add(time.Hour)
+
+			return writer.WriteWithMeta(ctx, newList(t, `[{"x":4}]`), meta("a.com"))
+		},
+	} {
+		if err := write(); err != nil {
+			t.Fatalf("failed to write: %v", err)
+		}
+	}
+
+	files := readFiles(t, dir)
+
+	// Only the finished files are in place.
+	want := []string{
+		"a.com/2023-01-31/part-0.ndjson",
+		"b.com/2023-01-31/part-0.ndjson",
+		"unknown/2023-01-31/part-0.ndjson",
+	}
+
+	for _, name := range want {
+		if _, ok := files[name]; !ok {
+			t.Fatalf("expected file %q, got %v", name, fileNames(files))
+		}
+	}
+
+	if err := writer.Close(); err != nil {
+		t.Fatalf("failed to close: %v", err)
+	}
+
+	files = readFiles(t, dir)
+
+	want = append(want, "a.com/2023-02-01/part-0.ndjson")
+	sort.Strings(want)
+
+	if got := fileNames(files); fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Fatalf("files = %v, want %v", got, want)
+	}
+
+	if got := files["a.com/2023-02-01/part-0.ndjson"]; got != "{\"x\":4}\n" {
+		t.Fatalf("unexpected file contents: %q", got)
+	}
+}
+
+func TestFileWriterRotation(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	template := filepath.Join(dir, "part-{n}.ndjson")
+
+	// An existing part must not be overwritten.
+	if err := os.WriteFile(filepath.Join(dir, "part-1.ndjson.gz"), nil, 0o600); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+
+	writer, err := NewNDJSONWriter(template, WithMaxBytes(16), WithGzip())
+	if err != nil {
+		t.Fatalf("failed to create writer: %v", err)
+	}
+
+	if err := writer.Write(context.Background(), newList(t, `[{"x":1},{"x":2},{"x":3},{"x":4},{"x":5}]`)); err != nil {
+		t.Fatalf("failed to write: %v", err)
+	}
+
+	if err := writer.Close(); err != nil {
+		t.Fatalf("failed to close: %v", err)
+	}
+
+	want := map[string]string{
+		"part-0.ndjson.gz": "{\"x\":1}\n{\"x\":2}\n",
+		"part-1.ndjson.gz": "",
+		"part-2.ndjson.gz": "{\"x\":3}\n{\"x\":4}\n",
+		"part-3.ndjson.gz": "{\"x\":5}\n",
+	}
+
+	if got := readFiles(t, dir); fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Fatalf("files = %v, want %v", got, want)
+	}
+}
+
+func TestFileWriterStore(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `[{"id":1},{"id":2}]`)
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+
+	writer, err := NewJSONWriter(filepath.Join(dir, "{host}.json"))
+	if err != nil {
+		t.Fatalf("failed to create writer: %v", err)
+	}
+
+	svc, err := gidari.NewService(context.Background())
+	if err != nil {
+		t.Fatalf("failed to create service: %v", err)
+	}
+
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodGet, server.URL, nil)
+	if err != nil {
+		t.Fatalf("failed to create request: %v", err)
+	}
+
+	svc.HTTP.Client(server.Client()).Requests(gidari.NewHTTPRequest(req, gidari.WithWriters(writer)))
+
+	// The writer is closed when the service finishes, renaming the file
+	// into place.
+	if err := svc.HTTP.Store(context.Background()); err != nil {
+		t.Fatalf("failed to store: %v", err)
+	}
+
+	want := map[string]string{
+		"127.0.0.1.json": "[\n  {\n    \"id\": 1\n  },\n  {\n    \"id\": 2\n  }\n]\n",
+	}
+
+	if got := readFiles(t, dir); fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Fatalf("files = %q, want %q", got, want)
+	}
+
+	// Storing again must not overwrite the file of the first store, since
+	// the template has no {n} placeholder.
+	svc, err = gidari.NewService(context.Background())
+	if err != nil {
+		t.Fatalf("failed to create service: %v", err)
+	}
+
+	svc.HTTP.Client(server.Client()).Requests(gidari.NewHTTPRequest(req, gidari.WithWriters(writer)))
+
+	if err := svc.HTTP.Store(context.Background()); !errors.Is(err, ErrFileExists) {
+		t.Fatalf("expected error %v, got %v", ErrFileExists, err)
+	}
+
+	if got := readFiles(t, dir); fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Fatalf("files = %q, want %q", got, want)
+	}
+}
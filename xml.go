@@ -0,0 +1,202 @@
+// Copyright 2023 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+
+package gidari
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"golang.org/x/net/html/charset"
+	structpb "google.golang.org/protobuf/types/known/structpb"
+)
+
+const (
+	// XMLAttributePrefix is the prefix for the keys of attributes decoded
+	// from XML elements.
+	XMLAttributePrefix = "@"
+
+	// XMLTextKey is the key for the text content of XML elements that also
+	// have attributes or child elements.
+	XMLTextKey = "#text"
+)
+
+type xmlDecoder struct {
+	recordPath []string
+}
+
+// XMLOption is a function for configuring the XML decoder.
+type XMLOption func(*xmlDecoder)
+
+// WithXMLRecordPath will set the slash-separated path of the elements that are
+// decoded as the records of the list, starting at the root element, e.g.
+// "rss/channel/item". A path segment of "*" matches any element. By default,
+// the root element is decoded as the only record.
+func WithXMLRecordPath(path string) XMLOption {
+	return func(dec *xmlDecoder) {
+		dec.recordPath = strings.Split(strings.Trim(path, "/"), "/")
+	}
+}
+
+// NewXMLDecoder will return a decoder factory for XML data. Elements are
+// decoded into structpb values using the following convention:
+//
+//   - an element with neither attributes nor child elements is decoded as its
+//     text content, e.g. "<name>foo</name>" is decoded as "foo"
+//   - otherwise, the element is decoded as a struct, where attributes are
+//     keyed by their name with the XMLAttributePrefix, child elements by their
+//     name and the text content, if any, by the XMLTextKey
+//   - child elements with the same name are decoded as a list
+//   - namespaces are ignored, elements and attributes are keyed by their
+//     local name
+//
+// Records are always decoded as structs. A record without attributes or
+// child elements is decoded as a struct with the text content under the
+// XMLTextKey.
+func NewXMLDecoder(opts ...XMLOption) DecoderFactory {
+	dec := &xmlDecoder{}
+	for _, opt := range opts {
+		opt(dec)
+	}
+
+	return func(r io.Reader) DecodeFunc {
+		return func(list *structpb.ListValue) error {
+			return dec.decode(r, list)
+		}
+	}
+}
+
+// isRecord will check if the path of the current element matches the record
+// path.
+func (dec *xmlDecoder) isRecord(path []string) bool {
+	if len(dec.recordPath) == 0 {
+		return len(path) == 1
+	}
+
+	if len(path) != len(dec.recordPath) {
+		return false
+	}
+
+	for idx, name := range dec.recordPath {
+		if name != "*" && name != path[idx] {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (dec *xmlDecoder) decode(r io.Reader, list *structpb.ListValue) error {
+	decoder := xml.NewDecoder(r)
+
+	// Legacy feeds often declare an encoding other than UTF-8, such as
+	// "ISO-8859-1" or "windows-1252".
+	decoder.CharsetReader = charset.NewReaderLabel
+
+	var path []string
+
+	for {
+		tok, err := decoder.Token()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+
+		if err != nil {
+			return fmt.Errorf("failed to decode xml: %w", err)
+		}
+
+		switch tok := tok.(type) {
+		case xml.StartElement:
+			path = append(path, tok.Name.Local)
+
+			if !dec.isRecord(path) {
+				continue
+			}
+
+			// Decode the entire record, consuming the end element.
+			val, err := decodeXMLElement(decoder, tok)
+			if err != nil {
+				return err
+			}
+
+			if val.GetStructValue() == nil {
+				val = structpb.NewStructValue(&structpb.Struct{
+					Fields: map[string]*structpb.Value{XMLTextKey: val},
+				})
+			}
+
+			list.Values = append(list.Values, val)
+			path = path[:len(path)-1]
+		case xml.EndElement:
+			path = path[:len(path)-1]
+		}
+	}
+}
+
+// decodeXMLElement will decode the element that starts with the given token,
+// up to and including its end element.
+func decodeXMLElement(decoder *xml.Decoder, start xml.StartElement) (*structpb.Value, error) {
+	fields := make(map[string]*structpb.Value)
+
+	for _, attr := range start.Attr {
+		// Skip namespace declarations.
+		if attr.Name.Space == "xmlns" || attr.Name.Local == "xmlns" {
+			continue
+		}
+
+		fields[XMLAttributePrefix+attr.Name.Local] = structpb.NewStringValue(attr.Value)
+	}
+
+	var text strings.Builder
+
+	children := make(map[string][]*structpb.Value)
+
+	for {
+		tok, err := decoder.Token()
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode xml element %q: %w", start.Name.Local, err)
+		}
+
+		switch tok := tok.(type) {
+		case xml.StartElement:
+			child, err := decodeXMLElement(decoder, tok)
+			if err != nil {
+				return nil, err
+			}
+
+			children[tok.Name.Local] = append(children[tok.Name.Local], child)
+		case xml.CharData:
+			text.Write(tok)
+		case xml.EndElement:
+			content := strings.TrimSpace(text.String())
+
+			if len(fields) == 0 && len(children) == 0 {
+				return structpb.NewStringValue(content), nil
+			}
+
+			for name, vals := range children {
+				if len(vals) == 1 {
+					fields[name] = vals[0]
+
+					continue
+				}
+
+				fields[name] = structpb.NewListValue(&structpb.ListValue{Values: vals})
+			}
+
+			if content != "" {
+				fields[XMLTextKey] = structpb.NewStringValue(content)
+			}
+
+			return structpb.NewStructValue(&structpb.Struct{Fields: fields}), nil
+		}
+	}
+}
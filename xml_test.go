@@ -0,0 +1,187 @@
+// Copyright 2023 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+
+package gidari
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"google.golang.org/protobuf/proto"
+	structpb "google.golang.org/protobuf/types/known/structpb"
+)
+
+func TestXMLDecoder(t *testing.T) {
+	t.Parallel()
+
+	const feed = `<?xml version="1.0" encoding="UTF-8"?>
+<rss version="2.0">
+  <channel>
+    <title>News</title>
+    <item id="1"><title>foo</title><category>a</category><category>b</category></item>
+    <item id="2"><title>bar</title></item>
+  </channel>
+</rss>`
+
+	for _, tcase := range []struct {
+		name            string
+		data            string
+		opts            []XMLOption
+		expectedResults []interface{}
+		err             bool
+	}{
+		{
+			name: "empty data",
+		},
+		{
+			name: "root element",
+			data: `<user id="1"><name>foo</name></user>`,
+			expectedResults: []interface{}{
+				map[string]interface{}{"@id": "1", "name": "foo"},
+			},
+		},
+		{
+			name: "text content with attributes",
+			data: `<price currency="EUR">9.50</price>`,
+			expectedResults: []interface{}{
+				map[string]interface{}{"@currency": "EUR", "#text": "9.50"},
+			},
+		},
+		{
+			name: "text-only record",
+			data: `<name>foo</name>`,
+			expectedResults: []interface{}{
+				map[string]interface{}{"#text": "foo"},
+			},
+		},
+		{
+			name: "namespaces",
+			data: `<a:user xmlns:a="urn:a" a:id="1"><a:name>foo</a:name></a:user>`,
+			expectedResults: []interface{}{
+				map[string]interface{}{"@id": "1", "name": "foo"},
+			},
+		},
+		{
+			name: "record path",
+			data: feed,
+			opts: []XMLOption{WithXMLRecordPath("rss/channel/item")},
+			expectedResults: []interface{}{
+				map[string]interface{}{
+					"@id":      "1",
+					"title":    "foo",
+					"category": []interface{}{"a", "b"},
+				},
+				map[string]interface{}{"@id": "2", "title": "bar"},
+			},
+		},
+		{
+			name: "record path with wildcard",
+			data: feed,
+			opts: []XMLOption{WithXMLRecordPath("/*/channel/title/")},
+			expectedResults: []interface{}{
+				map[string]interface{}{"#text": "News"},
+			},
+		},
+		{
+			name: "record path without matches",
+			data: feed,
+			opts: []XMLOption{WithXMLRecordPath("feed/entry")},
+		},
+		{
+			name: "latin-1 feed",
+			data: "<?xml version=\"1.0\" encoding=\"ISO-8859-1\"?>\n" +
+				"<rss><channel><item><title>Caf\xe9 cr\xe8me</title></item></channel></rss>",
+			opts: []XMLOption{WithXMLRecordPath("rss/channel/item")},
+			expectedResults: []interface{}{
+				map[string]interface{}{"title": "Café crème"},
+			},
+		},
+		{
+			name: "windows-1252 feed",
+			data: "<?xml version=\"1.0\" encoding=\"windows-1252\"?>\n<title>\x93quoted\x94 \x80</title>",
+			expectedResults: []interface{}{
+				map[string]interface{}{"#text": "\u201cquoted\u201d \u20ac"},
+			},
+		},
+		{
+			name: "unknown encoding",
+			data: `<?xml version="1.0" encoding="x-unknown"?><title>foo</title>`,
+			err:  true,
+		},
+		{
+			name: "malformed data",
+			data: `<user><name>foo</user>`,
+			err:  true,
+		},
+	} {
+		tcase := tcase
+
+		t.Run(tcase.name, func(t *testing.T) {
+			t.Parallel()
+
+			list := &structpb.ListValue{}
+
+			err := NewXMLDecoder(tcase.opts...)(strings.NewReader(tcase.data))(list)
+			if (err != nil) != tcase.err {
+				t.Fatalf("expected error %v, got %v", tcase.err, err)
+			}
+
+			if tcase.err {
+				return
+			}
+
+			expectedList, err := structpb.NewList(tcase.expectedResults)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if !proto.Equal(expectedList, list) {
+				t.Fatalf("unexpected list: %v", list)
+			}
+		})
+	}
+}
+
+func TestHTTPServiceStoreXML(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/atom+xml")
+		fmt.Fprint(w, `<feed><entry><id>1</id></entry><entry><id>2</id></entry></feed>`)
+	}))
+	defer server.Close()
+
+	svc, err := NewService(context.Background())
+	if err != nil {
+		t.Fatalf("failed to create service: %v", err)
+	}
+
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodGet, server.URL, nil)
+	if err != nil {
+		t.Fatalf("failed to create request: %v", err)
+	}
+
+	writer := &mockListWriter{}
+
+	decoders := NewDecoderRegistry()
+	decoders.Register("application/atom+xml", NewXMLDecoder(WithXMLRecordPath("feed/entry")))
+
+	svc.HTTP.Client(server.Client()).Decoders(decoders).Requests(NewHTTPRequest(req, WithWriters(writer)))
+
+	if err := svc.HTTP.Store(context.Background()); err != nil {
+		t.Fatalf("failed to store: %v", err)
+	}
+
+	assertSocketWrites(t, []ListWriter{writer}, [][]byte{
+		[]byte(`[{"id":"1"},{"id":"2"}]`),
+	})
+}